@@ -0,0 +1,378 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/riff"
+)
+
+// msADPCMCoefs are the 7 standard predictor coefficient pairs of Microsoft
+// ADPCM, written in the fmt chunk.
+var msADPCMCoefs = [7][2]int{
+	{256, 0}, {512, -256}, {0, 0}, {192, 64}, {240, 0}, {460, -208}, {392, -232},
+}
+
+// msADPCMAdaptation scales the quantization step according to the last
+// encoded nibble.
+var msADPCMAdaptation = [16]int{
+	230, 230, 230, 230, 307, 409, 512, 614, 768, 614, 512, 409, 307, 230, 230, 230,
+}
+
+// msADPCMMinDelta is the smallest quantization step.
+const msADPCMMinDelta = 16
+
+// FactPosition is the position of the fact chunk in the file, some decoders
+// only finding it at one of them.
+type FactPosition int
+
+const (
+	// FactAfterFmt writes the fact chunk right after the fmt chunk, before
+	// the data chunk. The number of frames is patched on Close.
+	FactAfterFmt FactPosition = iota
+	// FactAfterData writes the fact chunk after the data chunk on Close.
+	FactAfterData
+)
+
+// ADPCMEncoder writes 4 bit Microsoft ADPCM wav files (FormatMSADPCM), a
+// quarter of the size of 16 bit PCM, suited to voice. The 16 bit samples are
+// encoded in blocks of BlockAlign bytes, each block starting with the
+// predictor, step and first samples of each channel. The fmt chunk holds the
+// samples per block and the coefficient table, and a fact chunk holds the
+// number of frames since the last block is padded, see FactPosition.
+// Metadata isn't written.
+type ADPCMEncoder struct {
+	// BlockAlign is the size of the blocks, 256 bytes per channel per
+	// 11025Hz of sample rate by default like the Windows encoder. It must
+	// be set before writing.
+	BlockAlign int
+	// FactPosition is the position of the fact chunk, FactAfterFmt by
+	// default. It must be set before writing.
+	FactPosition FactPosition
+
+	w          WriterAtSeeker
+	cw         *ChunkWriter
+	sampleRate int
+	numChans   int
+
+	samplesPerBlock int
+	// pending holds the interleaved samples of the block being filled.
+	pending []int
+	frames  int
+	factPos int64
+	started bool
+}
+
+// NewADPCMEncoder creates an encoder writing a Microsoft ADPCM wav file to w.
+func NewADPCMEncoder(w WriterAtSeeker, sampleRate, numChans int) *ADPCMEncoder {
+	scale := sampleRate / 11025
+	if scale < 1 {
+		scale = 1
+	}
+	return &ADPCMEncoder{
+		BlockAlign: 256 * numChans * scale,
+		w:          w,
+		sampleRate: sampleRate,
+		numChans:   numChans,
+	}
+}
+
+// SamplesPerBlock returns the number of frames encoded in each block.
+func (a *ADPCMEncoder) SamplesPerBlock() int {
+	if a.numChans < 1 {
+		return 0
+	}
+	// the 7 header bytes per channel hold 2 samples, then 2 samples per byte
+	return (a.BlockAlign-7*a.numChans)*2/a.numChans + 2
+}
+
+// EstimateSize returns the size in bytes of the file holding the passed
+// duration of audio: the RIFF header, the fmt chunk with the coefficient
+// table, the fact chunk and the data chunk, the last block being padded.
+func (a *ADPCMEncoder) EstimateSize(duration time.Duration) int64 {
+	frames := int64(FramesForDuration(duration, a.sampleRate))
+	spb := int64(a.SamplesPerBlock())
+	if spb < 1 {
+		return 0
+	}
+	dataSize := (frames + spb - 1) / spb * int64(a.BlockAlign)
+	// RIFF header, fmt, fact and data chunks
+	return 12 + 8 + int64(20+4*len(msADPCMCoefs)+2) + 8 + 4 + 8 + dataSize + dataSize%2
+}
+
+// Write encodes and writes the passed buffer of 16 bit samples, samples out of
+// the 16 bit range are clipped. The samples are buffered until a block is
+// full.
+func (a *ADPCMEncoder) Write(buf *audio.IntBuffer) error {
+	if buf == nil {
+		return errors.New("can't add a nil buffer")
+	}
+	if err := a.writeHeader(); err != nil {
+		return err
+	}
+	data := buf.Data[:len(buf.Data)/a.numChans*a.numChans]
+	blockSamples := a.samplesPerBlock * a.numChans
+	for len(data) > 0 {
+		n := blockSamples - len(a.pending)
+		if n > len(data) {
+			n = len(data)
+		}
+		a.pending = append(a.pending, data[:n]...)
+		a.frames += n / a.numChans
+		data = data[n:]
+		if len(a.pending) == blockSamples {
+			if err := a.writeBlock(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close encodes the last block, padded with silence, and patches the sizes
+// and the number of frames. The underlying writer isn't closed.
+func (a *ADPCMEncoder) Close() error {
+	if err := a.writeHeader(); err != nil {
+		return err
+	}
+	if len(a.pending) > 0 {
+		a.pending = append(a.pending, make([]int, a.samplesPerBlock*a.numChans-len(a.pending))...)
+		if err := a.writeBlock(); err != nil {
+			return err
+		}
+	}
+	// the data chunk
+	if err := a.cw.EndChunk(); err != nil {
+		return err
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(a.frames))
+	if a.FactPosition == FactAfterData {
+		if err := a.writeFact(b); err != nil {
+			return err
+		}
+	}
+	// the RIFF chunk
+	if err := a.cw.EndChunk(); err != nil {
+		return err
+	}
+	if a.FactPosition == FactAfterFmt {
+		if _, err := a.w.WriteAt(b, a.factPos); err != nil {
+			return fmt.Errorf("failed to patch the number of frames - %w", err)
+		}
+	}
+	return nil
+}
+
+func (a *ADPCMEncoder) writeHeader() error {
+	if a.started {
+		return nil
+	}
+	if a.numChans < 1 || a.numChans > 2 {
+		return fmt.Errorf("invalid number of channels %d, ADPCM supports mono and stereo", a.numChans)
+	}
+	if a.sampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate %d", a.sampleRate)
+	}
+	if a.FactPosition != FactAfterFmt && a.FactPosition != FactAfterData {
+		return fmt.Errorf("invalid fact chunk position %d", a.FactPosition)
+	}
+	// a block holds at least the header of each channel
+	if a.BlockAlign > math.MaxUint16 || a.BlockAlign < 7*a.numChans {
+		return fmt.Errorf("invalid block align %d for %d channels", a.BlockAlign, a.numChans)
+	}
+	a.started = true
+	a.samplesPerBlock = a.SamplesPerBlock()
+	a.pending = make([]int, 0, a.samplesPerBlock*a.numChans)
+
+	fmtChunk := make([]byte, 20+4*len(msADPCMCoefs)+2)
+	binary.LittleEndian.PutUint16(fmtChunk[0:], FormatMSADPCM)
+	binary.LittleEndian.PutUint16(fmtChunk[2:], uint16(a.numChans))
+	binary.LittleEndian.PutUint32(fmtChunk[4:], uint32(a.sampleRate))
+	binary.LittleEndian.PutUint32(fmtChunk[8:], uint32(int64(a.sampleRate)*int64(a.BlockAlign)/int64(a.samplesPerBlock)))
+	binary.LittleEndian.PutUint16(fmtChunk[12:], uint16(a.BlockAlign))
+	binary.LittleEndian.PutUint16(fmtChunk[14:], 4)
+	// the extension: its size, the samples per block and the coefficients
+	binary.LittleEndian.PutUint16(fmtChunk[16:], uint16(len(fmtChunk)-18))
+	binary.LittleEndian.PutUint16(fmtChunk[18:], uint16(a.samplesPerBlock))
+	binary.LittleEndian.PutUint16(fmtChunk[20:], uint16(len(msADPCMCoefs)))
+	for i, c := range msADPCMCoefs {
+		binary.LittleEndian.PutUint16(fmtChunk[22+i*4:], uint16(int16(c[0])))
+		binary.LittleEndian.PutUint16(fmtChunk[24+i*4:], uint16(int16(c[1])))
+	}
+
+	a.cw = NewChunkWriter(a.w)
+	steps := []func() error{
+		func() error { return a.cw.BeginChunk(riff.RiffID) },
+		func() error { _, err := a.cw.Write(riff.WavFormatID[:]); return err },
+		func() error { return a.cw.BeginChunk(riff.FmtID) },
+		func() error { _, err := a.cw.Write(fmtChunk); return err },
+		a.cw.EndChunk,
+		func() error {
+			if a.FactPosition != FactAfterFmt {
+				return nil
+			}
+			// the number of frames is patched on Close
+			return a.writeFact(make([]byte, 4))
+		},
+		func() error { return a.cw.BeginChunk(riff.DataFormatID) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return fmt.Errorf("failed to write the header - %w", err)
+		}
+	}
+	return nil
+}
+
+// writeFact writes the fact chunk holding the passed number of frames and
+// records the offset of the number.
+func (a *ADPCMEncoder) writeFact(frames []byte) error {
+	if err := a.cw.BeginChunk(CIDFact); err != nil {
+		return err
+	}
+	a.factPos = a.cw.Offset()
+	if _, err := a.cw.Write(frames); err != nil {
+		return fmt.Errorf("failed to write the fact chunk - %w", err)
+	}
+	return a.cw.EndChunk()
+}
+
+// writeBlock encodes and writes the pending samples, which fill a block.
+func (a *ADPCMEncoder) writeBlock() error {
+	block := encodeMSADPCMBlock(a.pending, a.numChans, a.BlockAlign)
+	if _, err := a.cw.Write(block); err != nil {
+		return fmt.Errorf("failed to write an ADPCM block - %w", err)
+	}
+	a.pending = a.pending[:0]
+	return nil
+}
+
+// msADPCMState is the decoder state of a channel, which the encoder mirrors.
+type msADPCMState struct {
+	coef1, coef2 int
+	delta        int
+	// sample1 is the last sample and sample2 the one before.
+	sample1, sample2 int
+}
+
+// encode returns the nibble encoding v and updates the state like the decoder
+// would.
+func (s *msADPCMState) encode(v int) int {
+	predictor := (s.sample1*s.coef1 + s.sample2*s.coef2) >> 8
+	diff := v - predictor
+	// round to the nearest step
+	bias := s.delta / 2
+	if diff < 0 {
+		bias = -bias
+	}
+	nibble := (diff + bias) / s.delta
+	if nibble > 7 {
+		nibble = 7
+	} else if nibble < -8 {
+		nibble = -8
+	}
+	s.decode(nibble)
+	return nibble & 0xF
+}
+
+// decode updates the state with the passed signed nibble and returns the
+// decoded sample.
+func (s *msADPCMState) decode(nibble int) int {
+	predictor := (s.sample1*s.coef1 + s.sample2*s.coef2) >> 8
+	v := clampSample16(predictor + nibble*s.delta)
+	s.sample2, s.sample1 = s.sample1, v
+	s.delta = msADPCMAdaptation[nibble&0xF] * s.delta >> 8
+	if s.delta < msADPCMMinDelta {
+		s.delta = msADPCMMinDelta
+	}
+	return v
+}
+
+func clampSample16(v int) int {
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return v
+}
+
+// encodeMSADPCMBlock encodes a block of interleaved samples. The predictor of
+// each channel is the one of the 7 standard coefficient pairs giving the
+// smallest error over the block.
+func encodeMSADPCMBlock(samples []int, numChans, blockAlign int) []byte {
+	block := make([]byte, blockAlign)
+	frames := len(samples) / numChans
+	states := make([]msADPCMState, numChans)
+	channel := make([]int, frames)
+	for c := 0; c < numChans; c++ {
+		for i := range channel {
+			channel[i] = clampSample16(samples[i*numChans+c])
+		}
+		best, bestErr := 0, -1.0
+		for p := range msADPCMCoefs {
+			s := newMSADPCMState(p, channel)
+			var sqErr float64
+			for _, v := range channel[2:] {
+				s.encode(v)
+				d := float64(v - s.sample1)
+				sqErr += d * d
+			}
+			if bestErr < 0 || sqErr < bestErr {
+				best, bestErr = p, sqErr
+			}
+		}
+		states[c] = newMSADPCMState(best, channel)
+		// the header fields are grouped by kind, each holding all channels
+		block[c] = byte(best)
+		binary.LittleEndian.PutUint16(block[numChans+c*2:], uint16(int16(states[c].delta)))
+		binary.LittleEndian.PutUint16(block[3*numChans+c*2:], uint16(int16(states[c].sample1)))
+		binary.LittleEndian.PutUint16(block[5*numChans+c*2:], uint16(int16(states[c].sample2)))
+	}
+	// the nibbles of the following samples are interleaved, high nibble first
+	n := 0
+	for i := 2; i < frames; i++ {
+		for c := 0; c < numChans; c++ {
+			nibble := byte(states[c].encode(clampSample16(samples[i*numChans+c])))
+			if n%2 == 0 {
+				block[7*numChans+n/2] = nibble << 4
+			} else {
+				block[7*numChans+n/2] |= nibble
+			}
+			n++
+		}
+	}
+	return block
+}
+
+// newMSADPCMState returns the state of a channel starting a block with the
+// passed predictor, the first two samples being stored as is. The initial
+// step is derived from the prediction error of the third sample.
+func newMSADPCMState(predictor int, channel []int) msADPCMState {
+	s := msADPCMState{
+		coef1:   msADPCMCoefs[predictor][0],
+		coef2:   msADPCMCoefs[predictor][1],
+		delta:   msADPCMMinDelta,
+		sample1: channel[1],
+		sample2: channel[0],
+	}
+	if len(channel) > 2 {
+		diff := channel[2] - (s.sample1*s.coef1+s.sample2*s.coef2)>>8
+		if diff < 0 {
+			diff = -diff
+		}
+		if d := diff / 4; d > s.delta {
+			s.delta = d
+		}
+		if s.delta > math.MaxInt16 {
+			s.delta = math.MaxInt16
+		}
+	}
+	return s
+}
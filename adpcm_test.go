@@ -0,0 +1,230 @@
+package wav
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+// decodeMSADPCM is a reference Microsoft ADPCM decoder returning the format
+// fields, the number of frames of the fact chunk and the decoded interleaved
+// samples of the data chunk.
+func decodeMSADPCM(t *testing.T, b []byte) (fmtChunk []byte, frames int, samples []int) {
+	t.Helper()
+	if string(b[:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		t.Fatal("expected a RIFF WAVE file")
+	}
+	if size := binary.LittleEndian.Uint32(b[4:]); int(size) != len(b)-8 {
+		t.Fatalf("expected the RIFF size to be %d, got %d", len(b)-8, size)
+	}
+	var data []byte
+	for pos := 12; pos+8 <= len(b); {
+		id, size := string(b[pos:pos+4]), int(binary.LittleEndian.Uint32(b[pos+4:]))
+		body := b[pos+8 : pos+8+size]
+		switch id {
+		case "fmt ":
+			fmtChunk = body
+		case "fact":
+			frames = int(binary.LittleEndian.Uint32(body))
+		case "data":
+			data = body
+		}
+		pos += 8 + size + size%2
+	}
+	numChans := int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+	blockAlign := int(binary.LittleEndian.Uint16(fmtChunk[12:]))
+	samplesPerBlock := int(binary.LittleEndian.Uint16(fmtChunk[18:]))
+	var coefs [][2]int
+	for i := 0; i < int(binary.LittleEndian.Uint16(fmtChunk[20:])); i++ {
+		coefs = append(coefs, [2]int{
+			int(int16(binary.LittleEndian.Uint16(fmtChunk[22+i*4:]))),
+			int(int16(binary.LittleEndian.Uint16(fmtChunk[24+i*4:]))),
+		})
+	}
+	if len(data)%blockAlign != 0 {
+		t.Fatalf("expected whole blocks of %d bytes, got %d bytes", blockAlign, len(data))
+	}
+	adaptation := []int{230, 230, 230, 230, 307, 409, 512, 614, 768, 614, 512, 409, 307, 230, 230, 230}
+
+	for ; len(data) > 0; data = data[blockAlign:] {
+		block := data[:blockAlign]
+		coef1, coef2 := make([]int, numChans), make([]int, numChans)
+		delta, s1, s2 := make([]int, numChans), make([]int, numChans), make([]int, numChans)
+		for c := 0; c < numChans; c++ {
+			coef1[c], coef2[c] = coefs[block[c]][0], coefs[block[c]][1]
+			delta[c] = int(int16(binary.LittleEndian.Uint16(block[numChans+c*2:])))
+			s1[c] = int(int16(binary.LittleEndian.Uint16(block[3*numChans+c*2:])))
+			s2[c] = int(int16(binary.LittleEndian.Uint16(block[5*numChans+c*2:])))
+		}
+		samples = append(samples, s2...)
+		samples = append(samples, s1...)
+		for n := 0; n < (samplesPerBlock-2)*numChans; n++ {
+			c := n % numChans
+			nibble := int(block[7*numChans+n/2] >> 4)
+			if n%2 == 1 {
+				nibble = int(block[7*numChans+n/2] & 0xF)
+			}
+			signed := nibble
+			if signed >= 8 {
+				signed -= 16
+			}
+			v := (s1[c]*coef1[c]+s2[c]*coef2[c])>>8 + signed*delta[c]
+			if v > math.MaxInt16 {
+				v = math.MaxInt16
+			} else if v < math.MinInt16 {
+				v = math.MinInt16
+			}
+			s2[c], s1[c] = s1[c], v
+			samples = append(samples, v)
+			delta[c] = adaptation[nibble] * delta[c] >> 8
+			if delta[c] < 16 {
+				delta[c] = 16
+			}
+		}
+	}
+	return fmtChunk, frames, samples
+}
+
+func TestADPCMEncoder(t *testing.T) {
+	testCases := []struct {
+		desc                 string
+		sampleRate, numChans int
+		frames               int
+		expBlockAlign        int
+		expSamplesPerBlock   int
+	}{
+		{"mono 8kHz", 8000, 1, 3210, 256, 500},
+		{"stereo 22kHz", 22050, 2, 5000, 1024, 1012},
+		{"mono 44.1kHz single partial block", 44100, 1, 100, 1024, 2036},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			const amplitude = 10000
+			data := make([]int, tc.frames*tc.numChans)
+			for i := 0; i < tc.frames; i++ {
+				for c := 0; c < tc.numChans; c++ {
+					freq := 440.0 * float64(c+1)
+					data[i*tc.numChans+c] = int(amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(tc.sampleRate)))
+				}
+			}
+
+			w := &memWriter{}
+			a := NewADPCMEncoder(w, tc.sampleRate, tc.numChans)
+			if a.SamplesPerBlock() != tc.expSamplesPerBlock {
+				t.Fatalf("expected %d samples per block, got %d", tc.expSamplesPerBlock, a.SamplesPerBlock())
+			}
+			format := &audio.Format{NumChannels: tc.numChans, SampleRate: tc.sampleRate}
+			// odd sized writes to cross the block boundaries
+			for start := 0; start < len(data); start += 333 * tc.numChans {
+				end := start + 333*tc.numChans
+				if end > len(data) {
+					end = len(data)
+				}
+				if err := a.Write(&audio.IntBuffer{Format: format, Data: data[start:end]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := a.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			fmtChunk, frames, decoded := decodeMSADPCM(t, w.buf)
+			for _, f := range []struct {
+				name     string
+				got, exp int
+			}{
+				{"format", int(binary.LittleEndian.Uint16(fmtChunk[0:])), FormatMSADPCM},
+				{"channels", int(binary.LittleEndian.Uint16(fmtChunk[2:])), tc.numChans},
+				{"sample rate", int(binary.LittleEndian.Uint32(fmtChunk[4:])), tc.sampleRate},
+				{"avg bytes per sec", int(binary.LittleEndian.Uint32(fmtChunk[8:])), tc.sampleRate * tc.expBlockAlign / tc.expSamplesPerBlock},
+				{"block align", int(binary.LittleEndian.Uint16(fmtChunk[12:])), tc.expBlockAlign},
+				{"bits per sample", int(binary.LittleEndian.Uint16(fmtChunk[14:])), 4},
+				{"extension size", int(binary.LittleEndian.Uint16(fmtChunk[16:])), 32},
+				{"samples per block", int(binary.LittleEndian.Uint16(fmtChunk[18:])), tc.expSamplesPerBlock},
+				{"coefficients", int(binary.LittleEndian.Uint16(fmtChunk[20:])), 7},
+				{"frames", frames, tc.frames},
+			} {
+				if f.got != f.exp {
+					t.Errorf("expected the %s to be %d, got %d", f.name, f.exp, f.got)
+				}
+			}
+			blocks := (tc.frames + tc.expSamplesPerBlock - 1) / tc.expSamplesPerBlock
+			if len(decoded) != blocks*tc.expSamplesPerBlock*tc.numChans {
+				t.Fatalf("expected %d blocks, got %d samples", blocks, len(decoded))
+			}
+
+			// ADPCM is lossy, the error of a sine is about 30dB below it
+			var sqErr float64
+			for i, v := range data {
+				d := float64(decoded[i] - v)
+				sqErr += d * d
+			}
+			if rms := math.Sqrt(sqErr / float64(len(data))); rms > amplitude*0.03 {
+				t.Fatalf("expected the RMS error to be within 3%% of the amplitude, got %.1f", rms)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		desc       string
+		numChans   int
+		blockAlign int
+	}{
+		{"too many channels", 3, 0},
+		{"block smaller than its header", 2, 13},
+		{"block too large", 1, 1 << 16},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			a := NewADPCMEncoder(&memWriter{}, 8000, tc.numChans)
+			if tc.blockAlign != 0 {
+				a.BlockAlign = tc.blockAlign
+			}
+			if err := a.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: tc.numChans, SampleRate: 8000}, Data: make([]int, 6)}); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestADPCMEncoderFactPosition(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		position FactPosition
+		exp      []string
+	}{
+		{"after fmt", FactAfterFmt, []string{"fmt ", "fact", "data"}},
+		{"after data", FactAfterData, []string{"fmt ", "data", "fact"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			a := NewADPCMEncoder(w, 8000, 1)
+			a.FactPosition = tc.position
+			if err := a.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: make([]int, 1234)}); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.Close(); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, c := range fileChunks(w.buf) {
+				ids = append(ids, string(c.ID[:]))
+			}
+			if !reflect.DeepEqual(ids, tc.exp) {
+				t.Fatalf("expected the chunks %q, got %q", tc.exp, ids)
+			}
+			if _, frames, _ := decodeMSADPCM(t, w.buf); frames != 1234 {
+				t.Fatalf("expected the fact chunk to hold 1234 frames, got %d", frames)
+			}
+		})
+	}
+
+	a := NewADPCMEncoder(&memWriter{}, 8000, 1)
+	a.FactPosition = FactAfterData + 1
+	if err := a.Close(); err == nil {
+		t.Fatal("expected an invalid fact position to be rejected")
+	}
+}
@@ -0,0 +1,232 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-audio/riff"
+)
+
+// bextFixedSize is the size of the fixed part of the bext chunk, the coding
+// history follows it.
+const bextFixedSize = 602
+
+// BextChunk is the broadcast audio extension chunk of Broadcast Wave Format
+// files (EBU Tech 3285). Text fields longer than their fixed size in the
+// chunk are truncated.
+type BextChunk struct {
+	// Description of the sound sequence, up to 256 characters.
+	Description string
+	// Originator is the name of the originator, up to 32 characters.
+	Originator string
+	// OriginatorReference is a unique reference set by the originator, up
+	// to 32 characters.
+	OriginatorReference string
+	// OriginationDate is the creation date formatted as yyyy:mm:dd.
+	OriginationDate string
+	// OriginationTime is the creation time formatted as hh:mm:ss.
+	OriginationTime string
+	// TimeReference is the first frame of the sequence counted in frames
+	// since midnight. It is the absolute position of the start of the data
+	// chunk while cue points are relative to the data chunk, see
+	// CuePointAt and CueTimeReference.
+	TimeReference uint64
+	// Version of the BWF specification.
+	Version uint16
+	// UMID is the SMPTE 330M unique material identifier, the extended UMID
+	// uses the whole 64 bytes, the basic one only the first 32. See ParseUMID
+	// and FormatUMID to convert it from and to its hex representation.
+	UMID [64]byte
+	// Loudness values of version 2, in hundredths of LUFS, LU or dB.
+	LoudnessValue        int16
+	LoudnessRange        int16
+	MaxTruePeakLevel     int16
+	MaxMomentaryLoudness int16
+	MaxShortTermLoudness int16
+	// CodingHistory lists the coding processes applied to the audio, one
+	// line per process. For example:
+	// A=PCM,F=48000,W=24,M=stereo,T=original.
+	CodingHistory []string
+}
+
+// CuePointAt returns a cue point with the passed ID marking the absolute
+// position timeReference, converted to a frame relative to the start of the
+// data chunk. Positions before the start of the file are refused.
+func (b *BextChunk) CuePointAt(id uint32, timeReference uint64) (*CuePoint, error) {
+	if timeReference < b.TimeReference {
+		return nil, fmt.Errorf("time reference %d is before the start of the file at %d", timeReference, b.TimeReference)
+	}
+	offset := timeReference - b.TimeReference
+	if offset > uint64(sizePlaceholder) {
+		return nil, fmt.Errorf("time reference %d is too far from the start of the file at %d", timeReference, b.TimeReference)
+	}
+	c := &CuePoint{
+		Position:     uint32(offset),
+		DataChunkID:  riff.DataFormatID,
+		SampleOffset: uint32(offset),
+	}
+	binary.LittleEndian.PutUint32(c.ID[:], id)
+	return c, nil
+}
+
+// CueTimeReference returns the absolute position, in frames since midnight,
+// of the passed cue point whose offset is relative to the data chunk.
+func (b *BextChunk) CueTimeReference(c *CuePoint) uint64 {
+	return b.TimeReference + uint64(c.SampleOffset)
+}
+
+// ParseUMID parses the hex representation of a basic (32 bytes, 64 hex
+// digits) or extended (64 bytes, 128 hex digits) UMID. Spaces, dashes, dots
+// and colons separating the digits are ignored, as is a 0x prefix. The last
+// 32 bytes of a basic UMID are left to zero.
+func ParseUMID(s string) ([64]byte, error) {
+	var umid [64]byte
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "0x"), "0X")
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', ':':
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) != 64 && len(s) != 128 {
+		return umid, fmt.Errorf("invalid UMID %q: expected 64 or 128 hex digits, got %d", s, len(s))
+	}
+	if _, err := hex.Decode(umid[:], []byte(s)); err != nil {
+		return umid, fmt.Errorf("invalid UMID %q - %w", s, err)
+	}
+	return umid, nil
+}
+
+// FormatUMID returns the upper case hex representation of the passed UMID: 64
+// digits for a basic UMID, whose last 32 bytes are zero, 128 digits for an
+// extended one.
+func FormatUMID(umid [64]byte) string {
+	b := umid[:]
+	if bytes.Equal(umid[32:], make([]byte, 32)) {
+		b = umid[:32]
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// DecodeBextChunk decodes the bext chunk of Broadcast Wave Format files.
+func DecodeBextChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID != CIDBext {
+		return nil
+	}
+	// read the entire chunk in memory
+	buf := make([]byte, ch.Size)
+	if _, err := ch.Read(buf); err != nil {
+		return fmt.Errorf("failed to read the bext chunk - %w", err)
+	}
+	if len(buf) < bextFixedSize {
+		return fmt.Errorf("bext chunk too short: %d bytes", len(buf))
+	}
+	b := &BextChunk{
+		Description:          nullTermStr(buf[0:256]),
+		Originator:           nullTermStr(buf[256:288]),
+		OriginatorReference:  nullTermStr(buf[288:320]),
+		OriginationDate:      nullTermStr(buf[320:330]),
+		OriginationTime:      nullTermStr(buf[330:338]),
+		TimeReference:        binary.LittleEndian.Uint64(buf[338:]),
+		Version:              binary.LittleEndian.Uint16(buf[346:]),
+		LoudnessValue:        int16(binary.LittleEndian.Uint16(buf[412:])),
+		LoudnessRange:        int16(binary.LittleEndian.Uint16(buf[414:])),
+		MaxTruePeakLevel:     int16(binary.LittleEndian.Uint16(buf[416:])),
+		MaxMomentaryLoudness: int16(binary.LittleEndian.Uint16(buf[418:])),
+		MaxShortTermLoudness: int16(binary.LittleEndian.Uint16(buf[420:])),
+	}
+	copy(b.UMID[:], buf[348:412])
+	for _, line := range strings.Split(nullTermStr(buf[bextFixedSize:]), "\r\n") {
+		if line != "" {
+			b.CodingHistory = append(b.CodingHistory, line)
+		}
+	}
+	if d.Metadata == nil {
+		d.Metadata = &Metadata{}
+	}
+	d.Metadata.Bext = b
+	return nil
+}
+
+// encodeBextChunk serializes the bext chunk, the coding history lines being
+// terminated by CR/LF.
+func encodeBextChunk(b *BextChunk) []byte {
+	buf := bytes.NewBuffer(nil)
+	writeString := func(s string, size int) {
+		field := make([]byte, size)
+		copy(field, s)
+		buf.Write(field)
+	}
+	writeString(b.Description, 256)
+	writeString(b.Originator, 32)
+	writeString(b.OriginatorReference, 32)
+	writeString(b.OriginationDate, 10)
+	writeString(b.OriginationTime, 8)
+	binary.Write(buf, binary.LittleEndian, b.TimeReference)
+	binary.Write(buf, binary.LittleEndian, b.Version)
+	buf.Write(b.UMID[:])
+	binary.Write(buf, binary.LittleEndian, []int16{
+		b.LoudnessValue, b.LoudnessRange, b.MaxTruePeakLevel, b.MaxMomentaryLoudness, b.MaxShortTermLoudness,
+	})
+	// reserved
+	buf.Write(make([]byte, 180))
+	for _, line := range b.CodingHistory {
+		buf.WriteString(line)
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+// setBextLevel sets a loudness field of the bext chunk, in hundredths, to the
+// passed level. Levels which couldn't be measured leave the field untouched.
+// bextChunk returns the bext chunk written on Close, nil if there is none.
+// When EnableLoudnessMeter is set to write them, the measurements are set on
+// a copy of Metadata.Bext, or on an empty chunk if it isn't set.
+func (e *Encoder) bextChunk() *BextChunk {
+	var bext *BextChunk
+	if e.Metadata != nil {
+		bext = e.Metadata.Bext
+	}
+	if e.loudness == nil || !e.loudness.writeBext {
+		return bext
+	}
+	// the user metadata is left untouched
+	var b BextChunk
+	if bext != nil {
+		b = *bext
+	}
+	stats := e.loudness.stats()
+	setBextLevel(&b.LoudnessValue, stats.Integrated)
+	setBextLevel(&b.LoudnessRange, stats.Range)
+	setBextLevel(&b.MaxTruePeakLevel, stats.MaxTruePeak)
+	setBextLevel(&b.MaxMomentaryLoudness, stats.MaxMomentary)
+	setBextLevel(&b.MaxShortTermLoudness, stats.MaxShortTerm)
+	if b.Version < 2 {
+		b.Version = 2
+	}
+	return &b
+}
+
+func setBextLevel(field *int16, level float64) {
+	if math.IsInf(level, 0) || math.IsNaN(level) {
+		return
+	}
+	v := math.Round(level * 100)
+	if v < math.MinInt16 {
+		v = math.MinInt16
+	} else if v > math.MaxInt16 {
+		v = math.MaxInt16
+	}
+	*field = int16(v)
+}
@@ -0,0 +1,146 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestBextChunk(t *testing.T) {
+	bext := &BextChunk{
+		Description:         "interview take 3",
+		Originator:          "field recorder",
+		OriginatorReference: "FR0001",
+		OriginationDate:     "2020:01:02",
+		OriginationTime:     "10:11:12",
+		TimeReference:       48000 * 3600,
+		Version:             2,
+		LoudnessValue:       -2300,
+		MaxTruePeakLevel:    -100,
+		CodingHistory: []string{
+			"A=PCM,F=48000,W=24,M=stereo,T=original",
+			// odd total length so the chunk needs a pad byte
+			"A=PCM,F=44100,W=16,M=mono,T=SRC",
+		},
+	}
+	copy(bext.UMID[:], "umid")
+
+	w := &memWriter{}
+	e := NewEncoder(w, 48000, 16, 2, 1)
+	e.Metadata = &Metadata{Title: "take", Bext: bext}
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: []int{1, 2, 3, 4}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the bext chunk follows the 4 frames of data
+	b := w.buf[44+8:]
+	if id := string(b[:4]); id != "bext" {
+		t.Fatalf("expected the bext chunk, got %q", id)
+	}
+	history := "A=PCM,F=48000,W=24,M=stereo,T=original\r\nA=PCM,F=44100,W=16,M=mono,T=SRC\r\n"
+	size := binary.LittleEndian.Uint32(b[4:])
+	if int(size) != bextFixedSize+len(history) {
+		t.Fatalf("expected the chunk size to be %d, got %d", bextFixedSize+len(history), size)
+	}
+	if got := string(b[8+bextFixedSize : 8+size]); got != history {
+		t.Fatalf("expected the coding history %q, got %q", history, got)
+	}
+	if b[8+size] != 0 || string(b[8+size+1:8+size+5]) != "LIST" {
+		t.Fatal("expected a pad byte followed by the LIST chunk")
+	}
+
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata == nil || !reflect.DeepEqual(d.Metadata.Bext, bext) {
+		t.Fatalf("expected %#v, got %#v", bext, d.Metadata.Bext)
+	}
+	if d.Metadata.Title != "take" {
+		t.Fatalf("expected the INFO chunk following the bext chunk to be decoded, got %q", d.Metadata.Title)
+	}
+}
+
+func TestBextChunkCueTimeReference(t *testing.T) {
+	const sampleRate = 48000
+	// the recording started at 10:00:00
+	bext := &BextChunk{Version: 1, TimeReference: 10 * 3600 * sampleRate}
+	// a marker at 10:00:01.5
+	absolute := bext.TimeReference + sampleRate*3/2
+	cue, err := bext.CuePointAt(1, absolute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cue.SampleOffset != sampleRate*3/2 || cue.Position != cue.SampleOffset {
+		t.Fatalf("expected the cue point to be relative to the data chunk, got %#v", cue)
+	}
+	if _, err := bext.CuePointAt(2, bext.TimeReference-1); err == nil {
+		t.Fatal("expected a position before the start of the file to be refused")
+	}
+
+	w := &memWriter{}
+	e := NewEncoder(w, sampleRate, 16, 1, FormatPCM)
+	e.Metadata = &Metadata{Bext: bext, CuePoints: []*CuePoint{cue, NewCuePointAt(3, 0, sampleRate)}}
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: sampleRate}, Data: make([]int, 2*sampleRate)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata == nil || d.Metadata.Bext == nil || len(d.Metadata.CuePoints) != 2 {
+		t.Fatalf("expected the bext and cue chunks to be decoded, got %#v", d.Metadata)
+	}
+	decoded := d.Metadata.Bext
+	if got := decoded.CueTimeReference(d.Metadata.CuePoints[0]); got != absolute {
+		t.Fatalf("expected the cue point at %d, got %d", absolute, got)
+	}
+	if got := decoded.CueTimeReference(d.Metadata.CuePoints[1]); got != bext.TimeReference {
+		t.Fatalf("expected the cue point at the start of the data to match the time reference, got %d", got)
+	}
+}
+
+func TestBextChunkUMID(t *testing.T) {
+	const basic = "060A2B340101010501010D4313000000EE36A0B0D5B105D1080046020247FA4D"
+	umid, err := ParseUMID("06.0a.2b.34 01010105 01010d43 13000000 ee36a0b0-d5b105d1-08004602-0247fa4d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatUMID(umid); got != basic {
+		t.Fatalf("expected %s, got %s", basic, got)
+	}
+	extended := "0x" + basic + "1234567890ABCDEF1234567890ABCDEF1234567890ABCDEF1234567890ABCDEF"
+	umid, err = ParseUMID(extended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatUMID(umid); got != extended[2:] {
+		t.Fatalf("expected %s, got %s", extended[2:], got)
+	}
+	for _, s := range []string{"", basic[:62], basic[:62] + "zz", basic + "00"} {
+		if _, err := ParseUMID(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+
+	// the UMID follows the version, at offset 348 of the chunk data
+	b := encodeBextChunk(&BextChunk{Version: 1, UMID: umid, LoudnessValue: -1})
+	if !bytes.Equal(b[348:412], umid[:]) {
+		t.Fatalf("expected the UMID at offset 348, got %X", b[348:412])
+	}
+	if binary.LittleEndian.Uint16(b[346:]) != 1 || int16(binary.LittleEndian.Uint16(b[412:])) != -1 {
+		t.Fatal("expected the UMID to sit between the version and the loudness value")
+	}
+}
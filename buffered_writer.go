@@ -0,0 +1,45 @@
+package wav
+
+import (
+	"bufio"
+)
+
+// bufferedWriterSize is the size of the buffer used when
+// Encoder.BufferWrites is set, large enough for the header and the metadata
+// of typical files.
+const bufferedWriterSize = 4096
+
+// bufferedWriter buffers the sequential writes to a WriterAtSeeker, the
+// buffer is flushed before any seek or positioned write so the size patching
+// sees the buffered bytes.
+type bufferedWriter struct {
+	w   WriterAtSeeker
+	buf *bufio.Writer
+}
+
+func newBufferedWriter(w WriterAtSeeker) *bufferedWriter {
+	return &bufferedWriter{w: w, buf: bufio.NewWriterSize(w, bufferedWriterSize)}
+}
+
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	return bw.buf.Write(p)
+}
+
+func (bw *bufferedWriter) WriteAt(p []byte, off int64) (int, error) {
+	if err := bw.buf.Flush(); err != nil {
+		return 0, err
+	}
+	return bw.w.WriteAt(p, off)
+}
+
+func (bw *bufferedWriter) Seek(offset int64, whence int) (int64, error) {
+	if err := bw.buf.Flush(); err != nil {
+		return 0, err
+	}
+	return bw.w.Seek(offset, whence)
+}
+
+// Flush writes the buffered bytes to the underlying writer.
+func (bw *bufferedWriter) Flush() error {
+	return bw.buf.Flush()
+}
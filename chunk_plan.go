@@ -0,0 +1,127 @@
+package wav
+
+import (
+	"time"
+
+	"github.com/go-audio/riff"
+)
+
+// ChunkInfo describes a chunk of a wav file.
+type ChunkInfo struct {
+	ID [4]byte
+	// Size is the size of the chunk data, excluding the 8 bytes of the chunk
+	// header and the pad byte of odd sized chunks.
+	Size int64
+}
+
+// PlannedChunks returns the chunks the encoder writes in the RIFF container,
+// in file order, given its current configuration and the audio written so
+// far. It does no I/O. The data chunk size is estimated from the frames
+// written so far, or the ones declared by SetTotalFrames if more, minus the
+// silence trimmed on Close; the overview size follows the same estimate. The
+// JUNK chunk reserved by ReserveDS64 is listed as the ds64 chunk when the
+// estimate requires the RF64 upgrade.
+func (e *Encoder) PlannedChunks() []ChunkInfo {
+	e.lock()
+	defer e.unlock()
+
+	frames := e.frames
+	if e.totalFrames > frames {
+		frames = e.totalFrames
+	}
+	if e.trim != nil && e.trim.end < frames {
+		frames = e.trim.end
+	}
+	return e.plannedChunks(frames)
+}
+
+// EstimateSize returns the size in bytes of the file the encoder writes given
+// its current configuration and the passed duration of audio, headers and
+// metadata included. It does no I/O, see PlannedChunks.
+func (e *Encoder) EstimateSize(duration time.Duration) int64 {
+	e.lock()
+	chunks := e.plannedChunks(FramesForDuration(duration, e.SampleRate))
+	e.unlock()
+	// the RIFF header
+	size := int64(12)
+	for _, c := range chunks {
+		size += 8 + c.Size + c.Size%2
+	}
+	return size
+}
+
+// plannedChunks returns the chunks of a file holding the passed number of
+// frames. It must be called under the lock.
+func (e *Encoder) plannedChunks(frames int) []ChunkInfo {
+	// keep in sync with writeHeader, writeDataChunkHeader and Close
+	var chunks []ChunkInfo
+	headerSize := int64(12)
+	if e.ReserveDS64 {
+		chunks = append(chunks, ChunkInfo{ID: junkID, Size: ds64Size})
+		headerSize += 8 + ds64Size
+	}
+	fmtSize := int64(16)
+	if e.extensible() {
+		fmtSize = 40
+	}
+	chunks = append(chunks, ChunkInfo{ID: riff.FmtID, Size: fmtSize})
+	headerSize += 8 + fmtSize
+	if align := int64(e.dataAlign); align > 1 && (headerSize+8)%align != 0 {
+		chunks = append(chunks, ChunkInfo{ID: junkID, Size: (align - (headerSize+16)%align) % align})
+	}
+
+	dataSize := int64(frames) * int64(e.NumChans*e.BitDepth/8)
+	chunks = append(chunks, ChunkInfo{ID: riff.DataFormatID, Size: dataSize})
+
+	points := e.cuePoints()
+	if len(points) > 0 {
+		chunks = append(chunks, ChunkInfo{ID: CIDCue, Size: int64(len(encodeCueChunk(points)))})
+	}
+	if e.Metadata != nil && e.Metadata.Bext != nil {
+		chunks = append(chunks, ChunkInfo{ID: CIDBext, Size: int64(len(encodeBextChunk(e.Metadata.Bext)))})
+	} else if e.loudness != nil && e.loudness.writeBext {
+		// the chunk holding only the loudness measurements
+		chunks = append(chunks, ChunkInfo{ID: CIDBext, Size: int64(len(encodeBextChunk(&BextChunk{})))})
+	}
+	if iXML := e.iXMLChunk(); iXML != nil {
+		chunks = append(chunks, ChunkInfo{ID: CIDIXML, Size: int64(len(iXML))})
+	}
+	// an INFO list too large is reported by Close
+	if info, err := encodeInfoChunk(e); err == nil && info != nil {
+		chunks = append(chunks, ChunkInfo{ID: CIDList, Size: int64(len(info))})
+	}
+	if adtl := encodeAdtlChunk(points); adtl != nil {
+		chunks = append(chunks, ChunkInfo{ID: CIDList, Size: int64(len(adtl))})
+	}
+	if e.encoderName != "" && e.encoderChunkID != [4]byte{} {
+		chunks = append(chunks, ChunkInfo{ID: e.encoderChunkID, Size: int64(len(e.encoderName) + 1)})
+	}
+	if o := e.overview; o != nil && frames > 0 {
+		blocks := (frames + o.decimation - 1) / o.decimation
+		chunks = append(chunks, ChunkInfo{ID: CIDOvwf, Size: int64(6 + blocks*2*e.NumChans*2)})
+	}
+	if e.displayTitle != "" {
+		chunks = append(chunks, ChunkInfo{ID: CIDDisp, Size: int64(4 + len(e.displayTitle) + 1)})
+	}
+	if resU := e.resUChunk(); resU != nil {
+		chunks = append(chunks, ChunkInfo{ID: CIDResU, Size: int64(len(resU))})
+	}
+	if e.gaplessInfo() != nil {
+		chunks = append(chunks, ChunkInfo{ID: CIDGapl, Size: gaplessChunkSize})
+	}
+	if e.TrailingSizeRecord {
+		chunks = append(chunks, ChunkInfo{ID: CIDFsiz, Size: sizeRecordSize})
+	}
+
+	if e.ReserveDS64 {
+		riffSize := int64(4)
+		for _, c := range chunks {
+			riffSize += 8 + c.Size + c.Size%2
+		}
+		// the reserved chunk becomes the ds64 chunk of the RF64 upgrade
+		if riffSize > maxRIFFSize || dataSize > maxRIFFSize {
+			chunks[0].ID = CIDDs64
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,86 @@
+package wav
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+// fileChunks lists the chunks of an encoded file.
+func fileChunks(b []byte) []ChunkInfo {
+	var chunks []ChunkInfo
+	for pos := 12; pos+8 <= len(b); {
+		var c ChunkInfo
+		copy(c.ID[:], b[pos:pos+4])
+		c.Size = int64(binary.LittleEndian.Uint32(b[pos+4:]))
+		chunks = append(chunks, c)
+		pos += 8 + int(c.Size+c.Size%2)
+	}
+	return chunks
+}
+
+func TestEncoderPlannedChunks(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		numChans  int
+		configure func(e *Encoder)
+	}{
+		{"plain", 2, func(e *Encoder) {}},
+		{"metadata", 1, func(e *Encoder) {
+			e.ReserveDS64 = true
+			e.Metadata = &Metadata{
+				Title:     "title",
+				Bext:      &BextChunk{Description: "description"},
+				CuePoints: []*CuePoint{{ID: [4]byte{1}, Position: 10, Label: "marker"}},
+			}
+			e.SetEncoderName("encoder 1.0", [4]byte{'v', 'n', 'd', 'r'})
+			e.SetDisplayTitle("odd")
+			e.EnableOverview(64)
+		}},
+		{"extensible aligned", 6, func(e *Encoder) {
+			e.AlignDataChunk(512)
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 8000, 16, tc.numChans, FormatPCM)
+			tc.configure(e)
+			buf := &audio.IntBuffer{
+				Format: &audio.Format{NumChannels: tc.numChans, SampleRate: 8000},
+				Data:   make([]int, 1001*tc.numChans),
+			}
+			for i := range buf.Data {
+				buf.Data[i] = i % 100
+			}
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			planned := e.PlannedChunks()
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if written := fileChunks(w.buf); !reflect.DeepEqual(planned, written) {
+				t.Fatalf("expected the planned chunks %v to be written, got %v", planned, written)
+			}
+		})
+	}
+}
+
+func TestEncoderPlannedChunksBeforeWriting(t *testing.T) {
+	e := NewEncoder(&memWriter{}, 48000, 24, 2, FormatPCM)
+	e.SetTotalFrames(48000)
+	exp := []ChunkInfo{{ID: [4]byte{'f', 'm', 't', ' '}, Size: 16}, {ID: [4]byte{'d', 'a', 't', 'a'}, Size: 48000 * 6}}
+	if chunks := e.PlannedChunks(); !reflect.DeepEqual(chunks, exp) {
+		t.Fatalf("expected %v, got %v", exp, chunks)
+	}
+
+	defer func(size int64) { maxRIFFSize = size }(maxRIFFSize)
+	maxRIFFSize = 100
+	e.ReserveDS64 = true
+	if chunks := e.PlannedChunks(); chunks[0].ID != CIDDs64 || chunks[0].Size != ds64Size {
+		t.Fatalf("expected the ds64 chunk first, got %v", chunks)
+	}
+}
@@ -0,0 +1,108 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ChunkWriter is a low level writer to compose RIFF files chunk by chunk.
+// Chunks can be nested (a RIFF or LIST chunk containing sub chunks), their
+// sizes are back-patched when they end and odd sized chunks are padded to stay
+// word aligned. Chunks whose size is known upfront are written sequentially,
+// see BeginSizedChunk. It gives full control over the chunk layout, the
+// Encoder should be preferred to write regular wav files.
+type ChunkWriter struct {
+	w      WriterAtSeeker
+	offset int64
+	// starts holds the offset of the data of each open chunk, the last one
+	// being the innermost chunk, and sizes their size when known upfront, -1
+	// otherwise.
+	starts []int64
+	sizes  []int64
+}
+
+// NewChunkWriter creates a chunk writer writing from the current position of
+// w, which is expected to be the start of the file.
+func NewChunkWriter(w WriterAtSeeker) *ChunkWriter {
+	return &ChunkWriter{w: w}
+}
+
+// Offset returns the number of bytes written so far.
+func (cw *ChunkWriter) Offset() int64 {
+	return cw.offset
+}
+
+// BeginChunk starts a new chunk with the passed ID. The chunk is nested in the
+// currently open chunk if any.
+func (cw *ChunkWriter) BeginChunk(id [4]byte) error {
+	// the size is patched by EndChunk
+	return cw.beginChunk(id, sizePlaceholder, -1)
+}
+
+// BeginSizedChunk starts a new chunk with the passed ID and data size, known
+// upfront. The header is written with the final size so EndChunk doesn't
+// patch it, only checking the amount of data written, which writers that
+// can't seek back, like network streams, require.
+func (cw *ChunkWriter) BeginSizedChunk(id [4]byte, size int64) error {
+	headerSize, err := checkedSize(size, fmt.Sprintf("%s chunk size", id))
+	if err != nil {
+		return err
+	}
+	return cw.beginChunk(id, headerSize, size)
+}
+
+// beginChunk writes the header of a chunk and opens it.
+func (cw *ChunkWriter) beginChunk(id [4]byte, headerSize uint32, size int64) error {
+	header := make([]byte, 8)
+	copy(header, id[:])
+	binary.LittleEndian.PutUint32(header[4:], headerSize)
+	if _, err := cw.Write(header); err != nil {
+		return fmt.Errorf("failed to write the %s chunk header - %w", id, err)
+	}
+	cw.starts = append(cw.starts, cw.offset)
+	cw.sizes = append(cw.sizes, size)
+	return nil
+}
+
+// Write writes data to the currently open chunk.
+func (cw *ChunkWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.offset += int64(n)
+	return n, err
+}
+
+// EndChunk ends the innermost open chunk, patching its size and adding a pad
+// byte if its size is odd. The pad byte isn't included in the chunk size. The
+// size of a chunk started by BeginSizedChunk isn't patched but must match the
+// data written.
+func (cw *ChunkWriter) EndChunk() error {
+	if len(cw.starts) == 0 {
+		return errors.New("no chunk to end")
+	}
+	last := len(cw.starts) - 1
+	start, expected := cw.starts[last], cw.sizes[last]
+	cw.starts, cw.sizes = cw.starts[:last], cw.sizes[:last]
+
+	size := cw.offset - start
+	if expected >= 0 {
+		if size != expected {
+			return fmt.Errorf("%d bytes written to a chunk of %d bytes", size, expected)
+		}
+	} else {
+		if size > int64(sizePlaceholder) {
+			return fmt.Errorf("chunk size %d doesn't fit in 32 bits", size)
+		}
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, uint32(size))
+		if _, err := cw.w.WriteAt(b, start-4); err != nil {
+			return fmt.Errorf("failed to patch the chunk size - %w", err)
+		}
+	}
+	if size%2 == 1 {
+		if _, err := cw.Write([]byte{0}); err != nil {
+			return fmt.Errorf("failed to write the pad byte - %w", err)
+		}
+	}
+	return nil
+}
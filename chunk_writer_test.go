@@ -0,0 +1,124 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/go-audio/riff"
+)
+
+func TestChunkWriter(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	out, err := os.Create("testOutput/chunkwriter.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	le := func(data ...interface{}) []byte {
+		buf := bytes.NewBuffer(nil)
+		for _, v := range data {
+			binary.Write(buf, binary.LittleEndian, v)
+		}
+		return buf.Bytes()
+	}
+
+	cw := NewChunkWriter(out)
+	steps := []func() error{
+		func() error { return cw.BeginChunk(riff.RiffID) },
+		func() error { _, err := cw.Write(riff.WavFormatID[:]); return err },
+		// custom chunk with an odd size before the fmt chunk
+		func() error { return cw.BeginChunk([4]byte{'t', 'e', 's', 't'}) },
+		func() error { _, err := cw.Write([]byte("odd")); return err },
+		cw.EndChunk,
+		func() error { return cw.BeginChunk(riff.FmtID) },
+		func() error {
+			_, err := cw.Write(le(uint16(1), uint16(1), uint32(8000), uint32(16000), uint16(2), uint16(16)))
+			return err
+		},
+		cw.EndChunk,
+		func() error { return cw.BeginChunk(CIDList) },
+		func() error { _, err := cw.Write([]byte("INFO")); return err },
+		func() error { return cw.BeginChunk(markerINAM) },
+		func() error { _, err := cw.Write([]byte("title\x00")); return err },
+		cw.EndChunk,
+		cw.EndChunk,
+		func() error { return cw.BeginChunk(riff.DataFormatID) },
+		func() error { _, err := cw.Write(le(uint16(1), uint16(2), uint16(3))); return err },
+		cw.EndChunk,
+		cw.EndChunk,
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+	if err := cw.EndChunk(); err == nil {
+		t.Fatal("expected an error when ending a chunk that wasn't started")
+	}
+
+	b, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(b)) != cw.Offset() {
+		t.Fatalf("expected %d bytes to be written, got %d", cw.Offset(), len(b))
+	}
+	if size := binary.LittleEndian.Uint32(b[4:]); int(size) != len(b)-8 {
+		t.Fatalf("expected the RIFF size to be %d, got %d", len(b)-8, size)
+	}
+	if size := binary.LittleEndian.Uint32(b[16:]); size != 3 {
+		t.Fatalf("expected the odd chunk size to be 3 (excluding the pad byte), got %d", size)
+	}
+
+	f, err := os.Open(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf.Data) != 3 || buf.Data[0] != 1 || buf.Data[2] != 3 {
+		t.Fatalf("unexpected PCM data %v", buf.Data)
+	}
+	if d.Metadata == nil || d.Metadata.Title != "title" {
+		t.Fatalf("expected the LIST chunk to be decoded, got %#v", d.Metadata)
+	}
+}
+
+func TestChunkWriterSizedChunk(t *testing.T) {
+	w := &appendOnlyWriter{}
+	cw := NewChunkWriter(w)
+	if err := cw.BeginSizedChunk([4]byte{'t', 'e', 's', 't'}, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cw.Write([]byte("odd")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.EndChunk(); err != nil {
+		t.Fatal(err)
+	}
+	if exp := "test\x03\x00\x00\x00odd\x00"; string(w.buf) != exp {
+		t.Fatalf("expected %q, got %q", exp, w.buf)
+	}
+	if cw.Offset() != 12 {
+		t.Fatalf("expected an offset of 12 bytes, got %d", cw.Offset())
+	}
+
+	if err := cw.BeginSizedChunk([4]byte{'s', 'h', 'r', 't'}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cw.Write([]byte("ab")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.EndChunk(); err == nil {
+		t.Fatal("expected an error when the data doesn't match the chunk size")
+	}
+}
@@ -23,7 +23,7 @@ func main() {
 	defer f.Close()
 
 	const sampleRate = 48000
-	wavOut := wav.NewEncoder(f, sampleRate, 16, 1, 1)
+	wavOut := wav.NewEncoder(f, sampleRate, 16, 1, wav.FormatPCM)
 	numSamples := int(sampleRate * *length)
 	defer wavOut.Close()
 
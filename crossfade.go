@@ -0,0 +1,111 @@
+package wav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/go-audio/audio"
+)
+
+// AppendWithCrossfade appends the passed buffer like Write, mixing its first
+// fade worth of frames with the last frames already written using a linear
+// crossfade, so recordings can be concatenated without a click at the join.
+// The overlapping frames are overwritten in place: the file grows by the
+// length of the buffer minus the fade. The fade is shortened to the frames
+// available on both sides.
+//
+// The written frames are read back from the underlying writer, which must
+// implement io.ReaderAt (like *os.File does). When it doesn't, for formats
+// other than FormatPCM and with InputBigEndian, the buffer is appended
+// without a crossfade.
+func (e *Encoder) AppendWithCrossfade(buf *audio.IntBuffer, fade time.Duration) error {
+	if buf == nil {
+		return fmt.Errorf("can't add a nil buffer")
+	}
+	if buf.Format == nil || buf.Format.NumChannels != e.NumChans || len(buf.Data)%e.NumChans != 0 {
+		return fmt.Errorf("the buffer doesn't contain whole frames of %d channels", e.NumChans)
+	}
+	if fade < 0 {
+		return fmt.Errorf("invalid fade duration %s", fade)
+	}
+	if err := e.writeSetup(); err != nil {
+		return err
+	}
+	r, ok := e.underlying().(io.ReaderAt)
+	// byte swapped samples can't be mixed
+	if !ok || e.WavAudioFormat != FormatPCM || e.InputBigEndian {
+		return e.Write(buf)
+	}
+
+	e.lock()
+	frames := e.frames
+	e.unlock()
+	n := FramesForDuration(fade, e.SampleRate)
+	if n > frames {
+		n = frames
+	}
+	if n > buf.NumFrames() {
+		n = buf.NumFrames()
+	}
+	if n == 0 {
+		return e.Write(buf)
+	}
+
+	tail, err := e.readFrames(r, frames-n, n)
+	if err != nil {
+		return err
+	}
+	mixed := make([]int, n*e.NumChans)
+	for i := 0; i < n; i++ {
+		// the gain of the new buffer ramps up excluding 0 and 1 so both
+		// sides contribute to every overlapping frame
+		g := float64(i+1) / float64(n+1)
+		for c := 0; c < e.NumChans; c++ {
+			j := i*e.NumChans + c
+			mixed[j] = int(math.Round(float64(tail[j])*(1-g) + float64(buf.Data[j])*g))
+		}
+	}
+	join := &audio.IntBuffer{Format: buf.Format, Data: mixed, SourceBitDepth: buf.SourceBitDepth}
+	if _, err := e.WriteAtFrame(join, int64(frames-n)); err != nil {
+		return err
+	}
+	if n == buf.NumFrames() {
+		return nil
+	}
+	return e.Write(&audio.IntBuffer{Format: buf.Format, Data: buf.Data[n*e.NumChans:], SourceBitDepth: buf.SourceBitDepth})
+}
+
+// readFrames reads back count written frames starting at the passed frame,
+// in the domain of the buffers passed to Write.
+func (e *Encoder) readFrames(r io.ReaderAt, frame, count int) ([]int, error) {
+	e.lock()
+	err := e.flush()
+	e.unlock()
+	if err != nil {
+		return nil, err
+	}
+	decode, err := sampleDecodeFunc(e.BitDepth)
+	if err != nil {
+		return nil, err
+	}
+	frameSize := e.NumChans * e.BitDepth / 8
+	raw := make([]byte, count*frameSize)
+	if _, err := r.ReadAt(raw, e.pcmChunkPos+int64(frame*frameSize)); err != nil {
+		return nil, fmt.Errorf("failed to read back the written frames - %w", err)
+	}
+	samples := make([]int, count*e.NumChans)
+	shift := e.sampleShift()
+	rd := bytes.NewReader(raw)
+	scratch := make([]byte, 4)
+	for i := range samples {
+		v, err := decode(rd, scratch)
+		if err != nil {
+			return nil, err
+		}
+		samples[i] = v >> shift
+	}
+	return samples, nil
+}
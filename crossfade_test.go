@@ -0,0 +1,93 @@
+package wav
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
+)
+
+// readableWriter is a memWriter which can be read back.
+type readableWriter struct {
+	memWriter
+}
+
+func (w *readableWriter) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(w.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(p, w.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestEncoderAppendWithCrossfade(t *testing.T) {
+	constant := func(v, frames int) *audio.IntBuffer {
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 1000}, Data: make([]int, frames*2)}
+		for i := range buf.Data {
+			buf.Data[i] = v
+		}
+		return buf
+	}
+	testCases := []struct {
+		desc     string
+		w        WriterAtSeeker
+		bitDepth int
+		fade     time.Duration
+		// frames is the expected number of frames, maxStep the largest
+		// expected difference between consecutive samples of a channel.
+		frames  int
+		maxStep int
+	}{
+		{"16 bit", &readableWriter{}, 16, 50 * time.Millisecond, 150, 2000 / 51},
+		{"24 bit", &readableWriter{}, 24, 10 * time.Millisecond, 190, 2000 / 11},
+		{"fade longer than the audio", &readableWriter{}, 16, time.Second, 100, 2000 / 101},
+		{"no fade", &readableWriter{}, 16, 0, 200, 2000},
+		{"not readable", &memWriter{}, 16, 50 * time.Millisecond, 200, 2000},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			e := NewEncoder(tc.w, 1000, tc.bitDepth, 2, FormatPCM)
+			e.BufferWrites = true
+			if err := e.Write(constant(1000, 100)); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.AppendWithCrossfade(constant(-1000, 100), tc.fade); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			var b []byte
+			switch w := tc.w.(type) {
+			case *readableWriter:
+				b = w.buf
+			case *memWriter:
+				b = w.buf
+			}
+			d := NewDecoder(bytes.NewReader(b))
+			out, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frames := out.NumFrames(); frames != tc.frames {
+				t.Fatalf("expected %d frames, got %d", tc.frames, frames)
+			}
+			// when the whole audio overlaps every frame is mixed
+			if tc.frames > 100 && (out.Data[0] != 1000 || out.Data[len(out.Data)-1] != -1000) {
+				t.Fatalf("expected the recordings to be kept outside of the fade, got %d and %d", out.Data[0], out.Data[len(out.Data)-1])
+			}
+			for i := 2; i < len(out.Data); i++ {
+				step := out.Data[i-2] - out.Data[i]
+				if step < 0 || step > tc.maxStep+1 {
+					t.Fatalf("expected a step of at most %d at sample %d, got %d", tc.maxStep, i, step)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"time"
 
 	"github.com/go-audio/riff"
 )
@@ -47,6 +48,22 @@ type CuePoint struct {
 	// (may or may not be bytes) from the Block Start to the sample that
 	// corresponds to the cue point.
 	SampleOffset uint32
+	// Label is the text associated with the cue point, stored in a labl
+	// chunk of the adtl LIST chunk.
+	Label string
+}
+
+// NewCuePointAt returns a cue point with the passed ID marking the frame
+// played at the passed time in the data chunk.
+func NewCuePointAt(id uint32, at time.Duration, sampleRate int) *CuePoint {
+	frame := uint32(FramesForDuration(at, sampleRate))
+	c := &CuePoint{
+		Position:     frame,
+		DataChunkID:  riff.DataFormatID,
+		SampleOffset: frame,
+	}
+	binary.LittleEndian.PutUint32(c.ID[:], id)
+	return c
 }
 
 // DecodeCueChunk decodes the optional cue chunk and extracts cue points.
@@ -97,6 +114,7 @@ func DecodeCueChunk(d *Decoder, ch *riff.Chunk) error {
 				if err := binary.Read(r, binary.LittleEndian, &c.SampleOffset); err != nil {
 					return err
 				}
+				c.Label = d.cueLabels[c.ID]
 				d.Metadata.CuePoints = append(d.Metadata.CuePoints, c)
 			}
 		}
@@ -104,3 +122,18 @@ func DecodeCueChunk(d *Decoder, ch *riff.Chunk) error {
 	}
 	return nil
 }
+
+// encodeCueChunk serializes the cue points in the format of a cue chunk.
+func encodeCueChunk(points []*CuePoint) []byte {
+	buf := bytes.NewBuffer(nil)
+	binary.Write(buf, binary.LittleEndian, uint32(len(points)))
+	for _, c := range points {
+		buf.Write(c.ID[:])
+		binary.Write(buf, binary.LittleEndian, c.Position)
+		buf.Write(c.DataChunkID[:])
+		binary.Write(buf, binary.LittleEndian, c.ChunkStart)
+		binary.Write(buf, binary.LittleEndian, c.BlockStart)
+		binary.Write(buf, binary.LittleEndian, c.SampleOffset)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,95 @@
+package wav
+
+import (
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+// dcBlockerCutoff is the cutoff frequency in Hz of the DC blocker, low enough
+// to leave the audible range untouched.
+const dcBlockerCutoff = 5
+
+// dcBlocker is a first order high-pass filter removing the DC offset of each
+// channel: y[n] = x[n] - x[n-1] + r * y[n-1].
+type dcBlocker struct {
+	r float64
+	// x and y hold the last input and output of each channel.
+	x, y []float64
+}
+
+func newDCBlocker(sampleRate int) *dcBlocker {
+	return &dcBlocker{r: math.Exp(-2 * math.Pi * dcBlockerCutoff / float64(sampleRate))}
+}
+
+// process filters the passed sample of channel c.
+func (d *dcBlocker) process(v float64, c int) float64 {
+	for len(d.x) <= c {
+		d.x = append(d.x, 0)
+		d.y = append(d.y, 0)
+	}
+	y := v - d.x[c] + d.r*d.y[c]
+	d.x[c], d.y[c] = v, y
+	return y
+}
+
+// EnableDCBlocker makes the encoder remove the DC offset of the audio, as
+// introduced by some cheap converters, with a first order high-pass filter at
+// 5Hz applied to each channel. The filter state carries across buffers. The
+// audio written by Write, WriteFloat and WriteFloatPlanar is filtered, the
+// one written by WriteAt, WriteFrame, WriteFrames, WriteRing and WriteRaw
+// isn't. It must be called before writing.
+func (e *Encoder) EnableDCBlocker() {
+	if e.SampleRate <= 0 {
+		return
+	}
+	e.dcBlocker = newDCBlocker(e.SampleRate)
+}
+
+// blockDC returns a filtered copy of the passed buffer, 8 bit samples being
+// filtered around their 128 center.
+func (e *Encoder) blockDC(buf *audio.IntBuffer) *audio.IntBuffer {
+	numChans := e.NumChans
+	if buf.Format != nil {
+		numChans = buf.Format.NumChannels
+	}
+	if numChans < 1 {
+		return buf
+	}
+	center := 0.0
+	if e.BitDepth == 8 {
+		center = 128
+	}
+	out := &audio.IntBuffer{Format: buf.Format, Data: make([]int, len(buf.Data)), SourceBitDepth: buf.SourceBitDepth}
+	e.lock()
+	for i, v := range buf.Data {
+		out.Data[i] = int(math.Round(e.dcBlocker.process(float64(v)-center, i%numChans) + center))
+	}
+	e.unlock()
+	return out
+}
+
+// blockDCFloat returns a filtered copy of the passed float samples.
+func (e *Encoder) blockDCFloat(data []float64, numChans int) []float64 {
+	out := make([]float64, len(data))
+	e.lock()
+	for i, v := range data {
+		out[i] = e.dcBlocker.process(finite(v), i%numChans)
+	}
+	e.unlock()
+	return out
+}
+
+// blockDCPlanar returns filtered copies of the passed channels.
+func (e *Encoder) blockDCPlanar(channels [][]float64) [][]float64 {
+	out := make([][]float64, len(channels))
+	e.lock()
+	for c, ch := range channels {
+		out[c] = make([]float64, len(ch))
+		for i, v := range ch {
+			out[c][i] = e.dcBlocker.process(finite(v), c)
+		}
+	}
+	e.unlock()
+	return out
+}
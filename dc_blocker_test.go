@@ -0,0 +1,96 @@
+package wav
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderDCBlocker(t *testing.T) {
+	const (
+		sampleRate = 48000
+		numChans   = 2
+		seconds    = 2
+	)
+	testCases := []struct {
+		desc     string
+		bitDepth int
+		// full is the full scale of the bit depth, center its silence.
+		full, center float64
+		write        func(e *Encoder, data []float64) error
+	}{
+		{"16 bit", 16, 32768, 0, func(e *Encoder, data []float64) error {
+			buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: numChans, SampleRate: sampleRate}, Data: make([]int, len(data))}
+			for i, v := range data {
+				buf.Data[i] = int(math.Round(v * 32768))
+			}
+			return e.Write(buf)
+		}},
+		{"8 bit", 8, 128, 128, func(e *Encoder, data []float64) error {
+			buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: numChans, SampleRate: sampleRate}, Data: make([]int, len(data))}
+			for i, v := range data {
+				buf.Data[i] = int(math.Round(v*128)) + 128
+			}
+			return e.Write(buf)
+		}},
+		{"float", 24, 1 << 23, 0, func(e *Encoder, data []float64) error {
+			return e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: numChans, SampleRate: sampleRate}, Data: data})
+		}},
+		{"planar", 24, 1 << 23, 0, func(e *Encoder, data []float64) error {
+			channels := make([][]float64, numChans)
+			for i, v := range data {
+				channels[i%numChans] = append(channels[i%numChans], v)
+			}
+			return e.WriteFloatPlanar(channels)
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, sampleRate, tc.bitDepth, numChans, FormatPCM)
+			e.EnableDCBlocker()
+			// a 440Hz sine at half scale with a DC offset of 0.25, and 0.2 on
+			// the second channel, written in buffers of 100ms
+			frames := sampleRate / 10
+			for n := 0; n < seconds*10; n++ {
+				data := make([]float64, frames*numChans)
+				for i := 0; i < frames; i++ {
+					s := 0.5 * math.Sin(2*math.Pi*440*float64(n*frames+i)/sampleRate)
+					data[i*numChans] = s + 0.25
+					data[i*numChans+1] = s - 0.2
+				}
+				if err := tc.write(e, data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			buf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the last second, once the filter settled
+			last := buf.Data[len(buf.Data)-sampleRate*numChans:]
+			for c := 0; c < numChans; c++ {
+				var sum, sq float64
+				for i := c; i < len(last); i += numChans {
+					v := (float64(last[i]) - tc.center) / tc.full
+					sum += v
+					sq += v * v
+				}
+				mean := sum / sampleRate
+				if math.Abs(mean) > 0.002 {
+					t.Errorf("expected the mean of channel %d to be removed, got %.4f", c, mean)
+				}
+				// the sine is kept, its RMS being 0.5/sqrt(2)
+				if rms := math.Sqrt(sq / sampleRate); math.Abs(rms-0.5/math.Sqrt2) > 0.005 {
+					t.Errorf("expected the sine of channel %d to be kept, got an RMS of %.4f", c, rms)
+				}
+			}
+		})
+	}
+}
@@ -20,8 +20,34 @@ var (
 	CIDSmpl = [4]byte{'s', 'm', 'p', 'l'}
 	// CIDINFO is the chunk ID for an INFO chunk
 	CIDInfo = []byte{'I', 'N', 'F', 'O'}
+	// CIDAdtl is the chunk ID for an adtl (associated data list) chunk
+	CIDAdtl = []byte{'a', 'd', 't', 'l'}
 	// CIDCue is the chunk ID for the cue chunk
 	CIDCue = [4]byte{'c', 'u', 'e', 0x20}
+	// CIDDisp is the chunk ID for the DISP chunk
+	CIDDisp = [4]byte{'D', 'I', 'S', 'P'}
+	// CIDDs64 is the chunk ID for the ds64 chunk of RF64 files
+	CIDDs64 = [4]byte{'d', 's', '6', '4'}
+	// CIDBext is the chunk ID for the bext chunk of Broadcast Wave Format files
+	CIDBext = [4]byte{'b', 'e', 'x', 't'}
+	// CIDOvwf is the chunk ID for the waveform overview chunk, see
+	// Encoder.EnableOverview
+	CIDOvwf = [4]byte{'o', 'v', 'w', 'f'}
+	// CIDFact is the chunk ID for the fact chunk holding the number of frames
+	// of compressed formats
+	CIDFact = [4]byte{'f', 'a', 'c', 't'}
+	// CIDIXML is the chunk ID for the iXML chunk holding the production
+	// metadata of field recorders, see Encoder.SetIXML
+	CIDIXML = [4]byte{'i', 'X', 'M', 'L'}
+	// CIDResU is the chunk ID for the ResU chunk holding the JSON metadata of
+	// iZotope RX, see Encoder.SetResU
+	CIDResU = [4]byte{'R', 'e', 's', 'U'}
+	// CIDGapl is the chunk ID for the gapless playback chunk, see
+	// Encoder.SetGaplessInfo
+	CIDGapl = [4]byte{'g', 'a', 'p', 'l'}
+	// CIDFsiz is the chunk ID for the trailing size record, see
+	// Encoder.TrailingSizeRecord
+	CIDFsiz = [4]byte{'f', 's', 'i', 'z'}
 )
 
 // Decoder handles the decoding of wav files.
@@ -43,6 +69,8 @@ type Decoder struct {
 	PCMChunk *riff.Chunk
 	// Metadata for the current file
 	Metadata *Metadata
+	// cueLabels holds the labels of the adtl list found before the cue chunk.
+	cueLabels map[[4]byte]string
 }
 
 // NewDecoder creates a decoder for the passed wav reader.
@@ -181,6 +209,30 @@ func (d *Decoder) ReadMetadata() {
 					d.err = err
 				}
 			}
+		case CIDBext:
+			if err = DecodeBextChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDIXML:
+			if err = DecodeIXMLChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDResU:
+			if err = DecodeResUChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
+		case CIDGapl:
+			if err = DecodeGaplessChunk(d, chunk); err != nil {
+				if !errors.Is(err, io.EOF) {
+					d.err = err
+				}
+			}
 		default:
 			// fmt.Println(string(chunk.ID[:]))
 			chunk.Drain()
@@ -385,7 +437,16 @@ func (d *Decoder) NextChunk() (*riff.Chunk, error) {
 	// all RIFF chunks (including WAVE "data" chunks) must be word aligned.
 	// If the data uses an odd number of bytes, a padding byte with a value of zero must be placed at the end of the sample data.
 	// The "data" chunk header's size should not include this byte.
-	if size%2 == 1 {
+	// The streaming size placeholder isn't padded so it doesn't wrap to 0.
+	if size%2 == 1 && size != sizePlaceholder {
+		if id == riff.DataFormatID {
+			// the pad byte isn't audio, it's skipped once the samples are read
+			return &riff.Chunk{
+				ID:   id,
+				Size: int(size),
+				R:    &unpaddedReader{r: d.r, n: int64(size)},
+			}, d.err
+		}
 		size++
 	}
 
@@ -397,12 +458,113 @@ func (d *Decoder) NextChunk() (*riff.Chunk, error) {
 	return c, d.err
 }
 
-// Duration returns the time duration for the current audio container
+// unpaddedReader reads the n bytes of an odd sized chunk and discards the pad
+// byte following them, so the next chunk is read from its header.
+type unpaddedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (u *unpaddedReader) Read(p []byte) (int, error) {
+	if u.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > u.n {
+		p = p[:u.n]
+	}
+	n, err := u.r.Read(p)
+	u.n -= int64(n)
+	if u.n == 0 && err == nil {
+		// files missing the pad byte end right after the chunk
+		var pad [1]byte
+		if _, pErr := io.ReadFull(u.r, pad[:]); pErr != nil && pErr != io.EOF {
+			err = pErr
+		}
+	}
+	return n, err
+}
+
+// Duration returns the playback duration of the audio, computed from the
+// size of the data chunk and the fmt chunk without reading the samples, so it
+// is cheap even for large files. The position of the reader is restored. The
+// data chunk of streamed files, or of recordings not finalized yet, has no
+// final size: the duration is then estimated from the bytes following the
+// data chunk header, which includes the trailing metadata chunks if any.
 func (d *Decoder) Duration() (time.Duration, error) {
 	if d == nil || d.parser == nil {
 		return 0, errors.New("can't calculate the duration of a nil pointer")
 	}
-	return d.parser.Duration()
+	if err := d.readHeaders(); err != nil {
+		return 0, err
+	}
+	if d.SampleRate == 0 || d.NumChans == 0 {
+		return 0, errors.New("can't calculate the duration without a fmt chunk")
+	}
+	size, err := d.dataChunkSize()
+	if err != nil {
+		return 0, err
+	}
+	switch d.WavAudioFormat {
+	case FormatPCM, FormatIEEEFloat, FormatExtensible:
+		blockAlign := int64(d.parser.BlockAlign)
+		if blockAlign == 0 {
+			blockAlign = int64(d.NumChans) * int64(bytesPerSample(int(d.BitDepth)))
+		}
+		if blockAlign == 0 {
+			return 0, fmt.Errorf("invalid block align for %d bit samples", d.BitDepth)
+		}
+		return DurationForFrames(int(size/blockAlign), int(d.SampleRate)), nil
+	}
+	// compressed formats are measured by their byte rate
+	if d.AvgBytesPerSec == 0 {
+		return 0, fmt.Errorf("can't calculate the duration of audio format %d without a byte rate", d.WavAudioFormat)
+	}
+	return time.Duration(float64(size) / float64(d.AvgBytesPerSec) * float64(time.Second)), nil
+}
+
+// dataChunkSize returns the size of the data chunk, found by seeking over
+// the chunk headers, or estimated from the end of the file when its size
+// isn't final. The position of the reader is restored.
+func (d *Decoder) dataChunkSize() (int64, error) {
+	if d.PCMChunk != nil && uint32(d.PCMSize) != StreamingDataSize {
+		return int64(d.PCMSize), nil
+	}
+	pos, err := d.r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	defer d.r.Seek(pos, io.SeekStart)
+
+	end, err := d.r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	// skip the RIFF header
+	offset := int64(12)
+	for {
+		if _, err := d.r.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(d.r, binary.LittleEndian, &chunk); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return 0, ErrPCMChunkNotFound
+			}
+			return 0, err
+		}
+		offset += 8
+		if chunk.ID == riff.DataFormatID {
+			size := int64(chunk.Size)
+			if remaining := end - offset; chunk.Size == StreamingDataSize || size > remaining {
+				size = remaining
+			}
+			return size, nil
+		}
+		offset += int64(chunk.Size) + int64(chunk.Size%2)
+	}
 }
 
 // String implements the Stringer interface.
@@ -1,6 +1,7 @@
 package wav
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -65,7 +66,14 @@ func TestDecoder_Duration(t *testing.T) {
 		in       string
 		duration time.Duration
 	}{
-		{"fixtures/kick.wav", time.Duration(204172335 * time.Nanosecond)},
+		{"fixtures/kick.wav", 203356010 * time.Nanosecond},
+		{"fixtures/8bit.wav", 2 * time.Second},
+		{"fixtures/32bit.wav", 2 * time.Second},
+		// metadata chunks after the data
+		{"fixtures/listinfo.wav", 2 * time.Second},
+		{"fixtures/flloop.wav", 2455351474 * time.Nanosecond},
+		// a bext chunk before the data
+		{"fixtures/bwf.wav", 165238096 * time.Nanosecond},
 	}
 
 	for _, tc := range testCases {
@@ -81,10 +89,52 @@ func TestDecoder_Duration(t *testing.T) {
 			t.Fatal(err)
 		}
 		if dur != tc.duration {
-			t.Fatalf("expected duration to be: %s but was %s", tc.duration, dur)
+			t.Fatalf("%s: expected duration to be: %s but was %s", tc.in, tc.duration, dur)
 		}
 	}
 
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: make([]int, 2*4800)}
+	for i := range buf.Data {
+		buf.Data[i] = i % 100
+	}
+	// a streamed file doesn't have a final data chunk size
+	var streamed bytes.Buffer
+	se := NewStreamEncoder(&streamed, 48000, 16, 2, FormatPCM)
+	if err := se.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := se.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(streamed.Bytes()))
+	dur, err := d.Duration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dur != 100*time.Millisecond {
+		t.Fatalf("expected the duration of the streamed file to be estimated to 100ms, got %s", dur)
+	}
+	// the samples can still be read
+	decoded, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Data, buf.Data) {
+		t.Fatal("expected the samples to be decoded after computing the duration")
+	}
+
+	w := &memWriter{}
+	e := NewEncoder(w, 48000, 16, 2, FormatPCM)
+	if err := e.Write(&audio.IntBuffer{Format: buf.Format}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// drop the data chunk
+	if _, err := NewDecoder(bytes.NewReader(w.buf[:36])).Duration(); err == nil {
+		t.Fatal("expected a file without a data chunk to be refused")
+	}
 }
 
 func TestDecoder_IsValidFile(t *testing.T) {
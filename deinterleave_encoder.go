@@ -0,0 +1,118 @@
+package wav
+
+import (
+	"fmt"
+
+	"github.com/go-audio/audio"
+)
+
+// DeinterleaveEncoder writes each channel of interleaved buffers to its own
+// mono wav file, for instance to deliver the stems of a surround mix. Each
+// output is an independently valid file.
+type DeinterleaveEncoder struct {
+	encoders []*Encoder
+	// ints and floats hold the samples of the channel being written.
+	ints   []int
+	floats []float64
+}
+
+// NewDeinterleaveEncoder creates an encoder writing channel i of the input to
+// writers[i], the number of writers being the number of input channels.
+func NewDeinterleaveEncoder(writers []WriterAtSeeker, sampleRate, bitDepth, audioFormat int) *DeinterleaveEncoder {
+	d := &DeinterleaveEncoder{}
+	for _, w := range writers {
+		d.encoders = append(d.encoders, NewEncoder(w, sampleRate, bitDepth, 1, audioFormat))
+	}
+	return d
+}
+
+// Encoder returns the mono encoder writing the passed channel, to set its
+// options and metadata before writing.
+func (d *DeinterleaveEncoder) Encoder(channel int) *Encoder {
+	return d.encoders[channel]
+}
+
+// NumChans returns the number of channels of the input, one per output.
+func (d *DeinterleaveEncoder) NumChans() int {
+	return len(d.encoders)
+}
+
+// Write splits the passed interleaved buffer and writes each channel to its
+// file, see Encoder.Write.
+func (d *DeinterleaveEncoder) Write(buf *audio.IntBuffer) error {
+	if buf == nil {
+		return fmt.Errorf("can't add a nil buffer")
+	}
+	frames, err := d.frames(buf.Format, len(buf.Data))
+	if err != nil {
+		return err
+	}
+	numChans := len(d.encoders)
+	for c, e := range d.encoders {
+		d.ints = d.ints[:0]
+		for i := 0; i < frames; i++ {
+			d.ints = append(d.ints, buf.Data[i*numChans+c])
+		}
+		mono := &audio.IntBuffer{
+			Format:         &audio.Format{NumChannels: 1, SampleRate: e.SampleRate},
+			Data:           d.ints,
+			SourceBitDepth: buf.SourceBitDepth,
+		}
+		if err := e.Write(mono); err != nil {
+			return fmt.Errorf("failed to write channel %d - %w", c, err)
+		}
+	}
+	return nil
+}
+
+// WriteFloat splits the passed interleaved float buffer and writes each
+// channel to its file, see Encoder.WriteFloat.
+func (d *DeinterleaveEncoder) WriteFloat(buf *audio.FloatBuffer) error {
+	if buf == nil {
+		return fmt.Errorf("can't add a nil buffer")
+	}
+	frames, err := d.frames(buf.Format, len(buf.Data))
+	if err != nil {
+		return err
+	}
+	numChans := len(d.encoders)
+	for c, e := range d.encoders {
+		d.floats = d.floats[:0]
+		for i := 0; i < frames; i++ {
+			d.floats = append(d.floats, buf.Data[i*numChans+c])
+		}
+		mono := &audio.FloatBuffer{
+			Format: &audio.Format{NumChannels: 1, SampleRate: e.SampleRate},
+			Data:   d.floats,
+		}
+		if err := e.WriteFloat(mono); err != nil {
+			return fmt.Errorf("failed to write channel %d - %w", c, err)
+		}
+	}
+	return nil
+}
+
+// frames validates the format of an input buffer against the outputs and
+// returns its number of whole frames.
+func (d *DeinterleaveEncoder) frames(format *audio.Format, samples int) (int, error) {
+	numChans := len(d.encoders)
+	if numChans == 0 {
+		return 0, fmt.Errorf("no output to write to")
+	}
+	if format != nil && format.NumChannels != numChans {
+		return 0, fmt.Errorf("expected %d channels, got %d", numChans, format.NumChannels)
+	}
+	return samples / numChans, nil
+}
+
+// Close finalizes every file, see Encoder.Close. All the files are closed
+// even if one fails, the first error is returned.
+func (d *DeinterleaveEncoder) Close() error {
+	var firstErr error
+	for c, e := range d.encoders {
+		if err := e.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to close channel %d - %w", c, err)
+		}
+	}
+	return firstErr
+}
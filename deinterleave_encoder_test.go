@@ -0,0 +1,58 @@
+package wav
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestDeinterleaveEncoder(t *testing.T) {
+	left, right := &memWriter{}, &memWriter{}
+	d := NewDeinterleaveEncoder([]WriterAtSeeker{left, right}, 44100, 16, FormatPCM)
+	d.Encoder(1).Metadata = &Metadata{Title: "right"}
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	if err := d.Write(&audio.IntBuffer{Format: format, Data: []int{1, -1, 2, -2, 3, -3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteFloat(&audio.FloatBuffer{Format: format, Data: []float64{0.5, -0.5}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 3, SampleRate: 44100}, Data: []int{1, 2, 3}}); err == nil {
+		t.Fatal("expected a buffer with another number of channels to be refused")
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tc := range []struct {
+		w     *memWriter
+		exp   []int
+		title string
+	}{
+		{left, []int{1, 2, 3, 16384}, ""},
+		{right, []int{-1, -2, -3, -16384}, "right"},
+	} {
+		dec := NewDecoder(bytes.NewReader(tc.w.buf))
+		buf, err := dec.FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dec.NumChans != 1 || dec.SampleRate != 44100 || dec.BitDepth != 16 {
+			t.Fatalf("expected output %d to be 16 bit mono at 44.1kHz, got %d channels, %d Hz, %d bits", i, dec.NumChans, dec.SampleRate, dec.BitDepth)
+		}
+		if !reflect.DeepEqual(buf.Data, tc.exp) {
+			t.Fatalf("expected output %d to hold %v, got %v", i, tc.exp, buf.Data)
+		}
+		dec = NewDecoder(bytes.NewReader(tc.w.buf))
+		dec.ReadMetadata()
+		var title string
+		if dec.Metadata != nil {
+			title = dec.Metadata.Title
+		}
+		if title != tc.title {
+			t.Fatalf("expected output %d to be titled %q, got %q", i, tc.title, title)
+		}
+	}
+}
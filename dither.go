@@ -0,0 +1,58 @@
+package wav
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// ditherSource is a xorshift64* generator: it is fast, and unlike math/rand
+// its sequence for a given seed is guaranteed never to change, so dithered
+// files stay reproducible across Go versions.
+type ditherSource struct {
+	state uint64
+}
+
+func newDitherSource(seed int64) *ditherSource {
+	// scramble the seed so close seeds don't start with correlated values,
+	// the state must not be 0
+	s := uint64(seed)*0x9E3779B97F4A7C15 ^ 0xD1B54A32D192ED03
+	if s == 0 {
+		s = 1
+	}
+	return &ditherSource{state: s}
+}
+
+// float returns a uniformly distributed value in [0, 1).
+func (d *ditherSource) float() float64 {
+	d.state ^= d.state >> 12
+	d.state ^= d.state << 25
+	d.state ^= d.state >> 27
+	return float64((d.state*0x2545F4914F6CDD1D)>>11) / (1 << 53)
+}
+
+// tpdf returns triangular probability density noise in (-1, 1).
+func (d *ditherSource) tpdf() float64 {
+	return d.float() - d.float()
+}
+
+// SetDitherSeed sets the seed of the noise added by Dither and restarts its
+// sequence. The dither is deterministic: the same seed and samples always
+// produce the same file, which makes tests reproducible. The seed is 0 by
+// default, pass RandomDitherSeed() to get uncorrelated noise across a batch of
+// files.
+func (e *Encoder) SetDitherSeed(seed int64) {
+	e.lock()
+	defer e.unlock()
+	e.ditherSeed = seed
+	e.dither = nil
+}
+
+// RandomDitherSeed returns a random seed for SetDitherSeed.
+func RandomDitherSeed() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
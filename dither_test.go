@@ -0,0 +1,90 @@
+package wav
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderDitherSeed(t *testing.T) {
+	data := sine(8000, 2, 0.5, -40)
+	encode := func(seed int64, dither bool) []byte {
+		w := &memWriter{}
+		e := NewEncoder(w, 8000, 16, 2, FormatPCM)
+		e.Dither = dither
+		e.SetDitherSeed(seed)
+		if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return w.buf
+	}
+
+	if !bytes.Equal(encode(42, true), encode(42, true)) {
+		t.Fatal("expected identical seeds to produce identical files")
+	}
+	if bytes.Equal(encode(42, true), encode(43, true)) {
+		t.Fatal("expected different seeds to produce different files")
+	}
+	if !bytes.Equal(encode(42, false), encode(43, false)) {
+		t.Fatal("expected the seed to be ignored without dither")
+	}
+
+	// the TPDF noise moves the samples by 1 LSB at most
+	plain, dithered := encode(0, false)[44:], encode(0, true)[44:]
+	var changed int
+	for i := 0; i+1 < len(plain); i += 2 {
+		diff := int(int16(le16(dithered[i:]))) - int(int16(le16(plain[i:])))
+		if diff < -1 || diff > 1 {
+			t.Fatalf("sample %d moved by %d LSB", i/2, diff)
+		}
+		if diff != 0 {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Fatal("expected the dither to change some samples")
+	}
+}
+
+func TestEncoderDitherSeedRestart(t *testing.T) {
+	buf := &audio.FloatBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: make([]float64, 100)}
+	for i := range buf.Data {
+		buf.Data[i] = math.Sin(float64(i)) / 100
+	}
+	w := &memWriter{}
+	e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+	e.Dither = true
+	e.SetDitherSeed(7)
+	if err := e.WriteFloat(buf); err != nil {
+		t.Fatal(err)
+	}
+	// setting the seed again restarts the sequence, and clones start from
+	// the seed
+	e.SetDitherSeed(7)
+	if err := e.WriteFloat(buf); err != nil {
+		t.Fatal(err)
+	}
+	cw := &memWriter{}
+	c := e.Clone(cw)
+	if err := c.WriteFloat(buf); err != nil {
+		t.Fatal(err)
+	}
+	first, second := w.buf[44:244], w.buf[244:444]
+	if !bytes.Equal(first, second) {
+		t.Fatal("expected SetDitherSeed to restart the dither sequence")
+	}
+	if !bytes.Equal(first, cw.buf[44:244]) {
+		t.Fatal("expected the clone to use the same seed")
+	}
+}
+
+func TestRandomDitherSeed(t *testing.T) {
+	if RandomDitherSeed() == RandomDitherSeed() {
+		t.Fatal("expected different random seeds")
+	}
+}
@@ -2,11 +2,14 @@ package wav
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"runtime"
 	"sync"
 	"time"
 
@@ -14,6 +17,41 @@ import (
 	"github.com/go-audio/riff"
 )
 
+// sizePlaceholder is the temporary RIFF and data chunk size written until the
+// real sizes are patched on Close. If Close never runs (e.g. the process
+// crashed), the file claims the maximum size which most readers interpret as
+// "read until EOF" so the written audio can still be recovered.
+const sizePlaceholder = uint32(0xFFFFFFFF)
+
+// ds64Size is the size of a ds64 chunk without table entries: the RIFF size,
+// data size and sample count as 64 bit values followed by the table length.
+const ds64Size = 8 + 8 + 8 + 4
+
+// maxRIFFSize is the largest size a RIFF container can describe. It's a
+// variable so the RF64 upgrade can be tested without writing 4GB.
+var maxRIFFSize int64 = 0xFFFFFFFF
+
+// checkedSize returns the passed size as a 32 bit RIFF size or an
+// ErrSizeOverflow error if it is negative or too large.
+func checkedSize(size int64, what string) (uint32, error) {
+	if size < 0 || size > maxRIFFSize {
+		return 0, fmt.Errorf("%w: %s %d", ErrSizeOverflow, what, size)
+	}
+	return uint32(size), nil
+}
+
+var (
+	rf64ID = [4]byte{'R', 'F', '6', '4'}
+	junkID = [4]byte{'J', 'U', 'N', 'K'}
+)
+
+// WriterAtSeeker is the writer an Encoder writes to, which *os.File
+// implements. The encoder appends the header and the audio with Write,
+// patches the sizes of the header with WriteAt and moves back to the end of
+// the written data with Seek, which is also used by Truncate. Writers which
+// can't patch, such as pipes, are written with a StreamEncoder, while writers
+// only supporting positioned writes are wrapped with a PositionedWriter. To
+// observe the writes, wrap the writer with an InstrumentedWriter.
 type WriterAtSeeker interface {
 	io.Writer
 	io.WriterAt
@@ -22,9 +60,12 @@ type WriterAtSeeker interface {
 
 // Encoder encodes LPCM data into a wav containter.
 type Encoder struct {
-	mu      sync.Mutex
-	w       WriterAtSeeker
-	bufPool *sync.Pool
+	mu sync.Mutex
+	w  WriterAtSeeker
+	// bufPool holds the serialization buffers, it is created on first use
+	// by buffers so encoders which don't need it don't allocate it.
+	bufPool  *sync.Pool
+	poolOnce sync.Once
 
 	SampleRate int
 	BitDepth   int
@@ -34,28 +75,186 @@ type Encoder struct {
 	// the <format-specific-fields> portion of the ‘fmt’ chunk, and the
 	// interpretation of the waveform data, depend on this value. PCM = 1 (i.e.
 	// Linear quantization) Values other than 1 indicate some form of
-	// compression.
+	// compression. See FormatPCM and the other Format constants.
 	WavAudioFormat int
 
+	// ValidBitsPerSample declares that only the most significant bits of the
+	// samples are valid, for instance 24 bit samples in 32 bit containers.
+	// When lower than BitDepth, the fmt chunk is written as
+	// WAVE_FORMAT_EXTENSIBLE with WavAudioFormat as its sub format, and the
+	// samples passed to Write are expected to be ValidBitsPerSample wide:
+	// they are shifted so the unused low bits are zero.
+	ValidBitsPerSample int
+
 	// Metadata contains metadata to inject in the file.
 	Metadata *Metadata
 
+	// Strict makes the encoder refuse configurations that aren't strictly
+	// conformant instead of doing its best effort. The enforced rules are:
+	//  - BitDepth must be 8, 16, 24 or 32.
+	//  - SampleRate and NumChans must be positive.
+	//  - WavAudioFormat must be PCM (1) since other formats require a fact
+	//    chunk which isn't written.
+	//  - WAVE_FORMAT_EXTENSIBLE (0xFFFE) is refused unless a channel mask
+	//    is set with SetChannelLayout.
+	//  - More than 2 channels is refused unless a channel mask is set, which
+	//    makes the fmt chunk WAVE_FORMAT_EXTENSIBLE.
+	//  - The block align and avg bytes per sec set by SetBlockAlign and
+	//    SetByteRate must match the format.
+	// Violations are reported as ErrNonConformant when writing the header.
+	// WriteFloat also refuses NaN and infinite samples with
+	// ErrNonFiniteSample instead of sanitizing them.
+	Strict bool
+
+	// Canonical guarantees the classic 44 byte header: the RIFF header, a 16
+	// byte fmt chunk and the data chunk header, the audio starting at offset
+	// 44 as assumed by naive parsers. The options adding bytes before the
+	// audio are refused when writing the header: ReserveDS64, a
+	// WAVE_FORMAT_EXTENSIBLE fmt chunk (ValidBitsPerSample, SetChannelLayout
+	// or FormatExtensible) and AlignDataChunk unless 44 is aligned. The
+	// metadata chunks are written after the audio and are allowed.
+	Canonical bool
+
+	// ReserveDS64 reserves room for a ds64 chunk with a JUNK chunk written
+	// right after the RIFF header. If the file grows past the 4GB limit of
+	// the RIFF container, Close converts the file to RF64 in place by
+	// turning the JUNK chunk into a ds64 chunk holding the 64 bit sizes.
+	ReserveDS64 bool
+
+	// TrailingSizeRecord makes the encoder only append, for write-once
+	// media: instead of seeking back to patch the header, Close writes the
+	// true sizes in an fsiz chunk at the end of the file, the header keeping
+	// the StreamingDataSize sizes. Once random access is available,
+	// Normalize patches the header from the record. The writer isn't probed
+	// for seeking and the live header updates are disabled, but the options
+	// rewriting written audio, such as WriteAt or TrimSilence, still need a
+	// seekable writer.
+	TrailingSizeRecord bool
+
+	// RoundingMode is used to quantize float samples, see WriteFloat.
+	RoundingMode RoundingMode
+
+	// Dither adds triangular probability density (TPDF) noise of up to 1 LSB
+	// to the float samples before they are quantized, which decorrelates the
+	// quantization error from the signal. The noise sequence is set by
+	// SetDitherSeed.
+	Dither bool
+
+	// NoiseShaping feeds the quantization error of float samples back to
+	// push the noise out of the most audible band, see NoiseShapingMode.
+	// The error of each channel carries across buffers.
+	NoiseShaping NoiseShapingMode
+
+	// HeadroomDB attenuates the samples written by WriteFloat32 by that many
+	// dB, for instance 1 to peak at -1dBFS and avoid inter-sample clipping
+	// when the signal is reconstructed. It is ignored when not positive.
+	HeadroomDB float64
+
+	// Overflow defines how int samples out of the range of the bit depth
+	// (or of ValidBitsPerSample) are written. They are clamped to full scale
+	// by default and counted, see ClippedSamples.
+	Overflow OverflowPolicy
+
+	// FormType overrides the RIFF form type written after the RIFF size,
+	// WAVE by default, for containers derived from wav files. It must be made
+	// of printable ASCII characters.
+	FormType [4]byte
+
+	// InputBigEndian indicates that the source PCM is big endian, like AIFF
+	// data. The bytes of each sample are swapped to little endian when
+	// serialized by Write or copied by WriteRaw.
+	InputBigEndian bool
+
+	// UpmixMono duplicates the samples of mono buffers passed to Write and
+	// WriteFloat to all the channels of the encoder, so mono content such as
+	// a voice recording plays on every speaker. Buffers with as many
+	// channels as the encoder are written as is, other channel counts are
+	// refused.
+	UpmixMono bool
+
+	// BufferWrites buffers the sequential writes in memory, cutting the
+	// number of syscalls made by the many small writes of the header, the
+	// metadata and WriteFrame on unbuffered writers such as *os.File. The
+	// buffer is flushed before any seek or positioned write, which keeps the
+	// size patching correct, and on Close. It must be set before writing.
+	BufferWrites bool
+
+	// LowLatency flushes each written buffer to the writer (and to the
+	// underlying writer if it has a Flush method) as soon as it is written,
+	// so the audio is visible to concurrent readers, for instance to monitor
+	// a recording live. Only whole frames are written. It trades throughput
+	// for latency: with BufferWrites it amounts to a write per buffer, and
+	// with LowLatencySync the file is also synced which is much slower.
+	LowLatency bool
+	// LowLatencySync makes LowLatency also sync *os.File writers to the disk
+	// after each buffer.
+	LowLatencySync bool
+
+	// Unsafe disables the internal locking for a speedup in tight loops.
+	// DANGER: only set it if the encoder is exclusively used from a single
+	// goroutine, concurrent use of an unsafe encoder corrupts the counters
+	// used to finalize the file.
+	Unsafe bool
+
+	displayTitle string
+	softwareTag  string
+	// encoderName and encoderChunkID are set by SetEncoderName.
+	encoderName    string
+	encoderChunkID [4]byte
+	// iXML is set by SetIXML.
+	iXML []byte
+	// resU is set by SetResU.
+	resU []byte
+	// gapless is set by SetGaplessInfo.
+	gapless *GaplessInfo
+	// ditherSeed is set by SetDitherSeed, dither is created from it on first
+	// use.
+	ditherSeed int64
+	dither     *ditherSource
+	// shapingErr holds the last quantization error of each channel, see
+	// NoiseShaping.
+	shapingErr []float64
+	dcBlocker  *dcBlocker
+	silence    *silenceDetector
+	trim       *tailTrimmer
+	overview   *overview
+	loudness   *loudnessMeter
+	ds64Pos    int64
+	// liveInterval is the number of frames between live header updates and
+	// liveFrames the frame count at the last update.
+	liveInterval int
+	liveFrames   int
+	// totalFrames is the expected number of frames, see SetTotalFrames.
+	totalFrames int
+	// dataAlign is the boundary the audio data starts on, see AlignDataChunk.
+	dataAlign int
+	// blockAlign and byteRate override the fmt chunk fields when set, see
+	// SetBlockAlign and SetByteRate.
+	blockAlign int
+	byteRate   int
+	// channelMask is set by SetChannelLayout.
+	channelMask SpeakerLayout
+	// metadataBytes is the size of the chunks written after the data chunk.
+	metadataBytes int
+	// clipped is the number of samples clamped because of Overflow.
+	clipped int
+
 	WrittenBytes    int
 	frames          int
 	pcmChunkStarted bool
-	pcmChunkSizePos int
-	pcmChunkPos     int64
-	wroteHeader     bool // true if we've written the header out
+	// dataHeaderWritten is set once the data chunk header, including its
+	// size at pcmChunkSizePos, is written.
+	dataHeaderWritten bool
+	pcmChunkSizePos   int
+	pcmChunkPos       int64
+	wroteHeader       bool // true if we've written the header out
 }
 
 // NewEncoder creates a new encoder to create a new wav file.
 // Don't forget to add Frames to the encoder before writing.
 func NewEncoder(w WriterAtSeeker, sampleRate, bitDepth, numChans, audioFormat int) *Encoder {
 	return &Encoder{
-		w: w,
-		bufPool: &sync.Pool{New: func() interface{} {
-			return bytes.NewBuffer(make([]byte, 0, bytesNumFromDuration(time.Minute, sampleRate, bitDepth)*numChans))
-		}},
+		w:              w,
 		SampleRate:     sampleRate,
 		BitDepth:       bitDepth,
 		NumChans:       numChans,
@@ -63,16 +262,160 @@ func NewEncoder(w WriterAtSeeker, sampleRate, bitDepth, numChans, audioFormat in
 	}
 }
 
-// AddLE serializes and adds the passed value using little endian
-func (e *Encoder) AddLE(src interface{}) error {
-	e.WrittenBytes += binary.Size(src)
-	return binary.Write(e.w, binary.LittleEndian, src)
+// buffers returns the pool of serialization buffers, creating it on first
+// use. The buffers hold a minute of audio.
+func (e *Encoder) buffers() *sync.Pool {
+	e.poolOnce.Do(func() {
+		size := bytesNumFromDuration(time.Minute, e.SampleRate, e.BitDepth) * e.NumChans
+		e.bufPool = &sync.Pool{New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, size))
+		}}
+	})
+	return e.bufPool
+}
+
+func (e *Encoder) lock() {
+	if !e.Unsafe {
+		e.mu.Lock()
+	}
+}
+
+func (e *Encoder) unlock() {
+	if !e.Unsafe {
+		e.mu.Unlock()
+	}
+}
+
+// Clone returns a new encoder writing to w with the same format, options and
+// a deep copy of the metadata. The write state and counters of the returned
+// encoder are reset.
+func (e *Encoder) Clone(w WriterAtSeeker) *Encoder {
+	c := NewEncoder(w, e.SampleRate, e.BitDepth, e.NumChans, e.WavAudioFormat)
+	c.ValidBitsPerSample = e.ValidBitsPerSample
+	c.Metadata = e.Metadata.clone()
+	c.Strict = e.Strict
+	c.Canonical = e.Canonical
+	c.ReserveDS64 = e.ReserveDS64
+	c.TrailingSizeRecord = e.TrailingSizeRecord
+	c.RoundingMode = e.RoundingMode
+	c.Dither = e.Dither
+	c.NoiseShaping = e.NoiseShaping
+	c.HeadroomDB = e.HeadroomDB
+	c.ditherSeed = e.ditherSeed
+	c.Overflow = e.Overflow
+	c.InputBigEndian = e.InputBigEndian
+	c.UpmixMono = e.UpmixMono
+	c.FormType = e.FormType
+	c.BufferWrites = e.BufferWrites
+	c.LowLatency = e.LowLatency
+	c.LowLatencySync = e.LowLatencySync
+	c.Unsafe = e.Unsafe
+	c.displayTitle = e.displayTitle
+	c.softwareTag = e.softwareTag
+	c.encoderName = e.encoderName
+	c.encoderChunkID = e.encoderChunkID
+	c.iXML = append([]byte(nil), e.iXML...)
+	c.resU = append([]byte(nil), e.resU...)
+	if e.gapless != nil {
+		gapless := *e.gapless
+		c.gapless = &gapless
+	}
+	c.liveInterval = e.liveInterval
+	c.totalFrames = e.totalFrames
+	c.dataAlign = e.dataAlign
+	c.blockAlign = e.blockAlign
+	c.byteRate = e.byteRate
+	c.channelMask = e.channelMask
+	if e.silence != nil {
+		c.silence = &silenceDetector{
+			threshold:    e.silence.threshold,
+			intThreshold: e.silence.intThreshold,
+			center:       e.silence.center,
+			minFrames:    e.silence.minFrames,
+		}
+	}
+	if e.trim != nil {
+		trim := *e.trim
+		trim.end = 0
+		c.trim = &trim
+	}
+	if e.overview != nil {
+		c.overview = &overview{decimation: e.overview.decimation, center: e.overview.center, bits: e.overview.bits}
+	}
+	if e.dcBlocker != nil {
+		c.dcBlocker = newDCBlocker(e.SampleRate)
+	}
+	if e.loudness != nil {
+		c.loudness = newLoudnessMeter(e.SampleRate, e.loudness.mask)
+		c.loudness.writeBext = e.loudness.writeBext
+	}
+	return c
+}
+
+// UseMetadataTemplate sets the metadata of the encoder to a deep copy of the
+// passed template, so the metadata can be tweaked per file without altering
+// the template shared by a batch of encoders.
+func (e *Encoder) UseMetadataTemplate(template *Metadata) {
+	e.Metadata = template.clone()
+}
+
+// metadata returns the metadata of the encoder, creating it if needed.
+func (e *Encoder) metadata() *Metadata {
+	if e.Metadata == nil {
+		e.Metadata = &Metadata{}
+	}
+	return e.Metadata
+}
+
+// SetComment sets the comment written in the ICMT field of the INFO chunk,
+// creating Metadata if needed.
+func (e *Encoder) SetComment(comment string) {
+	e.metadata().Comments = comment
+}
+
+// SetTitle sets the title written in the INAM field of the INFO chunk,
+// creating Metadata if needed.
+func (e *Encoder) SetTitle(title string) {
+	e.metadata().Title = title
+}
+
+// SetArtist sets the artist written in the IART field of the INFO chunk,
+// creating Metadata if needed.
+func (e *Encoder) SetArtist(artist string) {
+	e.metadata().Artist = artist
+}
+
+// AddLE serializes and adds the passed value using little endian. It returns
+// the number of bytes written, which is also added to WrittenBytes, so a write
+// failing partway doesn't skew the offsets of the following chunks.
+func (e *Encoder) AddLE(src interface{}) (int, error) {
+	return e.add(binary.LittleEndian, src)
+}
+
+// AddBE serializes and adds the passed value using big endian, see AddLE.
+func (e *Encoder) AddBE(src interface{}) (int, error) {
+	return e.add(binary.BigEndian, src)
+}
+
+func (e *Encoder) add(order binary.ByteOrder, src interface{}) (int, error) {
+	// binary.Write serializes the value before a single write, counting it
+	// gives the bytes which made it to the writer
+	cw := &byteCounter{w: e.w}
+	err := binary.Write(cw, order, src)
+	e.WrittenBytes += cw.n
+	return cw.n, err
+}
+
+// byteCounter counts the bytes written to w.
+type byteCounter struct {
+	w io.Writer
+	n int
 }
 
-// AddBE serializes and adds the passed value using big endian
-func (e *Encoder) AddBE(src interface{}) error {
-	e.WrittenBytes += binary.Size(src)
-	return binary.Write(e.w, binary.BigEndian, src)
+func (c *byteCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
 }
 
 func (e *Encoder) addBuffer(buf *audio.IntBuffer, pos *int64) (int64, error) {
@@ -80,134 +423,997 @@ func (e *Encoder) addBuffer(buf *audio.IntBuffer, pos *int64) (int64, error) {
 		return 0, fmt.Errorf("can't add a nil buffer")
 	}
 
-	binaryBuf := e.bufPool.Get().(*bytes.Buffer)
-	defer e.bufPool.Put(binaryBuf)
+	pool := e.buffers()
+	binaryBuf := pool.Get().(*bytes.Buffer)
+	defer func() {
+		// the buffer is also reset on the error paths so it is returned empty
+		binaryBuf.Reset()
+		pool.Put(binaryBuf)
+	}()
 
 	frameCount := buf.NumFrames()
 	// performance tweak: setup a buffer so we don't do too many writes
 	var err error
 
 	bufferFrames := 0
-	for i := 0; i < frameCount; i++ {
-		for j := 0; j < buf.Format.NumChannels; j++ {
-			v := buf.Data[i*buf.Format.NumChannels+j]
-			switch e.BitDepth {
-			case 8:
-				if err = binary.Write(binaryBuf, binary.LittleEndian, uint8(v)); err != nil {
-					return 0, err
-				}
-			case 16:
-				if err = binary.Write(binaryBuf, binary.LittleEndian, int16(v)); err != nil {
-					return 0, err
-				}
-			case 24:
-				if err = binary.Write(binaryBuf, binary.LittleEndian, audio.Int32toInt24LEBytes(int32(v))); err != nil {
-					return 0, err
+	shift := e.sampleShift()
+	var out []byte
+	if len(buf.Data) >= parallelMinSamples && runtime.GOMAXPROCS(0) > 1 {
+		if out, err = e.encodeParallel(binaryBuf, buf.Data[:frameCount*buf.Format.NumChannels], buf.Format.NumChannels); err != nil {
+			return 0, err
+		}
+		bufferFrames = frameCount
+	} else {
+		lo, hi := e.sampleRange()
+		clipped := 0
+		defer func() { e.addClipped(clipped) }()
+		for i := 0; i < frameCount; i++ {
+			for j := 0; j < buf.Format.NumChannels; j++ {
+				v := buf.Data[i*buf.Format.NumChannels+j]
+				if v > hi {
+					v = hi
+					clipped++
+				} else if v < lo {
+					v = lo
+					clipped++
 				}
-			case 32:
-				if err = binary.Write(binaryBuf, binary.LittleEndian, int32(v)); err != nil {
-					return 0, err
+				v <<= shift
+				switch e.BitDepth {
+				case 8:
+					if err = binary.Write(binaryBuf, binary.LittleEndian, uint8(v)); err != nil {
+						return 0, err
+					}
+				case 16:
+					if err = binary.Write(binaryBuf, binary.LittleEndian, int16(v)); err != nil {
+						return 0, err
+					}
+				case 24:
+					// appended byte by byte, binary.Write allocating per sample
+					binaryBuf.WriteByte(byte(v))
+					binaryBuf.WriteByte(byte(v >> 8))
+					binaryBuf.WriteByte(byte(v >> 16))
+				case 32:
+					if err = binary.Write(binaryBuf, binary.LittleEndian, int32(v)); err != nil {
+						return 0, err
+					}
+				default:
+					return 0, fmt.Errorf("can't add frames of bit size %d", e.BitDepth)
 				}
-			default:
-				return 0, fmt.Errorf("can't add frames of bit size %d", e.BitDepth)
 			}
+			bufferFrames++
+		}
+		out = binaryBuf.Bytes()
+	}
+	return e.writeSamples(buf, out, bufferFrames, pos)
+}
+
+// writeSamples writes the passed serialized frames of buf, appending them or
+// at pos in the data chunk, and updates the counters.
+func (e *Encoder) writeSamples(buf *audio.IntBuffer, out []byte, bufferFrames int, pos *int64) (int64, error) {
+	if e.InputBigEndian {
+		swapBytes(out, e.BitDepth/8)
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if pos == nil {
+		n, err = e.w.Write(out)
+	} else {
+		if err := e.fillGap(e.pcmChunkPos + *pos); err != nil {
+			return 0, err
 		}
-		bufferFrames++
+		n, err = e.w.WriteAt(out, e.pcmChunkPos+*pos)
 	}
 
-	var n int
+	e.lock()
+	var (
+		offset  int64
+		liveErr error
+	)
 	if pos == nil {
-		n, err = e.w.Write(binaryBuf.Bytes())
+		if err != nil {
+			// only the frames fully written are accounted for
+			bufferFrames = n / (e.NumChans * e.BitDepth / 8)
+		}
+		e.analyze(buf.Data[:bufferFrames*buf.Format.NumChannels], buf.Format.NumChannels, e.frames)
+		e.frames += bufferFrames
+		e.WrittenBytes += n
+		offset = int64(e.WrittenBytes)
+		if err == nil {
+			liveErr = e.updateLiveHeader()
+		}
 	} else {
-		n, err = e.w.WriteAt(binaryBuf.Bytes(), e.pcmChunkPos+*pos)
+		// overwritten frames are only accounted for if they extend the data
+		offset = e.pcmChunkPos + *pos + int64(n)
+		blockAlign := int64(e.NumChans * e.BitDepth / 8)
+		if end := int((*pos + int64(n)) / blockAlign); end > e.frames {
+			e.frames = end
+		}
+		if e.trim != nil {
+			written := n / int(blockAlign)
+			if written > bufferFrames {
+				written = bufferFrames
+			}
+			e.trim.analyze(buf.Data[:written*buf.Format.NumChannels], buf.Format.NumChannels, int(*pos/blockAlign))
+		}
+		if int(offset) > e.WrittenBytes {
+			e.WrittenBytes = int(offset)
+			// move the cursor so following writes append after the new end
+			if _, sErr := e.w.Seek(offset, io.SeekStart); sErr != nil && err == nil {
+				err = sErr
+			}
+		}
+	}
+	e.unlock()
+	if err != nil {
+		return int64(n), e.writeError("data", offset, err)
+	}
+	if liveErr != nil {
+		return int64(n), liveErr
+	}
+
+	return int64(n), e.lowLatencyFlush()
+}
+
+// analyze runs the enabled analyzers over interleaved int samples starting at
+// the passed frame. It must be called under the lock.
+func (e *Encoder) analyze(data []int, numChans, frame int) {
+	if e.silence != nil {
+		e.silence.analyze(data, numChans, frame)
+	}
+	if e.overview != nil {
+		e.overview.analyze(data, numChans)
+	}
+	if e.loudness != nil {
+		e.measureLoudness(data, numChans)
+	}
+	if e.trim != nil {
+		e.trim.analyze(data, numChans, frame)
+	}
+}
+
+// analyzing reports whether an analyzer of the int samples is enabled.
+func (e *Encoder) analyzing() bool {
+	return e.silence != nil || e.overview != nil || e.loudness != nil || e.trim != nil
+}
+
+// lowLatencyFlush pushes the written audio down to the writer when
+// LowLatency is set.
+func (e *Encoder) lowLatencyFlush() error {
+	if !e.LowLatency {
+		return nil
+	}
+	if err := e.flush(); err != nil {
+		return e.writeError("data", int64(e.WrittenBytes), err)
+	}
+	switch w := e.underlying().(type) {
+	case *os.File:
+		if e.LowLatencySync {
+			if err := w.Sync(); err != nil {
+				return e.writeError("data", int64(e.WrittenBytes), err)
+			}
+		}
+	case interface{ Flush() error }:
+		if err := w.Flush(); err != nil {
+			return e.writeError("data", int64(e.WrittenBytes), err)
+		}
+	}
+	return nil
+}
+
+// WriteWith is like Write but serializes the samples into the passed scratch
+// slice instead of a buffer of the encoder pool, so hot loops can write
+// without allocating. The scratch slice is grown if it's too small for the
+// buffer and returned, the caller owns it and should pass the returned slice
+// to the next call. The encoder doesn't retain it after returning.
+func (e *Encoder) WriteWith(buf *audio.IntBuffer, scratch []byte) ([]byte, error) {
+	if buf == nil {
+		return scratch, fmt.Errorf("can't add a nil buffer")
+	}
+	if err := e.writeSetup(); err != nil {
+		return scratch, err
+	}
+	put, err := samplePutFunc(e.BitDepth)
+	if err != nil {
+		return scratch, err
+	}
+	bytesPerSample := e.BitDepth / 8
+	frames := buf.NumFrames()
+	data := buf.Data[:frames*buf.Format.NumChannels]
+	if size := len(data) * bytesPerSample; cap(scratch) < size {
+		scratch = make([]byte, size)
+	}
+	out := scratch[:len(data)*bytesPerSample]
+	shift := e.sampleShift()
+	lo, hi := e.sampleRange()
+	clipped := 0
+	for i, v := range data {
+		if v > hi {
+			v = hi
+			clipped++
+		} else if v < lo {
+			v = lo
+			clipped++
+		}
+		put(out[i*bytesPerSample:], v<<shift)
+	}
+	e.addClipped(clipped)
+	_, err = e.writeSamples(buf, out, frames, nil)
+	return scratch, err
+}
+
+// WriteRing writes count interleaved samples of the passed ring buffer of 16
+// bit samples, starting at the start index and wrapping around the end of the
+// slice, so capture callbacks can write straight from their ring without a
+// linear copy. The encoder must be a 16 bit PCM encoder. The ring length,
+// start and count must be multiples of the number of channels so the wrapped
+// region is made of whole frames.
+func (e *Encoder) WriteRing(data []int16, start, count int) error {
+	if e.BitDepth != 16 || e.WavAudioFormat != FormatPCM {
+		return fmt.Errorf("can't write 16 bit samples to a %d bit encoder of format %d", e.BitDepth, e.WavAudioFormat)
+	}
+	numChans := e.NumChans
+	if numChans < 1 {
+		return fmt.Errorf("invalid number of channels %d", numChans)
+	}
+	if len(data)%numChans != 0 {
+		return fmt.Errorf("the ring length %d isn't a multiple of %d channels", len(data), numChans)
+	}
+	if start < 0 || start >= len(data) && len(data) > 0 {
+		return fmt.Errorf("start %d is out of the ring of %d samples", start, len(data))
+	}
+	if count < 0 || count > len(data) {
+		return fmt.Errorf("can't write %d samples from a ring of %d samples", count, len(data))
+	}
+	if start%numChans != 0 || count%numChans != 0 {
+		return fmt.Errorf("start %d and count %d must be multiples of %d channels", start, count, numChans)
+	}
+	if err := e.writeSetup(); err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	// the region is made of the end of the ring followed by its beginning
+	end := start + count
+	if end > len(data) {
+		end = len(data)
 	}
+	segments := [2][]int16{data[start:end], data[:count-(end-start)]}
 
-	e.mu.Lock()
-	e.frames += bufferFrames
+	pool := e.buffers()
+	binaryBuf := pool.Get().(*bytes.Buffer)
+	defer func() {
+		binaryBuf.Reset()
+		pool.Put(binaryBuf)
+	}()
+	binaryBuf.Grow(count * 2)
+	out := binaryBuf.Bytes()[:count*2]
+	shift := e.sampleShift()
+	lo, hi := e.sampleRange()
+	clipped := 0
+	i := 0
+	for _, segment := range segments {
+		for _, s := range segment {
+			v := int(s)
+			if v > hi {
+				v = hi
+				clipped++
+			} else if v < lo {
+				v = lo
+				clipped++
+			}
+			binary.LittleEndian.PutUint16(out[i:], uint16(v<<shift))
+			i += 2
+		}
+	}
+	e.addClipped(clipped)
+	if e.InputBigEndian {
+		swapBytes(out, 2)
+	}
+
+	e.lock()
+	if e.analyzing() {
+		// the analyzers work on int samples, only converted when needed
+		frame := e.frames
+		for _, segment := range segments {
+			ints := make([]int, len(segment))
+			for i, s := range segment {
+				ints[i] = int(s)
+			}
+			e.analyze(ints, numChans, frame)
+			frame += len(segment) / numChans
+		}
+	}
+	e.unlock()
+	_, err := e.addBytes(out, count/numChans)
+	return err
+}
+
+// WriteStereo24 interleaves the passed left and right channels, of equal
+// length, and writes them packed as 24 bit samples, without building an
+// interleaved int buffer. The encoder must be a 24 bit stereo PCM encoder.
+// Both channels follow the same Overflow policy and ValidBitsPerSample
+// shift as the samples passed to Write.
+func (e *Encoder) WriteStereo24(left, right []int32) error {
+	if e.BitDepth != 24 || e.NumChans != 2 || e.WavAudioFormat != FormatPCM {
+		return fmt.Errorf("can't write 24 bit stereo samples to a %d bit %d channels encoder of format %d", e.BitDepth, e.NumChans, e.WavAudioFormat)
+	}
+	if len(left) != len(right) {
+		return fmt.Errorf("the left channel has %d samples but the right one has %d", len(left), len(right))
+	}
+	if err := e.writeSetup(); err != nil {
+		return err
+	}
+	frames := len(left)
+	if frames == 0 {
+		return nil
+	}
+
+	pool := e.buffers()
+	binaryBuf := pool.Get().(*bytes.Buffer)
+	defer func() {
+		binaryBuf.Reset()
+		pool.Put(binaryBuf)
+	}()
+	binaryBuf.Grow(frames * 6)
+	out := binaryBuf.Bytes()[:frames*6]
+	shift := e.sampleShift()
+	lo, hi := e.sampleRange()
+	clipped := 0
+	for i := 0; i < frames; i++ {
+		for c, s := range [2]int32{left[i], right[i]} {
+			v := int(s)
+			if v > hi {
+				v = hi
+				clipped++
+			} else if v < lo {
+				v = lo
+				clipped++
+			}
+			v <<= shift
+			b := out[i*6+c*3:]
+			b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+		}
+	}
+	e.addClipped(clipped)
+	if e.InputBigEndian {
+		swapBytes(out, 3)
+	}
+
+	e.lock()
+	if e.analyzing() {
+		ints := make([]int, frames*2)
+		for i := 0; i < frames; i++ {
+			ints[i*2], ints[i*2+1] = int(left[i]), int(right[i])
+		}
+		e.analyze(ints, 2, e.frames)
+	}
+	e.unlock()
+	_, err := e.addBytes(out, frames)
+	return err
+}
+
+// SetTotalFrames declares the number of frames that will be written so
+// WriteHeaderNow can write the final sizes upfront.
+func (e *Encoder) SetTotalFrames(frames int) {
+	e.totalFrames = frames
+}
+
+// WriteHeaderNow writes the complete header, with the final RIFF and data
+// chunk sizes computed from the frame count passed to SetTotalFrames, and the
+// data chunk header. It's a fast path for bulk generation: the following
+// writes, typically WriteRaw, only append the audio. Close still patches the
+// sizes if the written frames or the metadata differ from the declared size.
+func (e *Encoder) WriteHeaderNow() error {
+	if e.totalFrames <= 0 {
+		return errors.New("SetTotalFrames must be called before WriteHeaderNow")
+	}
+	if e.wroteHeader {
+		return errors.New("already wrote header")
+	}
+	if err := e.writeSetup(); err != nil {
+		return err
+	}
+	dataSize, err := checkedSize(int64(e.totalFrames)*int64(e.NumChans*e.BitDepth/8), "data chunk size")
+	if err != nil {
+		return err
+	}
+	riffSize, err := checkedSize(e.pcmChunkPos+int64(dataSize)-8, "RIFF size")
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, riffSize)
+	if _, err := e.w.WriteAt(b, 4); err != nil {
+		return e.writeError("header", 4, err)
+	}
+	binary.LittleEndian.PutUint32(b, dataSize)
+	if _, err := e.w.WriteAt(b, int64(e.pcmChunkSizePos)); err != nil {
+		return e.writeError("header", int64(e.pcmChunkSizePos), err)
+	}
+	return nil
+}
+
+// WriteRaw writes already serialized PCM data, which must be made of whole
+// frames in the encoder format. The bytes are copied verbatim unless
+// InputBigEndian is set in which case the bytes of each sample are swapped.
+// It returns the number of bytes written. The bytes are written directly,
+// without going through the serialization buffers of the encoder which are
+// only allocated by the first write of an IntBuffer. It is the passthrough
+// fast path for audio already in the little endian layout of the bit depth:
+// the per sample conversion of Write is skipped, only the counters are
+// updated.
+func (e *Encoder) WriteRaw(b []byte) (int, error) {
+	blockAlign := e.NumChans * e.BitDepth / 8
+	if blockAlign <= 0 || len(b)%blockAlign != 0 {
+		return 0, fmt.Errorf("%d bytes aren't whole frames of %d bytes", len(b), blockAlign)
+	}
+	if err := e.writeSetup(); err != nil {
+		return 0, err
+	}
+	if e.InputBigEndian {
+		swapped := make([]byte, len(b))
+		copy(swapped, b)
+		swapBytes(swapped, e.BitDepth/8)
+		b = swapped
+	}
+	n, err := e.addBytes(b, len(b)/blockAlign)
+	e.keepTail()
+	return n, err
+}
+
+// swapBytes reverses in place the byte order of each sample of the passed
+// size.
+func swapBytes(b []byte, sampleSize int) {
+	if sampleSize < 2 {
+		return
+	}
+	for i := 0; i+sampleSize <= len(b); i += sampleSize {
+		for l, r := i, i+sampleSize-1; l < r; l, r = l+1, r-1 {
+			b[l], b[r] = b[r], b[l]
+		}
+	}
+}
+
+// addBytes writes already serialized frames and updates the counters.
+func (e *Encoder) addBytes(b []byte, frames int) (int, error) {
+	n, err := e.w.Write(b)
+	e.lock()
+	defer e.unlock()
 	e.WrittenBytes += n
-	e.mu.Unlock()
-	binaryBuf.Reset()
+	if err != nil {
+		// only the frames fully written are accounted for
+		if frames > 0 {
+			e.frames += n / (len(b) / frames)
+		}
+		return n, e.writeError("data", int64(e.WrittenBytes), err)
+	}
+	e.frames += frames
+	if err := e.updateLiveHeader(); err != nil {
+		return n, err
+	}
+	return n, e.lowLatencyFlush()
+}
 
-	return int64(n), nil
+// writeError wraps an error of the underlying writer with the operation that
+// failed and the offset at which it failed.
+func (e *Encoder) writeError(op string, offset int64, err error) error {
+	return &WriteError{Op: op, Offset: offset, Err: err}
 }
 
-func (e *Encoder) writeHeader() error {
+// parallelMinSamples is the number of samples from which a buffer is
+// serialized by several goroutines, smaller buffers aren't worth the overhead.
+var parallelMinSamples = 1 << 16
+
+// encodeParallel serializes the passed interleaved samples by dividing the
+// frames across goroutines, each one writing a disjoint region of the output
+// which is backed by the passed buffer.
+func (e *Encoder) encodeParallel(binaryBuf *bytes.Buffer, data []int, numChans int) ([]byte, error) {
+	put, err := samplePutFunc(e.BitDepth)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSample := e.BitDepth / 8
+	shift := e.sampleShift()
+	lo, hi := e.sampleRange()
+	frames := len(data) / numChans
+	binaryBuf.Grow(len(data) * bytesPerSample)
+	out := binaryBuf.Bytes()[:len(data)*bytesPerSample]
+
+	workers := runtime.GOMAXPROCS(0)
+	step := (frames + workers - 1) / workers
+	// each worker counts its clipped samples in its own slot
+	clipped := make([]int, workers)
+	var wg sync.WaitGroup
+	for w, start := 0, 0; start < frames; w, start = w+1, start+step {
+		end := start + step
+		if end > frames {
+			end = frames
+		}
+		wg.Add(1)
+		go func(samples []int, dst []byte, clipped *int) {
+			defer wg.Done()
+			for i, v := range samples {
+				if v > hi {
+					v = hi
+					*clipped++
+				} else if v < lo {
+					v = lo
+					*clipped++
+				}
+				put(dst[i*bytesPerSample:], v<<shift)
+			}
+		}(data[start*numChans:end*numChans], out[start*numChans*bytesPerSample:end*numChans*bytesPerSample], &clipped[w])
+	}
+	wg.Wait()
+	total := 0
+	for _, n := range clipped {
+		total += n
+	}
+	e.addClipped(total)
+	return out, nil
+}
+
+// OverflowPolicy defines how int samples out of the range of the bit depth
+// are written.
+type OverflowPolicy int
+
+const (
+	// OverflowClamp clamps the samples to full scale.
+	OverflowClamp OverflowPolicy = iota
+	// OverflowWrap keeps the low bits of the samples, which wrap around.
+	// It's the behavior of a plain integer conversion.
+	OverflowWrap
+)
+
+// sampleRange returns the range of the int samples which can be written
+// without overflowing, given the Overflow policy.
+func (e *Encoder) sampleRange() (lo, hi int) {
+	if e.Overflow == OverflowWrap {
+		return -int(^uint(0)>>1) - 1, int(^uint(0) >> 1)
+	}
+	bits := uint(e.BitDepth) - e.sampleShift()
+	if e.BitDepth == 8 {
+		// 8 bit samples are unsigned
+		return 0, 1<<bits - 1
+	}
+	return -1 << (bits - 1), 1<<(bits-1) - 1
+}
+
+// addClipped accounts for samples clamped because of the Overflow policy.
+func (e *Encoder) addClipped(n int) {
+	if n == 0 {
+		return
+	}
+	e.lock()
+	e.clipped += n
+	e.unlock()
+}
+
+// ClippedSamples returns the number of samples which were out of the range of
+// the bit depth and got clamped to full scale, see Overflow and WriteFloat32.
+func (e *Encoder) ClippedSamples() int {
+	e.lock()
+	defer e.unlock()
+	return e.clipped
+}
+
+// extensible reports if the fmt chunk is written as WAVE_FORMAT_EXTENSIBLE.
+func (e *Encoder) extensible() bool {
+	return e.WavAudioFormat == FormatExtensible || e.packed() || e.channelMask != 0
+}
+
+// packed reports if the samples are packed in larger containers, see
+// ValidBitsPerSample.
+func (e *Encoder) packed() bool {
+	return e.ValidBitsPerSample > 0 && e.ValidBitsPerSample < e.BitDepth
+}
+
+// sampleShift returns the number of unused low bits of the samples.
+func (e *Encoder) sampleShift() uint {
+	if !e.packed() {
+		return 0
+	}
+	return uint(e.BitDepth - e.ValidBitsPerSample)
+}
+
+// samplePutFunc returns a function serializing a sample in little endian
+// using the amount of bits used per sample.
+func samplePutFunc(bitDepth int) (func([]byte, int), error) {
+	switch bitDepth {
+	case 8:
+		return func(b []byte, v int) {
+			b[0] = uint8(v)
+		}, nil
+	case 16:
+		return func(b []byte, v int) {
+			binary.LittleEndian.PutUint16(b, uint16(v))
+		}, nil
+	case 24:
+		return func(b []byte, v int) {
+			b[0] = byte(v)
+			b[1] = byte(v >> 8)
+			b[2] = byte(v >> 16)
+		}, nil
+	case 32:
+		return func(b []byte, v int) {
+			binary.LittleEndian.PutUint32(b, uint32(v))
+		}, nil
+	default:
+		return nil, fmt.Errorf("can't add frames of bit size %d", bitDepth)
+	}
+}
+
+func (e *Encoder) writeHeader() (err error) {
 	if e.wroteHeader {
 		return errors.New("already wrote header")
 	}
-	e.wroteHeader = true
 	if e == nil {
 		return fmt.Errorf("can't write a nil encoder")
 	}
 	if e.w == nil {
 		return fmt.Errorf("can't write to a nil writer")
 	}
+	if e.Strict {
+		if err := e.checkStrict(); err != nil {
+			return err
+		}
+	}
+	if e.Canonical {
+		if err := e.checkCanonical(); err != nil {
+			return err
+		}
+	}
+	if err := e.checkFormatCombo(); err != nil {
+		return err
+	}
+	if e.ValidBitsPerSample < 0 || e.ValidBitsPerSample > e.BitDepth {
+		return fmt.Errorf("invalid number of valid bits %d for a bit depth of %d", e.ValidBitsPerSample, e.BitDepth)
+	}
+	if err := e.checkHeaderFields(); err != nil {
+		return err
+	}
+	if e.channelMask != 0 && e.channelMask.NumChannels() != e.NumChans {
+		return fmt.Errorf("the speaker layout has %d channels but the encoder has %d", e.channelMask.NumChannels(), e.NumChans)
+	}
+	if e.dataAlign < 0 || e.dataAlign > 1 && e.dataAlign%2 == 1 {
+		return fmt.Errorf("invalid data chunk alignment %d, it must be even", e.dataAlign)
+	}
+	formType := riff.WavFormatID
+	if e.FormType != [4]byte{} {
+		if !validFormType(e.FormType) {
+			return fmt.Errorf("invalid RIFF form type %q", e.FormType[:])
+		}
+		formType = e.FormType
+	}
+	// probe the writer now rather than failing on Close once all the audio
+	// was written
+	if !e.TrailingSizeRecord {
+		if _, err := e.w.Seek(0, io.SeekCurrent); err != nil {
+			return fmt.Errorf("%w: %v", ErrWriterNotSeekable, err)
+		}
+	}
+	e.wroteHeader = true
+
+	if e.BufferWrites {
+		if _, ok := e.w.(*bufferedWriter); !ok {
+			e.w = newBufferedWriter(e.w)
+		}
+	}
 
 	if e.WrittenBytes > 0 {
 		return nil
 	}
+	defer func() {
+		if err != nil {
+			err = e.writeError("header", int64(e.WrittenBytes), err)
+		}
+	}()
 
 	// riff ID
-	if err := e.AddLE(riff.RiffID); err != nil {
+	if _, err := e.AddLE(riff.RiffID); err != nil {
 		return err
 	}
 	// file size uint32, to update later on.
-	if err := e.AddLE(uint32(42)); err != nil {
+	if _, err := e.AddLE(sizePlaceholder); err != nil {
 		return err
 	}
 	// wave headers
-	if err := e.AddLE(riff.WavFormatID); err != nil {
+	if _, err := e.AddLE(formType); err != nil {
 		return err
 	}
+	if e.ReserveDS64 {
+		e.ds64Pos = int64(e.WrittenBytes)
+		if _, err := e.AddLE(junkID); err != nil {
+			return err
+		}
+		if _, err := e.AddLE(uint32(ds64Size)); err != nil {
+			return err
+		}
+		if _, err := e.AddLE(make([]byte, ds64Size)); err != nil {
+			return fmt.Errorf("error reserving the ds64 chunk - %w", err)
+		}
+	}
 	// form
-	if err := e.AddLE(riff.FmtID); err != nil {
+	if _, err := e.AddLE(riff.FmtID); err != nil {
 		return err
 	}
 	// chunk size
-	if err := e.AddLE(uint32(16)); err != nil {
+	fmtSize, audioFormat := 16, e.WavAudioFormat
+	if e.extensible() {
+		fmtSize, audioFormat = 40, FormatExtensible
+	}
+	if _, err := e.AddLE(uint32(fmtSize)); err != nil {
 		return err
 	}
 	// wave format
-	if err := e.AddLE(uint16(e.WavAudioFormat)); err != nil {
+	if _, err := e.AddLE(uint16(audioFormat)); err != nil {
 		return err
 	}
 	// num channels
-	if err := e.AddLE(uint16(e.NumChans)); err != nil {
+	if _, err := e.AddLE(uint16(e.NumChans)); err != nil {
 		return fmt.Errorf("error encoding the number of channels - %w", err)
 	}
 	// samplerate
-	if err := e.AddLE(uint32(e.SampleRate)); err != nil {
+	if _, err := e.AddLE(uint32(e.SampleRate)); err != nil {
 		return fmt.Errorf("error encoding the sample rate - %w", err)
 	}
-	blockAlign := e.NumChans * e.BitDepth / 8
 	// avg bytes per sec
-	if err := e.AddLE(uint32(e.SampleRate * blockAlign)); err != nil {
+	if _, err := e.AddLE(uint32(e.headerByteRate())); err != nil {
 		return fmt.Errorf("error encoding the avg bytes per sec - %w", err)
 	}
 	// block align
-	if err := e.AddLE(uint16(blockAlign)); err != nil {
+	if _, err := e.AddLE(uint16(e.headerBlockAlign())); err != nil {
 		return err
 	}
 	// bits per sample
-	if err := e.AddLE(uint16(e.BitDepth)); err != nil {
+	if _, err := e.AddLE(uint16(e.BitDepth)); err != nil {
 		return fmt.Errorf("error encoding bits per sample - %w", err)
 	}
+	if e.extensible() {
+		if err := e.writeFmtExtension(); err != nil {
+			return fmt.Errorf("error encoding the fmt extension - %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeFmtExtension writes the WAVE_FORMAT_EXTENSIBLE fields of the fmt
+// chunk: the extension size, the valid bits per sample, the channel mask (no
+// speaker assignment unless set by SetChannelLayout) and the sub format GUID.
+func (e *Encoder) writeFmtExtension() error {
+	if _, err := e.AddLE(uint16(22)); err != nil {
+		return err
+	}
+	validBits, subFormatCode := e.BitDepth, e.WavAudioFormat
+	if e.packed() {
+		validBits = e.ValidBitsPerSample
+	}
+	if subFormatCode == FormatExtensible {
+		subFormatCode = FormatPCM
+	}
+	if _, err := e.AddLE(uint16(validBits)); err != nil {
+		return err
+	}
+	if _, err := e.AddLE(uint32(e.channelMask)); err != nil {
+		return err
+	}
+	// KSDATAFORMAT_SUBTYPE GUIDs only differ by their first 2 bytes which
+	// hold the audio format.
+	subFormat := [16]byte{0, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xAA, 0, 0x38, 0x9B, 0x71}
+	binary.LittleEndian.PutUint16(subFormat[:], uint16(subFormatCode))
+	_, err := e.AddLE(subFormat)
+	return err
+}
+
+// canonicalHeaderSize is the size of the classic header, see Canonical.
+const canonicalHeaderSize = 44
+
+// checkCanonical verifies that no option adds bytes before the audio, see
+// Canonical.
+func (e *Encoder) checkCanonical() error {
+	if e.ReserveDS64 {
+		return errors.New("a canonical header can't reserve a ds64 chunk")
+	}
+	if e.extensible() {
+		return errors.New("a canonical header can't have a WAVE_FORMAT_EXTENSIBLE fmt chunk")
+	}
+	if e.dataAlign > 1 && canonicalHeaderSize%e.dataAlign != 0 {
+		return fmt.Errorf("a canonical header can't align the data chunk on %d bytes", e.dataAlign)
+	}
+	return nil
+}
+
+// checkHeaderFields verifies that the values of the fmt chunk fit in their
+// fields instead of silently wrapping.
+func (e *Encoder) checkHeaderFields() error {
+	for _, f := range []struct {
+		name  string
+		value int64
+		max   int64
+	}{
+		{"number of channels", int64(e.NumChans), math.MaxUint16},
+		{"sample rate", int64(e.SampleRate), math.MaxUint32},
+		{"avg bytes per sec", e.headerByteRate(), math.MaxUint32},
+		{"block align", e.headerBlockAlign(), math.MaxUint16},
+		{"bits per sample", int64(e.BitDepth), math.MaxUint16},
+	} {
+		if f.value < 0 || f.value > f.max {
+			return fmt.Errorf("%w: %s %d", ErrSizeOverflow, f.name, f.value)
+		}
+	}
+	return nil
+}
+
+// headerBlockAlign returns the block align written in the fmt chunk, the
+// size of a frame unless overridden by SetBlockAlign.
+func (e *Encoder) headerBlockAlign() int64 {
+	if e.blockAlign != 0 {
+		return int64(e.blockAlign)
+	}
+	return int64(e.NumChans) * int64(e.BitDepth/8)
+}
+
+// headerByteRate returns the avg bytes per sec written in the fmt chunk,
+// derived from the block align unless overridden by SetByteRate.
+func (e *Encoder) headerByteRate() int64 {
+	if e.byteRate != 0 {
+		return int64(e.byteRate)
+	}
+	return int64(e.SampleRate) * e.headerBlockAlign()
+}
+
+// SetBlockAlign overrides the block align field of the fmt chunk, which is
+// otherwise the size of a frame, for formats whose blocks hold several
+// frames or to test the robustness of decoders. It only changes the header,
+// the audio is still serialized according to the bit depth. 0 restores the
+// computed value. It must be called before writing.
+func (e *Encoder) SetBlockAlign(blockAlign int) {
+	e.blockAlign = blockAlign
+}
+
+// SetByteRate overrides the avg bytes per sec field of the fmt chunk, which
+// is otherwise the sample rate times the block align, see SetBlockAlign. 0
+// restores the computed value. It must be called before writing.
+func (e *Encoder) SetByteRate(byteRate int) {
+	e.byteRate = byteRate
+}
+
+// formatBitDepths lists the valid bit depths of the known audio formats.
+var formatBitDepths = map[int][]int{
+	FormatPCM:        {8, 16, 24, 32},
+	FormatIEEEFloat:  {32, 64},
+	FormatALaw:       {8},
+	FormatMuLaw:      {8},
+	FormatExtensible: {8, 16, 24, 32},
+}
+
+// checkFormatCombo verifies that the bit depth is valid for the audio format.
+// Unknown audio formats aren't checked.
+func (e *Encoder) checkFormatCombo() error {
+	bitDepths, ok := formatBitDepths[e.WavAudioFormat]
+	if !ok {
+		return nil
+	}
+	for _, b := range bitDepths {
+		if b == e.BitDepth {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %d bits with audio format %d, valid combinations are PCM (1) and extensible (0xFFFE) with 8, 16, 24 or 32 bits, IEEE float (3) with 32 or 64 bits, A-law (6) and mu-law (7) with 8 bits",
+		ErrInvalidFormatCombo, e.BitDepth, e.WavAudioFormat)
+}
 
+// checkStrict verifies that the encoder configuration is strictly conformant,
+// see the Strict field for the list of enforced rules.
+func (e *Encoder) checkStrict() error {
+	switch e.BitDepth {
+	case 8, 16, 24, 32:
+	default:
+		return fmt.Errorf("%w: bit depth %d isn't a multiple of 8 supported by the encoder", ErrNonConformant, e.BitDepth)
+	}
+	if e.SampleRate <= 0 {
+		return fmt.Errorf("%w: invalid sample rate %d", ErrNonConformant, e.SampleRate)
+	}
+	if e.NumChans <= 0 {
+		return fmt.Errorf("%w: invalid number of channels %d", ErrNonConformant, e.NumChans)
+	}
+	switch e.WavAudioFormat {
+	case FormatPCM:
+	case FormatExtensible:
+		if e.channelMask == 0 {
+			return fmt.Errorf("%w: WAVE_FORMAT_EXTENSIBLE requires a channel mask which isn't set", ErrNonConformant)
+		}
+	default:
+		return fmt.Errorf("%w: audio format %d requires a fact chunk which isn't written", ErrNonConformant, e.WavAudioFormat)
+	}
+	if e.NumChans > 2 && e.channelMask == 0 {
+		return fmt.Errorf("%w: %d channels require WAVE_FORMAT_EXTENSIBLE and a channel mask", ErrNonConformant, e.NumChans)
+	}
+	frameSize := int64(e.NumChans) * int64(e.BitDepth/8)
+	if e.headerBlockAlign() != frameSize || e.headerByteRate() != int64(e.SampleRate)*frameSize {
+		return fmt.Errorf("%w: the block align %d and avg bytes per sec %d don't match the format", ErrNonConformant, e.headerBlockAlign(), e.headerByteRate())
+	}
 	return nil
 }
 
 // Write encodes and writes the passed buffer to the underlying writer.
 // Don't forget to Close() the encoder or the file won't be valid.
+// The samples are written as is and must follow the wav conventions: 8 bit
+// samples are unsigned, silence being 128 (see SignedToUnsigned8), while 16,
+// 24 and 32 bit samples are signed, silence being 0. Samples out of the range
+// of the bit depth are handled according to Overflow.
+// Writing a buffer without samples is a no-op: the header and the data chunk
+// are only written by the first write carrying audio.
 func (e *Encoder) Write(buf *audio.IntBuffer) error {
+	if buf != nil && len(buf.Data) == 0 {
+		e.lock()
+		defer e.unlock()
+		if e.w == nil {
+			return errReleased
+		}
+		return nil
+	}
+	if e.UpmixMono && buf != nil {
+		var err error
+		if buf, err = e.upmix(buf); err != nil {
+			return err
+		}
+	}
 	if err := e.writeSetup(); err != nil {
 		return err
 	}
+	if e.dcBlocker != nil && buf != nil {
+		buf = e.blockDC(buf)
+	}
 
 	_, err := e.addBuffer(buf, nil)
 	return err
 }
 
+// WriteFromChan writes the buffers received from ch until the channel is
+// closed or ctx is done, in which case ctx.Err() is returned. A write error
+// stops the consumption and is returned, the remaining buffers are left in
+// the channel. Don't forget to Close() the encoder afterwards.
+func (e *Encoder) WriteFromChan(ctx context.Context, ch <-chan *audio.IntBuffer) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case buf, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			// both cases can be ready at once, don't write after cancelation
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := e.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WriteAt encodes and writes the passed buffer at the passed byte position in
+// the data chunk, overwriting the frames already written there. Writing past
+// the end of the data extends it: the gap, if any, is filled with silence and
+// the frame count is advanced to the new end. Regions can thus be written in
+// any order, Close sizing the data chunk to cover the highest frame written.
+// The position must be a multiple of the frame size.
 func (e *Encoder) WriteAt(buf *audio.IntBuffer, pos int64) (int64, error) {
+	blockAlign := int64(e.NumChans * e.BitDepth / 8)
+	if blockAlign <= 0 {
+		return 0, fmt.Errorf("invalid frame size of %d channels of %d bits", e.NumChans, e.BitDepth)
+	}
+	if pos < 0 || pos%blockAlign != 0 {
+		return 0, fmt.Errorf("can't write at byte %d which isn't the start of a frame of %d bytes", pos, blockAlign)
+	}
 	if err := e.writeSetup(); err != nil {
 		return 0, err
 	}
@@ -215,112 +1421,633 @@ func (e *Encoder) WriteAt(buf *audio.IntBuffer, pos int64) (int64, error) {
 	return e.addBuffer(buf, &pos)
 }
 
+// fillGap writes silence from the end of the written data up to the passed
+// offset so extending the data chunk doesn't leave undefined bytes, some
+// writers not zero filling sparse regions.
+func (e *Encoder) fillGap(offset int64) error {
+	e.lock()
+	end := int64(e.WrittenBytes)
+	e.unlock()
+	if offset <= end {
+		return nil
+	}
+	fill := make([]byte, offset-end)
+	if e.BitDepth == 8 {
+		// 8 bit samples are unsigned
+		for i := range fill {
+			fill[i] = 128
+		}
+	}
+	if _, err := e.w.WriteAt(fill, end); err != nil {
+		return e.writeError("data", end, fmt.Errorf("failed to fill the gap before the written frames - %w", err))
+	}
+	return nil
+}
+
+// WriteAtFrame overwrites the already written frames starting at the passed
+// frame index with the content of the passed buffer. The buffer must contain
+// whole frames and can't extend past the written frames.
+func (e *Encoder) WriteAtFrame(buf *audio.IntBuffer, frameIndex int64) (int64, error) {
+	if buf == nil {
+		return 0, fmt.Errorf("can't add a nil buffer")
+	}
+	if buf.Format == nil || buf.Format.NumChannels != e.NumChans || len(buf.Data)%e.NumChans != 0 {
+		return 0, fmt.Errorf("the buffer doesn't contain whole frames of %d channels", e.NumChans)
+	}
+	e.lock()
+	frames := int64(e.frames)
+	e.unlock()
+	if end := frameIndex + int64(buf.NumFrames()); frameIndex < 0 || end > frames {
+		return 0, fmt.Errorf("can't write frames %d to %d, only %d frames were written", frameIndex, end, frames)
+	}
+
+	return e.WriteAt(buf, frameIndex*int64(e.NumChans*e.BitDepth/8))
+}
+
+// WriteAtDuration overwrites the already written frames starting at the
+// passed time offset, for instance to punch in a take, like WriteAtFrame. The
+// offset is rounded to the nearest frame since frame boundaries rarely fall
+// on whole nanoseconds, see DurationForFrames to address a frame exactly.
+func (e *Encoder) WriteAtDuration(buf *audio.IntBuffer, at time.Duration) (int64, error) {
+	if at < 0 {
+		return 0, fmt.Errorf("can't write at the negative offset %s", at)
+	}
+	if e.SampleRate <= 0 {
+		return 0, fmt.Errorf("invalid sample rate %d", e.SampleRate)
+	}
+	// round to the nearest frame
+	frame := FramesForDuration(at+time.Second/time.Duration(2*e.SampleRate), e.SampleRate)
+	return e.WriteAtFrame(buf, int64(frame))
+}
+
 func (e *Encoder) writeSetup() error {
-	e.mu.Lock()
+	e.lock()
+	if e.w == nil {
+		e.unlock()
+		return errReleased
+	}
 	if !e.wroteHeader {
 		if err := e.writeHeader(); err != nil {
-			e.mu.Unlock()
+			e.unlock()
 			return err
 		}
 	}
 
 	if !e.pcmChunkStarted {
-		// sound header
-		if err := e.AddLE(riff.DataFormatID); err != nil {
-			e.mu.Unlock()
-			return fmt.Errorf("error encoding sound header %w", err)
+		if err := e.writeDataChunkHeader(); err != nil {
+			e.unlock()
+			return err
 		}
-		e.pcmChunkStarted = true
+	}
+	e.unlock()
+
+	return nil
+}
 
-		// write a temporary chunksize
-		e.pcmChunkSizePos = e.WrittenBytes
-		if err := e.AddLE(uint32(42)); err != nil {
-			e.mu.Unlock()
-			return fmt.Errorf("%w when writing wav data chunk size header", err)
+// writeDataChunkHeader writes the header of the data chunk with a temporary
+// size, preceded by a JUNK chunk if the audio data has to be aligned.
+func (e *Encoder) writeDataChunkHeader() error {
+	if e.dataAlign > 1 && (e.WrittenBytes+8)%e.dataAlign != 0 {
+		// the JUNK chunk header and the data chunk header both take 8 bytes
+		pad := (e.dataAlign - (e.WrittenBytes+16)%e.dataAlign) % e.dataAlign
+		if err := e.writeChunk(junkID, make([]byte, pad)); err != nil {
+			return e.writeError("header", int64(e.WrittenBytes), fmt.Errorf("error writing the alignment padding - %w", err))
 		}
+	}
+	// sound header
+	if _, err := e.AddLE(riff.DataFormatID); err != nil {
+		return e.writeError("header", int64(e.WrittenBytes), fmt.Errorf("error encoding sound header %w", err))
+	}
+	e.pcmChunkStarted = true
 
-		e.pcmChunkPos = int64(e.WrittenBytes)
+	// write a temporary chunksize
+	e.pcmChunkSizePos = e.WrittenBytes
+	if _, err := e.AddLE(sizePlaceholder); err != nil {
+		return e.writeError("header", int64(e.WrittenBytes), fmt.Errorf("%w when writing wav data chunk size header", err))
 	}
-	e.mu.Unlock()
+	e.dataHeaderWritten = true
 
+	e.pcmChunkPos = int64(e.WrittenBytes)
 	return nil
 }
 
+// AlignDataChunk makes the audio data start on a multiple of boundary bytes
+// from the start of the file, as required by some authoring tools. A JUNK
+// chunk sized from the offset reached after the header is inserted before the
+// data chunk when needed. Chunks being word aligned, boundary must be even.
+// It must be called before writing.
+func (e *Encoder) AlignDataChunk(boundary int) {
+	e.dataAlign = boundary
+}
+
 // WriteFrame writes a single frame of data to the underlying writer.
 func (e *Encoder) WriteFrame(value interface{}) error {
+	if e.w == nil {
+		return errReleased
+	}
 	if !e.wroteHeader {
-		e.writeHeader()
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
 	}
 	if !e.pcmChunkStarted {
-		// sound header
-		if err := e.AddLE(riff.DataFormatID); err != nil {
-			return fmt.Errorf("error encoding sound header %w", err)
+		if err := e.writeDataChunkHeader(); err != nil {
+			return err
 		}
-		e.pcmChunkStarted = true
+	}
 
-		// write a temporary chunksize
-		e.pcmChunkSizePos = e.WrittenBytes
-		if err := e.AddLE(uint32(42)); err != nil {
-			return fmt.Errorf("%w when writing wav data chunk size header", err)
+	if _, err := e.AddLE(value); err != nil {
+		return e.writeError("data", int64(e.WrittenBytes), err)
+	}
+	e.frames++
+	e.keepTail()
+	return e.updateLiveHeader()
+}
+
+// WriteFrames writes the passed interleaved samples, made of whole frames, in
+// a single write to the underlying writer, saving the overhead of calling
+// WriteFrame for each sample. Like WriteFrame, the samples are written as is.
+// The type of the slice must match the bit depth: []uint8 for 8 bit, []int16
+// for 16 bit and []int32 for 24 and 32 bit, 24 bit samples being written on
+// their 3 low bytes.
+func (e *Encoder) WriteFrames(samples interface{}) error {
+	var (
+		n   int
+		put func(b []byte, i int)
+	)
+	switch s := samples.(type) {
+	case []uint8:
+		if e.BitDepth == 8 {
+			n, put = len(s), func(b []byte, i int) { b[0] = s[i] }
 		}
+	case []int16:
+		if e.BitDepth == 16 {
+			n, put = len(s), func(b []byte, i int) { binary.LittleEndian.PutUint16(b, uint16(s[i])) }
+		}
+	case []int32:
+		switch e.BitDepth {
+		case 24:
+			n, put = len(s), func(b []byte, i int) {
+				b[0], b[1], b[2] = byte(s[i]), byte(s[i]>>8), byte(s[i]>>16)
+			}
+		case 32:
+			n, put = len(s), func(b []byte, i int) { binary.LittleEndian.PutUint32(b, uint32(s[i])) }
+		}
+	}
+	if put == nil {
+		return fmt.Errorf("can't write samples of type %T to a %d bit encoder", samples, e.BitDepth)
+	}
+	if e.NumChans < 1 || n%e.NumChans != 0 {
+		return fmt.Errorf("%d samples aren't whole frames of %d channels", n, e.NumChans)
+	}
+	if err := e.writeSetup(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
 	}
 
-	e.frames++
-	return e.AddLE(value)
+	pool := e.buffers()
+	binaryBuf := pool.Get().(*bytes.Buffer)
+	defer func() {
+		binaryBuf.Reset()
+		pool.Put(binaryBuf)
+	}()
+	size := e.BitDepth / 8
+	binaryBuf.Grow(n * size)
+	out := binaryBuf.Bytes()[:n*size]
+	for i := 0; i < n; i++ {
+		put(out[i*size:], i)
+	}
+	_, err := e.addBytes(out, n/e.NumChans)
+	e.keepTail()
+	return err
+}
+
+// EnableLiveHeaderUpdates makes the encoder patch the RIFF and data chunk
+// sizes each time interval worth of frames got written, so a file being
+// recorded can be read up to the last update without waiting for Close. Each
+// update costs two positioned writes. A non positive interval disables the
+// updates.
+func (e *Encoder) EnableLiveHeaderUpdates(interval time.Duration) {
+	e.liveInterval = 0
+	if interval > 0 {
+		e.liveInterval = FramesForDuration(interval, e.SampleRate)
+		if e.liveInterval < 1 {
+			e.liveInterval = 1
+		}
+	}
 }
 
-func (e *Encoder) writeMetadata() error {
-	chunkData := encodeInfoChunk(e)
-	if err := e.AddBE(CIDList); err != nil {
-		return fmt.Errorf("failed to write the LIST chunk ID: %w", err)
+// updateLiveHeader patches the sizes of the header if live header updates
+// are enabled and an interval elapsed since the last update. Files too large
+// for the RIFF sizes are left to Close.
+func (e *Encoder) updateLiveHeader() error {
+	if e.liveInterval <= 0 || e.TrailingSizeRecord || !e.dataHeaderWritten || e.frames-e.liveFrames < e.liveInterval {
+		return nil
+	}
+	if int64(e.WrittenBytes)-8 > maxRIFFSize {
+		return nil
 	}
-	if err := e.AddLE(uint32(len(chunkData))); err != nil {
-		return fmt.Errorf("failed to write the LIST chunk size: %w", err)
+	e.liveFrames = e.frames
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(e.WrittenBytes-8))
+	if _, err := e.w.WriteAt(b, 4); err != nil {
+		return e.writeError("header", 4, fmt.Errorf("%w when updating the total written bytes", err))
 	}
-	return e.AddBE(chunkData)
+	binary.LittleEndian.PutUint32(b, uint32(e.BitDepth/8*e.NumChans*e.frames))
+	if _, err := e.w.WriteAt(b, int64(e.pcmChunkSizePos)); err != nil {
+		return e.writeError("header", int64(e.pcmChunkSizePos), fmt.Errorf("%w when updating the data chunk size", err))
+	}
+	return nil
+}
+
+// Truncate discards the frames written after the passed frame count so they
+// aren't accounted for when the file gets closed. If the underlying writer
+// supports it (like *os.File does), it gets truncated too, otherwise the
+// discarded bytes are left past the end of the RIFF container and possibly
+// overwritten by the chunks written on Close.
+// Truncating to more frames than were written is an error.
+func (e *Encoder) Truncate(frames int) error {
+	e.lock()
+	defer e.unlock()
+	if frames < 0 || frames > e.frames {
+		return fmt.Errorf("can't truncate to %d frames, only %d frames were written", frames, e.frames)
+	}
+	if e.w == nil {
+		return errReleased
+	}
+	if !e.pcmChunkStarted {
+		return nil
+	}
+	end := e.pcmChunkPos + int64(frames*e.NumChans*e.BitDepth/8)
+	if t, ok := e.underlying().(interface{ Truncate(size int64) error }); ok {
+		if err := e.flush(); err != nil {
+			return err
+		}
+		if err := t.Truncate(end); err != nil {
+			return fmt.Errorf("failed to truncate the underlying writer - %w", err)
+		}
+	}
+	if _, err := e.w.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	e.frames = frames
+	e.WrittenBytes = int(end)
+	if e.trim != nil && e.trim.end > frames {
+		e.trim.end = frames
+	}
+	return nil
+}
+
+// writeChunk writes a whole chunk at the current position using a ChunkWriter.
+// The size is known upfront so the chunk is written sequentially, without
+// patching its header, which writers streaming the file require.
+func (e *Encoder) writeChunk(id [4]byte, data []byte) error {
+	cw := &ChunkWriter{w: e.w, offset: int64(e.WrittenBytes)}
+	defer func() { e.WrittenBytes = int(cw.Offset()) }()
+	if err := cw.BeginSizedChunk(id, int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := cw.Write(data); err != nil {
+		return fmt.Errorf("failed to write the %s chunk data - %w", id, err)
+	}
+	return cw.EndChunk()
+}
+
+// writeLists writes the LIST chunks, each one being a separate chunk: the
+// INFO list holding the metadata followed by the adtl list holding the labels
+// of the passed cue points, if any.
+func (e *Encoder) writeLists(points []*CuePoint) error {
+	info, err := encodeInfoChunk(e)
+	if err != nil {
+		return err
+	}
+	var lists [][]byte
+	if info != nil {
+		lists = append(lists, info)
+	}
+	if adtl := encodeAdtlChunk(points); adtl != nil {
+		lists = append(lists, adtl)
+	}
+	for _, list := range lists {
+		if _, err := checkedSize(int64(len(list)), "LIST chunk size"); err != nil {
+			return err
+		}
+		if err := e.writeChunk(CIDList, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetadataBytes returns the number of bytes of the metadata chunks (cue,
+// bext, LIST and DISP) written after the audio data on Close, including their
+// headers and pad bytes. The data chunk, with its pad byte if its size is
+// odd, ends and the metadata begins at WrittenBytes - MetadataBytes. It
+// returns 0 before Close or when no metadata was written.
+func (e *Encoder) MetadataBytes() int {
+	return e.metadataBytes
+}
+
+// IsPlayable reports whether the header and the start of the data chunk
+// reached the writer, so a reader can begin playing the file before Close.
+// Until Close, the data chunk size is the 0xFFFFFFFF placeholder which readers
+// interpret as "read until EOF", see EnableLiveHeaderUpdates to keep the sizes
+// current. With BufferWrites, it stays false until the buffer holding the
+// header is flushed.
+func (e *Encoder) IsPlayable() bool {
+	e.lock()
+	defer e.unlock()
+	if e.w == nil || !e.wroteHeader || !e.pcmChunkStarted {
+		return false
+	}
+	written := int64(e.WrittenBytes)
+	if bw, ok := e.w.(*bufferedWriter); ok {
+		written -= int64(bw.buf.Buffered())
+	}
+	return written >= e.pcmChunkPos
+}
+
+// SetDisplayTitle sets the title written in a DISP chunk on Close. Windows
+// uses this chunk to show a friendly name for the file.
+func (e *Encoder) SetDisplayTitle(title string) {
+	e.displayTitle = title
+}
+
+// defaultSoftwareTag is the software tag used when WithSoftwareTag is passed
+// an empty name.
+const defaultSoftwareTag = "github.com/calebmcelroy/wav"
+
+// WithSoftwareTag makes the encoder write the passed software name (and
+// version) in the ISFT field of the INFO chunk so files produced by this
+// package can be identified. The package name is used if name is empty. The
+// tag is only written when Metadata is set and doesn't override a Software
+// value set by the user.
+func (e *Encoder) WithSoftwareTag(name string) {
+	if name == "" {
+		name = defaultSoftwareTag
+	}
+	e.softwareTag = name
+}
+
+// SetEncoderName sets the name (and version) of the software generating the
+// file, some applications rely on it to handle generator specific quirks. The
+// name is written in the ISFT field of the INFO chunk, even if Metadata isn't
+// set, unless Metadata.Software is set. It takes precedence over
+// WithSoftwareTag. If a vendor chunk ID is passed, the name is also written
+// as a null terminated string in a chunk with that ID, for applications
+// reading the generator from a private chunk.
+func (e *Encoder) SetEncoderName(name string, vendorChunkID ...[4]byte) {
+	e.encoderName = name
+	e.encoderChunkID = [4]byte{}
+	if len(vendorChunkID) > 0 {
+		e.encoderChunkID = vendorChunkID[0]
+	}
+}
+
+func (e *Encoder) writeDisplayTitle() error {
+	data := make([]byte, 4, 4+len(e.displayTitle)+1)
+	// CF_TEXT data is a null terminated string
+	binary.LittleEndian.PutUint32(data, 1)
+	data = append(data, e.displayTitle...)
+	return e.writeChunk(CIDDisp, append(data, 0x00))
+}
+
+// upgradeToRF64 converts the file to RF64, replacing the reserved JUNK chunk
+// by a ds64 chunk holding the 64 bit sizes. The 32 bit sizes are set to
+// 0xFFFFFFFF as required by RF64.
+func (e *Encoder) upgradeToRF64(dataSize int64) error {
+	if _, err := e.w.WriteAt(append(rf64ID[:], 0xFF, 0xFF, 0xFF, 0xFF), 0); err != nil {
+		return err
+	}
+	ds64 := make([]byte, 8+ds64Size)
+	copy(ds64, CIDDs64[:])
+	binary.LittleEndian.PutUint32(ds64[4:], ds64Size)
+	binary.LittleEndian.PutUint64(ds64[8:], uint64(e.WrittenBytes-8))
+	binary.LittleEndian.PutUint64(ds64[16:], uint64(dataSize))
+	binary.LittleEndian.PutUint64(ds64[24:], uint64(e.frames))
+	// the table length is left to 0
+	if _, err := e.w.WriteAt(ds64, e.ds64Pos); err != nil {
+		return err
+	}
+	if e.dataHeaderWritten {
+		if _, err := e.w.WriteAt([]byte{0xFF, 0xFF, 0xFF, 0xFF}, int64(e.pcmChunkSizePos)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Close flushes the content to disk, make sure the headers are up to date
-// Note that the underlying writer is NOT being closed.
+// Close flushes the content to disk, make sure the headers are up to date.
+// Until Close is called, the RIFF and data chunk sizes are set to 0xFFFFFFFF.
+// Note that the underlying writer is NOT being closed, use CloseWriter for that.
 func (e *Encoder) Close() error {
 	if e == nil || e.w == nil {
 		return nil
 	}
+	if !e.wroteHeader {
+		// nothing was written, still produce a valid empty file
+		if err := e.writeSetup(); err != nil {
+			return err
+		}
+	}
 
+	if e.trim != nil && e.trim.end < e.frames {
+		if err := e.Truncate(e.trim.end); err != nil {
+			return fmt.Errorf("failed to trim the trailing silence - %w", err)
+		}
+	}
+	if err := e.padDataChunk(); err != nil {
+		return e.writeError("data", int64(e.WrittenBytes), fmt.Errorf("failed to write the pad byte - %w", err))
+	}
+	metadataStart := e.WrittenBytes
+	points := e.cuePoints()
+	if len(points) > 0 {
+		if err := e.writeChunk(CIDCue, encodeCueChunk(points)); err != nil {
+			return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the cue chunk - %w", err))
+		}
+	}
+	if bext := e.bextChunk(); bext != nil {
+		if err := e.writeChunk(CIDBext, encodeBextChunk(bext)); err != nil {
+			return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the bext chunk - %w", err))
+		}
+	}
+	if iXML := e.iXMLChunk(); iXML != nil {
+		if err := e.writeChunk(CIDIXML, iXML); err != nil {
+			return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the iXML chunk - %w", err))
+		}
+	}
 	// inject metadata at the end to not trip implementation not supporting
 	// metadata chunks
-	if e.Metadata != nil {
-		if err := e.writeMetadata(); err != nil {
-			return fmt.Errorf("failed to write metadata - %w", err)
+	if err := e.writeLists(points); err != nil {
+		return e.writeError("metadata", int64(e.WrittenBytes), err)
+	}
+	if e.encoderName != "" && e.encoderChunkID != [4]byte{} {
+		if err := e.writeChunk(e.encoderChunkID, append([]byte(e.encoderName), 0x00)); err != nil {
+			return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the %s chunk - %w", e.encoderChunkID, err))
 		}
 	}
-
-	// go back and write total size in header
-	if _, err := e.w.Seek(4, 0); err != nil {
-		return err
+	if e.overview != nil {
+		if data := e.overview.encode(e.frames); data != nil {
+			if err := e.writeChunk(CIDOvwf, data); err != nil {
+				return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the overview chunk - %w", err))
+			}
+		}
 	}
-	if err := e.AddLE(uint32(e.WrittenBytes) - 8); err != nil {
-		return fmt.Errorf("%w when writing the total written bytes", err)
+	if e.displayTitle != "" {
+		if err := e.writeDisplayTitle(); err != nil {
+			return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the display title - %w", err))
+		}
+	}
+	if resU := e.resUChunk(); resU != nil {
+		if err := e.writeChunk(CIDResU, resU); err != nil {
+			return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the ResU chunk - %w", err))
+		}
+	}
+	if gapless := e.gaplessInfo(); gapless != nil {
+		if err := e.writeChunk(CIDGapl, encodeGaplessChunk(gapless)); err != nil {
+			return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the gapless chunk - %w", err))
+		}
 	}
+	e.metadataBytes = e.WrittenBytes - metadataStart
 
-	// rewrite the audio chunk length header
-	if e.pcmChunkSizePos > 0 {
-		if _, err := e.w.Seek(int64(e.pcmChunkSizePos), 0); err != nil {
-			return err
+	dataSize := int64(e.BitDepth/8*e.NumChans) * int64(e.frames)
+	if e.TrailingSizeRecord {
+		if err := e.writeSizeRecord(dataSize); err != nil {
+			return e.writeError("metadata", int64(e.WrittenBytes), fmt.Errorf("failed to write the size record - %w", err))
+		}
+		return e.sync()
+	}
+	if e.ReserveDS64 && (int64(e.WrittenBytes)-8 > maxRIFFSize || dataSize > maxRIFFSize) {
+		if err := e.upgradeToRF64(dataSize); err != nil {
+			return e.writeError("header", 0, fmt.Errorf("failed to upgrade the file to RF64 - %w", err))
 		}
-		chunksize := uint32((int(e.BitDepth) / 8) * int(e.NumChans) * e.frames)
-		if err := e.AddLE(uint32(chunksize)); err != nil {
-			return fmt.Errorf("%w when writing wav data chunk size header", err)
+	} else {
+		riffSize, err := checkedSize(int64(e.WrittenBytes)-8, "RIFF size")
+		if err != nil {
+			return fmt.Errorf("%w, set ReserveDS64 to write larger files", err)
+		}
+		chunkSize, err := checkedSize(dataSize, "data chunk size")
+		if err != nil {
+			return fmt.Errorf("%w, set ReserveDS64 to write larger files", err)
+		}
+		// go back and write total size in header
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, riffSize)
+		if _, err := e.w.WriteAt(b, 4); err != nil {
+			return e.writeError("header", 4, fmt.Errorf("%w when writing the total written bytes", err))
+		}
+
+		// rewrite the audio chunk length header
+		if e.dataHeaderWritten {
+			binary.LittleEndian.PutUint32(b, chunkSize)
+			if _, err := e.w.WriteAt(b, int64(e.pcmChunkSizePos)); err != nil {
+				return e.writeError("header", int64(e.pcmChunkSizePos), fmt.Errorf("%w when writing wav data chunk size header", err))
+			}
 		}
 	}
 
-	// jump back to the end of the file.
-	if _, err := e.w.Seek(0, 2); err != nil {
+	// jump back to the end of the written data, which isn't the end of the
+	// file for pre-sized writers.
+	if _, err := e.w.Seek(int64(e.WrittenBytes), io.SeekStart); err != nil {
 		return err
 	}
-	switch e.w.(type) {
+	return e.sync()
+}
+
+// validFormType reports whether the passed RIFF form type can be written,
+// see FormType.
+func validFormType(formType [4]byte) bool {
+	for _, c := range formType {
+		if c < 0x20 || c > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// padDataChunk writes the pad byte following an odd sized data chunk, so the
+// chunks written after it stay word aligned. The pad byte isn't included in
+// the data chunk size.
+func (e *Encoder) padDataChunk() error {
+	if !e.pcmChunkStarted || (e.BitDepth/8*e.NumChans*e.frames)%2 == 0 {
+		return nil
+	}
+	n, err := e.w.Write([]byte{0})
+	e.WrittenBytes += n
+	return err
+}
+
+// sync flushes the buffered writes and commits files to stable storage.
+func (e *Encoder) sync() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+	switch w := e.underlying().(type) {
 	case *os.File:
-		return e.w.(*os.File).Sync()
+		return w.Sync()
+	}
+	return nil
+}
+
+// underlying returns the writer passed to the encoder, unwrapping the buffer
+// added by BufferWrites.
+func (e *Encoder) underlying() WriterAtSeeker {
+	if bw, ok := e.w.(*bufferedWriter); ok {
+		return bw.w
+	}
+	return e.w
+}
+
+// flush writes the bytes buffered because of BufferWrites.
+func (e *Encoder) flush() error {
+	if bw, ok := e.w.(*bufferedWriter); ok {
+		return bw.Flush()
+	}
+	return nil
+}
+
+// errReleased is returned when writing with a released encoder.
+var errReleased = errors.New("can't write with a released encoder")
+
+// Release drops the references the encoder holds to its writer, buffer pool,
+// metadata and analysis state so they can be garbage collected even if the
+// encoder itself stays referenced, for instance in a pool of long-lived
+// objects. It is meant to be called after Close: the encoder is unusable
+// afterwards, writes fail and Close does nothing. The counters such as
+// WrittenBytes stay available.
+func (e *Encoder) Release() {
+	e.lock()
+	defer e.unlock()
+	e.w = nil
+	// the pool is created again if needed
+	e.bufPool = nil
+	e.poolOnce = sync.Once{}
+	e.Metadata = nil
+	e.iXML = nil
+	e.resU = nil
+	e.gapless = nil
+	e.dither = nil
+	e.shapingErr = nil
+	e.dcBlocker = nil
+	e.silence = nil
+	e.trim = nil
+	e.overview = nil
+	e.loudness = nil
+}
+
+// CloseWriter finalizes the file like Close and then closes the underlying
+// writer if it implements io.Closer.
+func (e *Encoder) CloseWriter() error {
+	if err := e.Close(); err != nil {
+		return err
+	}
+	if e == nil || e.w == nil {
+		return nil
+	}
+	if c, ok := e.underlying().(io.Closer); ok {
+		return c.Close()
 	}
 	return nil
 }
@@ -1,9 +1,24 @@
 package wav
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
 	"path"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/calebmcelroy/wav/wavtest"
+	"github.com/go-audio/audio"
 )
 
 func TestEncoderRoundTrip(t *testing.T) {
@@ -21,6 +36,7 @@ func TestEncoderRoundTrip(t *testing.T) {
 			Artist: "Matt", Copyright: "copyleft", Comments: "A comment", CreationDate: "2017-12-12", Engineer: "Matt A", Technician: "Matt Aimonetti",
 			Genre: "test", Keywords: "go code", Medium: "Virtual", Title: "Titre", Product: "go-audio", Subject: "wav codec",
 			Software: "go-audio codec", Source: "Audacity generator", Location: "Los Angeles", TrackNbr: "42",
+			Commissioned: "go-audio", Language: "English", Part: "1/2", SourceForm: "sampling CD",
 		}, "1 ch,  44100 Hz, 8-bit unsigned integer"},
 		{"fixtures/32bit.wav", "testOutput/32bit.wav", nil, "1 ch, 44100 Hz, 32-bit little-endian signed integer"},
 	}
@@ -123,6 +139,18 @@ func TestEncoderRoundTrip(t *testing.T) {
 				if tc.metadata.TrackNbr != nd.Metadata.TrackNbr {
 					t.Errorf("expected TrackNbr to be %s, but was %s", tc.metadata.TrackNbr, nd.Metadata.TrackNbr)
 				}
+				if tc.metadata.Commissioned != nd.Metadata.Commissioned {
+					t.Errorf("expected Commissioned to be %s, but was %s", tc.metadata.Commissioned, nd.Metadata.Commissioned)
+				}
+				if tc.metadata.Language != nd.Metadata.Language {
+					t.Errorf("expected Language to be %s, but was %s", tc.metadata.Language, nd.Metadata.Language)
+				}
+				if tc.metadata.Part != nd.Metadata.Part {
+					t.Errorf("expected Part to be %s, but was %s", tc.metadata.Part, nd.Metadata.Part)
+				}
+				if tc.metadata.SourceForm != nd.Metadata.SourceForm {
+					t.Errorf("expected SourceForm to be %s, but was %s", tc.metadata.SourceForm, nd.Metadata.SourceForm)
+				}
 			}
 
 			nf.Close()
@@ -156,3 +184,2672 @@ func TestEncoderRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestEncoderCanonical(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		w := &memWriter{}
+		e := NewEncoder(w, 44100, bitDepth, 2, FormatPCM)
+		e.Canonical = true
+		e.AlignDataChunk(4)
+		e.Metadata = &Metadata{Title: "title"}
+		e.SetDisplayTitle("display")
+		if err := e.Write(&audio.IntBuffer{Format: format, Data: []int{1, 2, 3, 4}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if string(w.buf[36:40]) != "data" || e.pcmChunkPos != 44 {
+			t.Fatalf("expected the audio of the %d bit file to start at 44, got %d", bitDepth, e.pcmChunkPos)
+		}
+	}
+
+	testCases := []struct {
+		desc      string
+		configure func(e *Encoder)
+	}{
+		{"ds64 reservation", func(e *Encoder) { e.ReserveDS64 = true }},
+		{"valid bits", func(e *Encoder) { e.ValidBitsPerSample = 20 }},
+		{"channel layout", func(e *Encoder) {
+			if err := e.SetChannelLayout(LayoutStereo); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"extensible format", func(e *Encoder) { e.WavAudioFormat = FormatExtensible }},
+		{"alignment", func(e *Encoder) { e.AlignDataChunk(4096) }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 44100, 24, 2, FormatPCM)
+			e.Canonical = true
+			tc.configure(e)
+			if err := e.Write(&audio.IntBuffer{Format: format, Data: []int{1, 2}}); err == nil {
+				t.Fatal("expected the option to be refused")
+			}
+			if len(w.buf) != 0 {
+				t.Fatalf("expected nothing to be written, got %d bytes", len(w.buf))
+			}
+		})
+	}
+}
+
+func TestEncoderStrict(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	testCases := []struct {
+		desc        string
+		bitDepth    int
+		numChans    int
+		audioFormat int
+		valid       bool
+	}{
+		{"16 bit stereo PCM", 16, 2, 1, true},
+		{"24 bit mono PCM", 24, 1, 1, true},
+		{"12 bit", 12, 1, 1, false},
+		{"no channels", 16, 0, 1, false},
+		{"float without fact", 32, 2, 3, false},
+		{"extensible without mask", 16, 2, 0xFFFE, false},
+		{"surround without extensible", 16, 6, 1, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			out, err := os.Create("testOutput/strict.wav")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			e := NewEncoder(out, 44100, tc.bitDepth, tc.numChans, tc.audioFormat)
+			e.Strict = true
+			err = e.WriteFrame(int16(0))
+			if tc.valid && err != nil {
+				t.Fatalf("expected the configuration to be accepted, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrNonConformant) {
+				t.Fatalf("expected ErrNonConformant, got %v", err)
+			}
+
+			// outside of strict mode the encoder does its best effort
+			e = NewEncoder(out, 44100, tc.bitDepth, tc.numChans, tc.audioFormat)
+			if err := e.writeHeader(); errors.Is(err, ErrNonConformant) {
+				t.Fatalf("expected the best effort mode to not enforce strict rules, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEncoderCloseWriter(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	out, err := os.Create("testOutput/closewriter.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+
+	e := NewEncoder(out, 44100, 16, 1, 1)
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, Data: []int{1, 2, 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CloseWriter(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err == nil {
+		t.Fatal("expected the underlying file to already be closed")
+	}
+
+	f, err := os.Open(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if !NewDecoder(f).IsValidFile() {
+		t.Fatal("expected a valid file")
+	}
+}
+
+func TestEncoderTruncate(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	out, err := os.Create("testOutput/truncate.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 200)}
+	for i := range buf.Data {
+		buf.Data[i] = i
+	}
+	e := NewEncoder(out, 44100, 16, 2, 1)
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Truncate(101); err == nil {
+		t.Fatal("expected an error when truncating more frames than were written")
+	}
+	if err := e.Truncate(60); err != nil {
+		t.Fatal(err)
+	}
+	e.Metadata = &Metadata{Title: "truncated"}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d := NewDecoder(f)
+	nBuf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nBuf.Data) != 120 {
+		t.Fatalf("expected 120 samples, got %d", len(nBuf.Data))
+	}
+	for i := range nBuf.Data {
+		if nBuf.Data[i] != i {
+			t.Fatalf("sample %d: expected %d, got %d", i, i, nBuf.Data[i])
+		}
+	}
+	d.ReadMetadata()
+	if d.Metadata == nil || d.Metadata.Title != "truncated" {
+		t.Fatalf("expected the metadata to be written after the truncated data, got %#v", d.Metadata)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header + 60 stereo 16 bit frames + LIST chunk
+	if exp := int64(44 + 240 + 30); fi.Size() != exp {
+		t.Fatalf("expected the file to be %d bytes, got %d", exp, fi.Size())
+	}
+}
+
+func TestEncoderSetDisplayTitle(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	testCases := []struct {
+		title string
+		chunk []byte
+	}{
+		{"kick", []byte("DISP\x09\x00\x00\x00\x01\x00\x00\x00kick\x00\x00")},
+		{"snare", []byte("DISP\x0a\x00\x00\x00\x01\x00\x00\x00snare\x00")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			out, err := os.Create("testOutput/disp.wav")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			e := NewEncoder(out, 44100, 16, 1, 1)
+			e.SetDisplayTitle(tc.title)
+			if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, Data: []int{1, 2, 3}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := ioutil.ReadFile(out.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasSuffix(b, tc.chunk) {
+				t.Fatalf("expected the file to end with %q, got %q", tc.chunk, b)
+			}
+			d := NewDecoder(bytes.NewReader(b))
+			if _, err := d.FullPCMBuffer(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestEncoderSizePlaceholder(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	out, err := os.Create("testOutput/placeholder.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	e := NewEncoder(out, 44100, 16, 1, 1)
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, Data: []int{1, 2, 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the encoder isn't closed to simulate a crash
+	b, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 50 {
+		t.Fatalf("expected 50 bytes to be written, got %d", len(b))
+	}
+	if !bytes.Equal(b[4:8], []byte{0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Errorf("expected the RIFF size placeholder to be 0xFFFFFFFF, got %x", b[4:8])
+	}
+	if !bytes.Equal(b[36:40], []byte("data")) {
+		t.Fatalf("expected the data chunk at offset 36, got %q", b[36:40])
+	}
+	if !bytes.Equal(b[40:44], []byte{0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Errorf("expected the data size placeholder to be 0xFFFFFFFF, got %x", b[40:44])
+	}
+}
+
+func TestEncoderInvalidFormatCombo(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	testCases := []struct {
+		bitDepth    int
+		audioFormat int
+		valid       bool
+	}{
+		{16, 1, true},
+		{24, 1, true},
+		{32, 3, true},
+		{64, 3, true},
+		{8, 7, true},
+		{24, 3, false},
+		{16, 3, false},
+		{8, 3, false},
+		{12, 1, false},
+		{64, 1, false},
+		{16, 6, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d bits format %d", tc.bitDepth, tc.audioFormat), func(t *testing.T) {
+			out, err := os.Create("testOutput/formatcombo.wav")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			e := NewEncoder(out, 44100, tc.bitDepth, 1, tc.audioFormat)
+			err = e.writeHeader()
+			if tc.valid && err != nil {
+				t.Fatalf("expected the combination to be valid, got %v", err)
+			}
+			if !tc.valid && !errors.Is(err, ErrInvalidFormatCombo) {
+				t.Fatalf("expected ErrInvalidFormatCombo, got %v", err)
+			}
+		})
+	}
+}
+
+// memWriter is an in memory WriterAtSeeker growing as needed.
+type memWriter struct {
+	buf []byte
+	pos int64
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteAt(p, w.pos)
+	w.pos += int64(n)
+	return n, err
+}
+
+func (w *memWriter) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(w.buf) {
+		w.buf = append(w.buf, make([]byte, end-len(w.buf))...)
+	}
+	return copy(w.buf[off:], p), nil
+}
+
+func (w *memWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		w.pos = offset
+	case io.SeekCurrent:
+		w.pos += offset
+	case io.SeekEnd:
+		w.pos = int64(len(w.buf)) + offset
+	}
+	return w.pos, nil
+}
+
+func TestEncoderParallel(t *testing.T) {
+	defer func(n int) { parallelMinSamples = n }(parallelMinSamples)
+	// the buffers are only split when several CPUs can be used
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		t.Run(fmt.Sprintf("%d bits", bitDepth), func(t *testing.T) {
+			buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 32, SampleRate: 48000}, Data: make([]int, 32*1001)}
+			for i := range buf.Data {
+				buf.Data[i] = (i*7919)%(1<<uint(bitDepth-1)) - i%3
+			}
+
+			var outputs [2][]byte
+			for i, minSamples := range []int{math.MaxInt32, 1} {
+				parallelMinSamples = minSamples
+				w := &memWriter{}
+				e := NewEncoder(w, 48000, bitDepth, 32, 1)
+				if err := e.Write(buf); err != nil {
+					t.Fatal(err)
+				}
+				if err := e.Close(); err != nil {
+					t.Fatal(err)
+				}
+				outputs[i] = w.buf
+			}
+			if !bytes.Equal(outputs[0], outputs[1]) {
+				t.Fatal("expected the parallel and serial encoding to match")
+			}
+		})
+	}
+}
+
+func BenchmarkEncoderWrite32Chans(b *testing.B) {
+	defer func(n int) { parallelMinSamples = n }(parallelMinSamples)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 32, SampleRate: 48000}, Data: make([]int, 32*48000)}
+	for i := range buf.Data {
+		buf.Data[i] = i % 8388607
+	}
+
+	for _, bc := range []struct {
+		name       string
+		minSamples int
+	}{
+		{"serial", math.MaxInt32},
+		{"parallel", parallelMinSamples},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			parallelMinSamples = bc.minSamples
+			e := NewEncoder(&memWriter{}, 48000, 24, 32, 1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// rewrite the same region to not grow the writer
+				if _, err := e.WriteAt(buf, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	metadata := &Metadata{
+		Artist:   "artist",
+		Title:    "title",
+		Comments: "a comment",
+		Software: "go-audio",
+		Bext:     &BextChunk{Description: "take", CodingHistory: []string{"A=PCM"}},
+	}
+	testCases := []struct {
+		desc        string
+		sampleRate  int
+		bitDepth    int
+		numChans    int
+		audioFormat int
+		duration    time.Duration
+		metadata    *Metadata
+	}{
+		{"pcm", 44100, 16, 2, FormatPCM, time.Second, nil},
+		{"pcm mono 24 bits", 48000, 24, 1, FormatPCM, 250 * time.Millisecond, nil},
+		{"pcm odd data size", 22050, 8, 1, FormatPCM, time.Second / 10, nil},
+		{"pcm metadata", 44100, 16, 2, FormatPCM, time.Second, metadata},
+		{"float", 48000, 32, 2, FormatIEEEFloat, time.Second, nil},
+		{"float metadata", 48000, 64, 1, FormatIEEEFloat, time.Second / 3, metadata},
+		{"extensible", 96000, 24, 6, FormatExtensible, time.Second / 2, nil},
+		{"extensible metadata", 96000, 24, 6, FormatExtensible, time.Second / 2, metadata},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			frames := FramesForDuration(tc.duration, tc.sampleRate)
+			w := &memWriter{}
+			e := NewEncoder(w, tc.sampleRate, tc.bitDepth, tc.numChans, tc.audioFormat)
+			e.Metadata = tc.metadata
+			if tc.audioFormat == FormatIEEEFloat {
+				buf := &audio.FloatBuffer{Format: &audio.Format{NumChannels: tc.numChans, SampleRate: tc.sampleRate}, Data: make([]float64, frames*tc.numChans)}
+				if err := e.WriteFloat(buf); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: tc.numChans, SampleRate: tc.sampleRate}, Data: make([]int, frames*tc.numChans)}
+				if err := e.Write(buf); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			estimate := EstimateSize(tc.sampleRate, tc.bitDepth, tc.numChans, tc.audioFormat, tc.duration, tc.metadata)
+			if estimate != int64(len(w.buf)) {
+				t.Fatalf("expected an estimate of %d bytes, got %d", len(w.buf), estimate)
+			}
+		})
+	}
+
+	t.Run("adpcm", func(t *testing.T) {
+		w := &memWriter{}
+		e := NewADPCMEncoder(w, 22050, 2)
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 22050}, Data: make([]int, 2*3000)}
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		estimate := EstimateSize(22050, 4, 2, FormatMSADPCM, DurationForFrames(3000, 22050), nil)
+		if estimate != int64(len(w.buf)) {
+			t.Fatalf("expected an estimate of %d bytes, got %d", len(w.buf), estimate)
+		}
+	})
+}
+
+func TestEncoderOddDataChunk(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	testCases := []struct {
+		bitDepth int
+		frames   int
+		// sizeRecord writes the file with TrailingSizeRecord and normalizes it
+		sizeRecord bool
+	}{
+		{8, 3, false},
+		{24, 1, false},
+		{24, 5, false},
+		{8, 3, true},
+		{24, 5, true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d bits %d frames size record %t", tc.bitDepth, tc.frames, tc.sizeRecord), func(t *testing.T) {
+			data := make([]int, tc.frames)
+			for i := range data {
+				data[i] = i + 1
+			}
+			f, err := os.Create("testOutput/odd.wav")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+			e := NewEncoder(f, 8000, tc.bitDepth, 1, 1)
+			e.TrailingSizeRecord = tc.sizeRecord
+			e.Metadata = &Metadata{Title: "hello"}
+			if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: data}); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if tc.sizeRecord {
+				if err := Normalize(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			b, err := ioutil.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b)%2 != 0 {
+				t.Fatalf("expected the file to be word aligned, got %d bytes", len(b))
+			}
+			if size := binary.LittleEndian.Uint32(b[4:]); int(size) != len(b)-8 {
+				t.Fatalf("expected the RIFF size to be %d, got %d", len(b)-8, size)
+			}
+
+			d := NewDecoder(bytes.NewReader(b))
+			d.ReadMetadata()
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d.Metadata == nil || d.Metadata.Title != "hello" {
+				t.Fatalf("expected the title to be read after the padded data chunk, got %#v", d.Metadata)
+			}
+			dur, err := NewDecoder(bytes.NewReader(b)).Duration()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := DurationForFrames(tc.frames, 8000); dur != exp {
+				t.Fatalf("expected a duration of %s, got %s", exp, dur)
+			}
+			nBuf, err := NewDecoder(bytes.NewReader(b)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(nBuf.Data, data) {
+				t.Fatalf("expected %v, got %v", data, nBuf.Data)
+			}
+		})
+	}
+}
+
+func TestEncoderWriteAtFrame(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	buf := &audio.IntBuffer{Format: format, Data: make([]int, 200)}
+	w := &memWriter{}
+	e := NewEncoder(w, 44100, 24, 2, 1)
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := &audio.IntBuffer{Format: format, Data: make([]int, 20)}
+	for i := range patch.Data {
+		patch.Data[i] = i + 1
+	}
+	if _, err := e.WriteAtFrame(patch, 95); err == nil {
+		t.Fatal("expected an error when writing past the written frames")
+	}
+	if _, err := e.WriteAtFrame(patch, -1); err == nil {
+		t.Fatal("expected an error when writing at a negative frame")
+	}
+	if _, err := e.WriteAtFrame(&audio.IntBuffer{Format: format, Data: make([]int, 3)}, 0); err == nil {
+		t.Fatal("expected an error when writing a partial frame")
+	}
+	if _, err := e.WriteAtFrame(patch, 40); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		exp := 0
+		if i >= 80 && i < 100 {
+			exp = i - 80 + 1
+		}
+		if nBuf.Data[i] != exp {
+			t.Fatalf("sample %d: expected %d, got %d", i, exp, nBuf.Data[i])
+		}
+	}
+}
+
+func TestEncoderReserveDS64(t *testing.T) {
+	defer func(n int64) { maxRIFFSize = n }(maxRIFFSize)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 100)}
+	for i := range buf.Data {
+		buf.Data[i] = i
+	}
+
+	t.Run("reserved", func(t *testing.T) {
+		w := &memWriter{}
+		e := NewEncoder(w, 44100, 16, 2, 1)
+		e.ReserveDS64 = true
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(w.buf[12:20], []byte("JUNK\x1c\x00\x00\x00")) {
+			t.Fatalf("expected a JUNK chunk after the RIFF header, got %q", w.buf[12:20])
+		}
+		d := NewDecoder(bytes.NewReader(w.buf))
+		nBuf, err := d.FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(nBuf.Data, buf.Data) {
+			t.Fatalf("expected %v, got %v", buf.Data, nBuf.Data)
+		}
+	})
+
+	t.Run("upgraded", func(t *testing.T) {
+		// pretend the 200 bytes of audio don't fit in a RIFF container
+		maxRIFFSize = 100
+		w := &memWriter{}
+		e := NewEncoder(w, 44100, 16, 2, 1)
+		e.ReserveDS64 = true
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(w.buf) != 80+200 {
+			t.Fatalf("expected the data to stay in place, got a %d bytes file", len(w.buf))
+		}
+		if !bytes.Equal(w.buf[:12], []byte("RF64\xff\xff\xff\xffWAVE")) {
+			t.Fatalf("expected a RF64 header, got %q", w.buf[:12])
+		}
+		if !bytes.Equal(w.buf[12:20], []byte("ds64\x1c\x00\x00\x00")) {
+			t.Fatalf("expected the JUNK chunk to be turned into a ds64 chunk, got %q", w.buf[12:20])
+		}
+		for i, exp := range []uint64{uint64(len(w.buf) - 8), 200, 50} {
+			if v := binary.LittleEndian.Uint64(w.buf[20+i*8:]); v != exp {
+				t.Errorf("expected ds64 field %d to be %d, got %d", i, exp, v)
+			}
+		}
+		if !bytes.Equal(w.buf[72:80], []byte("data\xff\xff\xff\xff")) {
+			t.Fatalf("expected the data chunk size to be 0xFFFFFFFF, got %q", w.buf[72:80])
+		}
+	})
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, Data: make([]int, 100)}
+	testCases := []struct {
+		failAt int64
+		op     string
+		offset int64
+	}{
+		{10, "header", 10},
+		{40, "header", 40},
+		{101, "data", 101},
+		{244, "metadata", 244},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("fail at %d", tc.failAt), func(t *testing.T) {
+			e := NewEncoder(wavtest.NewFailingWriter(&memWriter{}, tc.failAt), 44100, 16, 1, 1)
+			e.Metadata = &Metadata{Title: "title"}
+			err := e.Write(buf)
+			if err == nil {
+				err = e.Close()
+			}
+			var wErr *WriteError
+			if !errors.As(err, &wErr) {
+				t.Fatalf("expected a WriteError, got %v", err)
+			}
+			if !errors.Is(err, wavtest.ErrInjected) {
+				t.Fatalf("expected the writer error to be wrapped, got %v", err)
+			}
+			if wErr.Op != tc.op {
+				t.Errorf("expected the %s operation to fail, got %s", tc.op, wErr.Op)
+			}
+			if wErr.Offset != tc.offset {
+				t.Errorf("expected the failure offset to be %d, got %d", tc.offset, wErr.Offset)
+			}
+		})
+	}
+}
+
+func TestEncoderAddPartialWrite(t *testing.T) {
+	e := NewEncoder(wavtest.NewFailingWriter(&memWriter{}, 6), 44100, 16, 1, 1)
+	if n, err := e.AddLE(uint32(1)); n != 4 || err != nil {
+		t.Fatalf("expected 4 bytes to be written, got %d, %v", n, err)
+	}
+	n, err := e.AddBE(uint32(2))
+	if !errors.Is(err, wavtest.ErrInjected) {
+		t.Fatalf("expected the writer error, got %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 bytes to be written, got %d", n)
+	}
+	if e.WrittenBytes != 6 {
+		t.Fatalf("expected 6 written bytes, got %d", e.WrittenBytes)
+	}
+}
+
+func TestEncoderIsPlayable(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{1, 2, 3, 4}}
+	for _, buffered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("buffered %t", buffered), func(t *testing.T) {
+			e := NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+			e.BufferWrites = buffered
+			if e.IsPlayable() {
+				t.Fatal("expected a new encoder not to be playable")
+			}
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			// the header is still in the write buffer
+			if e.IsPlayable() == buffered {
+				t.Fatalf("expected IsPlayable to be %t after the first write", !buffered)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !e.IsPlayable() {
+				t.Fatal("expected a closed encoder to be playable")
+			}
+			e.Release()
+			if e.IsPlayable() {
+				t.Fatal("expected a released encoder not to be playable")
+			}
+		})
+	}
+}
+
+func TestEncoderWriteRing(t *testing.T) {
+	// a stereo ring of 5 frames
+	ring := []int16{0, 1, 10, 11, 20, 21, 30, 31, 40, 41}
+	testCases := []struct {
+		desc         string
+		start, count int
+		exp          []int
+	}{
+		{"no wrap", 2, 4, []int{10, 11, 20, 21}},
+		{"up to the end", 6, 4, []int{30, 31, 40, 41}},
+		{"wrap", 6, 6, []int{30, 31, 40, 41, 0, 1}},
+		{"whole ring wrapped", 8, 10, []int{40, 41, 0, 1, 10, 11, 20, 21, 30, 31}},
+		{"empty", 4, 0, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 44100, 16, 2, FormatPCM)
+			if err := e.WriteRing(ring, tc.start, tc.count); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			buf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(buf.Data) != len(tc.exp) || len(tc.exp) > 0 && !reflect.DeepEqual(buf.Data, tc.exp) {
+				t.Fatalf("expected %v, got %v", tc.exp, buf.Data)
+			}
+		})
+	}
+
+	invalid := []struct {
+		desc         string
+		ring         []int16
+		start, count int
+	}{
+		{"unaligned start", ring, 3, 4},
+		{"unaligned count", ring, 2, 3},
+		{"unaligned ring", ring[:9], 0, 4},
+		{"start out of the ring", ring, 10, 2},
+		{"count larger than the ring", ring, 0, 12},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.desc, func(t *testing.T) {
+			e := NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+			if err := e.WriteRing(tc.ring, tc.start, tc.count); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+	e := NewEncoder(&memWriter{}, 44100, 24, 2, FormatPCM)
+	if err := e.WriteRing(ring, 0, 2); err == nil {
+		t.Fatal("expected 24 bit encoders to be refused")
+	}
+}
+
+func TestEncoderWriteStereo24(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 48000, 24, 2, FormatPCM)
+	left := []int32{1, 0x123456, 0x7FFFFF, 0x800000}
+	right := []int32{-2, -0x123456, -0x800000, -0x800001}
+	if err := e.WriteStereo24(left, right); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	exp := []byte{
+		0x01, 0x00, 0x00, 0xFE, 0xFF, 0xFF,
+		0x56, 0x34, 0x12, 0xAA, 0xCB, 0xED,
+		0xFF, 0xFF, 0x7F, 0x00, 0x00, 0x80,
+		// out of range samples are clamped
+		0xFF, 0xFF, 0x7F, 0x00, 0x00, 0x80,
+	}
+	if !bytes.Equal(w.buf[44:44+len(exp)], exp) {
+		t.Fatalf("expected the data % X, got % X", exp, w.buf[44:44+len(exp)])
+	}
+	if e.frames != 4 || e.ClippedSamples() != 2 {
+		t.Fatalf("expected 4 frames and 2 clipped samples, got %d and %d", e.frames, e.ClippedSamples())
+	}
+
+	// the unused low bits of packed samples are zero
+	w = &memWriter{}
+	e = NewEncoder(w, 48000, 24, 2, FormatPCM)
+	e.ValidBitsPerSample = 20
+	if err := e.WriteStereo24([]int32{1}, []int32{-1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.buf[len(w.buf)-6:]; !bytes.Equal(got, []byte{0x10, 0x00, 0x00, 0xF0, 0xFF, 0xFF}) {
+		t.Fatalf("expected the samples to be shifted, got % X", got)
+	}
+
+	if err := e.WriteStereo24([]int32{1, 2}, []int32{1}); err == nil {
+		t.Fatal("expected channels of different lengths to be refused")
+	}
+	if err := NewEncoder(&memWriter{}, 48000, 16, 2, FormatPCM).WriteStereo24([]int32{1}, []int32{1}); err == nil {
+		t.Fatal("expected a 16 bit encoder to be refused")
+	}
+}
+
+func TestEncoderWriteRingAnalyzers(t *testing.T) {
+	// the wrapped region is analyzed like the same samples written by Write
+	ring := make([]int16, 2000)
+	for i := range ring {
+		ring[i] = int16(i * 10)
+	}
+	linear := make([]int, 0, len(ring))
+	for _, v := range ring[1200:] {
+		linear = append(linear, int(v))
+	}
+	for _, v := range ring[:1200] {
+		linear = append(linear, int(v))
+	}
+	ringEncoder := NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+	ringEncoder.EnableOverview(100)
+	if err := ringEncoder.WriteRing(ring, 1200, 2000); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+	e.EnableOverview(100)
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: linear}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ringEncoder.overview.peaks, e.overview.peaks) {
+		t.Fatal("expected the ring to be analyzed like the linear samples")
+	}
+}
+
+func TestEncoderDataHeaderGuard(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, Data: []int{1, 2, 3}}
+
+	// a data chunk at the very start of the output, the RIFF header being
+	// composed by the caller, still gets its size patched
+	w := &memWriter{}
+	e := NewEncoder(w, 44100, 16, 1, FormatPCM)
+	e.wroteHeader = true
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if e.pcmChunkPos != 8 {
+		t.Fatalf("expected the audio to start at 8, got %d", e.pcmChunkPos)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint32(w.buf[4:]); size != 6 {
+		t.Fatalf("expected the data chunk size to be patched to 6, got %d", size)
+	}
+
+	// the size isn't patched if the data chunk header wasn't fully written
+	e = NewEncoder(wavtest.NewFailingWriter(&memWriter{}, 42), 44100, 16, 1, FormatPCM)
+	if err := e.Write(buf); err == nil {
+		t.Fatal("expected the data chunk header write to fail")
+	}
+	if !e.pcmChunkStarted || e.dataHeaderWritten {
+		t.Fatal("expected the data chunk header to be flagged as incomplete")
+	}
+}
+
+func TestEncoderHeaderOverrides(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{1, 2}}
+	testCases := []struct {
+		desc                   string
+		blockAlign, byteRate   int
+		expBlockAlign, expRate uint32
+	}{
+		{"computed", 0, 0, 4, 44100 * 4},
+		{"block align", 2048, 0, 2048, 44100 * 2048},
+		{"byte rate", 0, 22311, 4, 22311},
+		{"both", 1, 3, 1, 3},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 44100, 16, 2, FormatPCM)
+			e.SetBlockAlign(tc.blockAlign)
+			e.SetByteRate(tc.byteRate)
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if rate := binary.LittleEndian.Uint32(w.buf[28:]); rate != tc.expRate {
+				t.Errorf("expected the avg bytes per sec %d, got %d", tc.expRate, rate)
+			}
+			if align := uint32(le16(w.buf[32:])); align != tc.expBlockAlign {
+				t.Errorf("expected the block align %d, got %d", tc.expBlockAlign, align)
+			}
+			// the audio is still serialized according to the bit depth
+			if len(w.buf) != 48 {
+				t.Errorf("expected a 48 bytes file, got %d", len(w.buf))
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+	e.SetBlockAlign(1 << 16)
+	if err := e.Write(buf); !errors.Is(err, ErrSizeOverflow) {
+		t.Fatalf("expected a block align overflow, got %v", err)
+	}
+	e = NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+	e.SetByteRate(-1)
+	if err := e.Write(buf); !errors.Is(err, ErrSizeOverflow) {
+		t.Fatalf("expected a negative byte rate to be refused, got %v", err)
+	}
+	e = NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+	e.Strict = true
+	e.SetBlockAlign(2)
+	if err := e.Write(buf); !errors.Is(err, ErrNonConformant) {
+		t.Fatalf("expected a mismatching block align to be refused in strict mode, got %v", err)
+	}
+}
+
+func BenchmarkEncoderSmallWrites(b *testing.B) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{1, 2}}
+	for _, unsafe := range []bool{false, true} {
+		b.Run(fmt.Sprintf("unsafe %t", unsafe), func(b *testing.B) {
+			e := NewEncoder(&memWriter{}, 44100, 16, 2, 1)
+			e.Unsafe = unsafe
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := e.WriteAt(buf, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderOverflow(t *testing.T) {
+	defer func(n int) { parallelMinSamples = n }(parallelMinSamples)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	format := &audio.Format{NumChannels: 1, SampleRate: 8000}
+
+	testCases := []struct {
+		desc       string
+		bitDepth   int
+		validBits  int
+		policy     OverflowPolicy
+		in         []int
+		exp        []int
+		expClipped int
+	}{
+		{"16 bit clamp", 16, 0, OverflowClamp, []int{1, 40000, -40000, 1 << 40, -1 << 40}, []int{1, 32767, -32768, 32767, -32768}, 4},
+		{"16 bit wrap", 16, 0, OverflowWrap, []int{1, 65537}, []int{1, 1}, 0},
+		{"8 bit clamp", 8, 0, OverflowClamp, []int{128, 300, -5}, []int{128, 255, 0}, 2},
+		{"24 bit clamp", 24, 0, OverflowClamp, []int{-1, 1 << 23, -1<<23 - 1}, []int{-1, 1<<23 - 1, -1 << 23}, 2},
+		{"32 bit clamp", 32, 0, OverflowClamp, []int{1 << 33, -1 << 33}, []int{1<<31 - 1, -1 << 31}, 2},
+		// the decoder doesn't undo the shift of the 20 valid bits
+		{"valid bits clamp", 24, 20, OverflowClamp, []int{1 << 20, 3}, []int{(1<<19 - 1) << 4, 3 << 4}, 1},
+	}
+	for _, tc := range testCases {
+		for _, parallel := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s parallel %t", tc.desc, parallel), func(t *testing.T) {
+				parallelMinSamples = math.MaxInt32
+				if parallel {
+					parallelMinSamples = 1
+				}
+				w := &memWriter{}
+				e := NewEncoder(w, 8000, tc.bitDepth, 1, FormatPCM)
+				e.ValidBitsPerSample = tc.validBits
+				e.Overflow = tc.policy
+				if err := e.Write(&audio.IntBuffer{Format: format, Data: tc.in}); err != nil {
+					t.Fatal(err)
+				}
+				// WriteWith has its own serialization
+				if _, err := e.WriteWith(&audio.IntBuffer{Format: format, Data: tc.in}, nil); err != nil {
+					t.Fatal(err)
+				}
+				if err := e.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if n := e.ClippedSamples(); n != 2*tc.expClipped {
+					t.Fatalf("expected %d clipped samples, got %d", 2*tc.expClipped, n)
+				}
+				nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+				if err != nil {
+					t.Fatal(err)
+				}
+				exp := append(append([]int{}, tc.exp...), tc.exp...)
+				if !reflect.DeepEqual(nBuf.Data, exp) {
+					t.Fatalf("expected %v, got %v", exp, nBuf.Data)
+				}
+			})
+		}
+	}
+}
+
+func TestEncoderWriteRawAllocations(t *testing.T) {
+	e := NewEncoder(discardWriter{}, 44100, 16, 2, FormatPCM)
+	raw := make([]byte, 4096)
+	if _, err := e.WriteRaw(raw); err != nil {
+		t.Fatal(err)
+	}
+	if allocs := testing.AllocsPerRun(100, func() {
+		if _, err := e.WriteRaw(raw); err != nil {
+			t.Fatal(err)
+		}
+	}); allocs != 0 {
+		t.Fatalf("expected WriteRaw to not allocate, got %v allocations", allocs)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if e.bufPool != nil {
+		t.Fatal("expected the buffer pool to not be created")
+	}
+}
+
+// discardWriter is a WriterAtSeeker dropping everything, so benchmarks
+// don't measure the writer allocations.
+type discardWriter struct{}
+
+func (discardWriter) Write(p []byte) (int, error)                  { return len(p), nil }
+func (discardWriter) WriteAt(p []byte, off int64) (int, error)     { return len(p), nil }
+func (discardWriter) Seek(offset int64, whence int) (int64, error) { return offset, nil }
+
+func TestEncoderWriteWith(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	for _, bitDepth := range []int{8, 16, 24, 32} {
+		buf := &audio.IntBuffer{Format: format, Data: make([]int, 201)}
+		for i := range buf.Data {
+			buf.Data[i] = i - 100
+		}
+		exp := &memWriter{}
+		e := NewEncoder(exp, 44100, bitDepth, 2, FormatPCM)
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		w := &memWriter{}
+		e = NewEncoder(w, 44100, bitDepth, 2, FormatPCM)
+		// too small, it has to be grown
+		scratch := make([]byte, 10)
+		var err error
+		for i := 0; i < 2; i++ {
+			half := &audio.IntBuffer{Format: format, Data: buf.Data[i*100 : (i+1)*100]}
+			if scratch, err = e.WriteWith(half, scratch); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if cap(scratch) < 100*bitDepth/8 {
+			t.Fatalf("expected the scratch slice to be grown, got a capacity of %d", cap(scratch))
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(w.buf, exp.buf) {
+			t.Fatalf("%d bits: expected WriteWith to write like Write", bitDepth)
+		}
+	}
+
+	e := NewEncoder(discardWriter{}, 44100, 24, 2, FormatPCM)
+	buf := &audio.IntBuffer{Format: format, Data: make([]int, 512)}
+	scratch := make([]byte, 512*3)
+	if allocs := testing.AllocsPerRun(100, func() {
+		if _, err := e.WriteWith(buf, scratch); err != nil {
+			t.Fatal(err)
+		}
+	}); allocs != 0 {
+		t.Fatalf("expected no allocation, got %v", allocs)
+	}
+}
+
+func BenchmarkEncoderWriteWith(b *testing.B) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 512)}
+	e := NewEncoder(discardWriter{}, 44100, 24, 2, FormatPCM)
+	var scratch []byte
+	var err error
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if scratch, err = e.WriteWith(buf, scratch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEncoderPassthrough compares serializing int samples with copying
+// the same audio already serialized by WriteRaw.
+func BenchmarkEncoderPassthrough(b *testing.B) {
+	for _, bitDepth := range []int{16, 24} {
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 4096)}
+		raw := make([]byte, len(buf.Data)*bitDepth/8)
+		b.Run(fmt.Sprintf("Write %d bit", bitDepth), func(b *testing.B) {
+			e := NewEncoder(discardWriter{}, 44100, bitDepth, 2, FormatPCM)
+			b.SetBytes(int64(len(raw)))
+			for i := 0; i < b.N; i++ {
+				if err := e.Write(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("WriteRaw %d bit", bitDepth), func(b *testing.B) {
+			e := NewEncoder(discardWriter{}, 44100, bitDepth, 2, FormatPCM)
+			b.SetBytes(int64(len(raw)))
+			for i := 0; i < b.N; i++ {
+				if _, err := e.WriteRaw(raw); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEncoderShortLived measures the allocations of the many short-lived
+// encoders pattern, each writing a few raw frames.
+func BenchmarkEncoderShortLived(b *testing.B) {
+	raw := make([]byte, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		e := NewEncoder(discardWriter{}, 48000, 16, 2, FormatPCM)
+		if _, err := e.WriteRaw(raw); err != nil {
+			b.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEncoderWriteFrames(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		bitDepth int
+		samples  interface{}
+		exp      []int
+	}{
+		{"8 bit", 8, []uint8{0, 128, 255, 1}, []int{0, 128, 255, 1}},
+		{"16 bit", 16, []int16{1, -2, 32767, -32768}, []int{1, -2, 32767, -32768}},
+		{"24 bit", 24, []int32{1, -2, 8388607, -8388608}, []int{1, -2, 8388607, -8388608}},
+		{"32 bit", 32, []int32{1, -2, 2147483647, -2147483648}, []int{1, -2, 2147483647, -2147483648}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 8000, tc.bitDepth, 2, FormatPCM)
+			if err := e.WriteFrames(tc.samples); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if e.frames != 2 {
+				t.Fatalf("expected 2 frames, got %d", e.frames)
+			}
+			buf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(buf.Data, tc.exp) {
+				t.Fatalf("expected %v, got %v", tc.exp, buf.Data)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 8000, 24, 2, FormatPCM)
+	if err := e.WriteFrames([]int16{1, 2}); err == nil {
+		t.Fatal("expected 16 bit samples to be refused by a 24 bit encoder")
+	}
+	if err := e.WriteFrames([]int32{1, 2, 3}); err == nil {
+		t.Fatal("expected a partial frame to be refused")
+	}
+}
+
+func BenchmarkEncoderWriteFrames(b *testing.B) {
+	samples := make([]int16, 256)
+	b.Run("WriteFrame", func(b *testing.B) {
+		e := NewEncoder(discardWriter{}, 44100, 16, 2, FormatPCM)
+		b.SetBytes(int64(len(samples) * 2))
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < len(samples); j += 2 {
+				if err := e.WriteFrame([2]int16{samples[j], samples[j+1]}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("WriteFrames", func(b *testing.B) {
+		e := NewEncoder(discardWriter{}, 44100, 16, 2, FormatPCM)
+		b.SetBytes(int64(len(samples) * 2))
+		for i := 0; i < b.N; i++ {
+			if err := e.WriteFrames(samples); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestEncoderWriteAtFrameCount(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	w := &memWriter{}
+	e := NewEncoder(w, 44100, 16, 2, 1)
+	if err := e.Write(&audio.IntBuffer{Format: format, Data: make([]int, 200)}); err != nil {
+		t.Fatal(err)
+	}
+	// overwrite frames 10 to 19 then 95 to 104, only the latter extends the data
+	patch := &audio.IntBuffer{Format: format, Data: make([]int, 20)}
+	for i := range patch.Data {
+		patch.Data[i] = 1
+	}
+	for _, frame := range []int64{10, 95} {
+		if _, err := e.WriteAt(patch, frame*4); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.Metadata = &Metadata{Title: "title"}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := binary.LittleEndian.Uint32(w.buf[40:]); size != 105*4 {
+		t.Fatalf("expected the data chunk to hold 105 frames (%d bytes), got %d bytes", 105*4, size)
+	}
+	if size := binary.LittleEndian.Uint32(w.buf[4:]); int(size) != len(w.buf)-8 {
+		t.Fatalf("expected the RIFF size to be %d, got %d", len(w.buf)-8, size)
+	}
+	if !bytes.Equal(w.buf[44+105*4:][:4], CIDList[:]) {
+		t.Fatal("expected the metadata to be written after the extended data")
+	}
+}
+
+func TestEncoderWriteAtDuration(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		sampleRate int
+		at         time.Duration
+		expFrame   int
+	}{
+		{"on a frame", 8000, time.Millisecond, 8},
+		{"rounded down", 8000, 1060 * time.Microsecond, 8},
+		{"rounded up", 8000, 1070 * time.Microsecond, 9},
+		{"exact frame duration", 44100, DurationForFrames(33, 44100), 33},
+		{"just before a frame", 44100, DurationForFrames(33, 44100) - time.Nanosecond, 33},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			format := &audio.Format{NumChannels: 1, SampleRate: tc.sampleRate}
+			w := &memWriter{}
+			e := NewEncoder(w, tc.sampleRate, 16, 1, FormatPCM)
+			if err := e.Write(&audio.IntBuffer{Format: format, Data: make([]int, 100)}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := e.WriteAtDuration(&audio.IntBuffer{Format: format, Data: []int{7, 7}}, tc.at); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, v := range nBuf.Data {
+				exp := 0
+				if i == tc.expFrame || i == tc.expFrame+1 {
+					exp = 7
+				}
+				if v != exp {
+					t.Fatalf("frame %d: expected %d, got %d", i, exp, v)
+				}
+			}
+		})
+	}
+
+	format := &audio.Format{NumChannels: 1, SampleRate: 8000}
+	e := NewEncoder(&memWriter{}, 8000, 16, 1, FormatPCM)
+	if err := e.Write(&audio.IntBuffer{Format: format, Data: make([]int, 100)}); err != nil {
+		t.Fatal(err)
+	}
+	patch := &audio.IntBuffer{Format: format, Data: []int{7, 7}}
+	if _, err := e.WriteAtDuration(patch, -time.Millisecond); err == nil {
+		t.Fatal("expected an error with a negative offset")
+	}
+	// frames 99 and 100, past the written frames
+	if _, err := e.WriteAtDuration(patch, DurationForFrames(99, 8000)); err == nil {
+		t.Fatal("expected an error when writing past the written frames")
+	}
+}
+
+func TestEncoderWriteAtBeyondEnd(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 8000}
+	for _, bitDepth := range []int{8, 16} {
+		silence := 0
+		if bitDepth == 8 {
+			silence = 128
+		}
+		data := make([]int, 20)
+		for i := range data {
+			data[i] = silence + 1 + i
+		}
+		w := &memWriter{}
+		e := NewEncoder(w, 8000, bitDepth, 2, FormatPCM)
+		if err := e.Write(&audio.IntBuffer{Format: format, Data: data[:10]}); err != nil {
+			t.Fatal(err)
+		}
+		// write frames 10 to 14 after a gap of 5 frames
+		blockAlign := int64(2 * bitDepth / 8)
+		if _, err := e.WriteAt(&audio.IntBuffer{Format: format, Data: data[10:]}, 10*blockAlign); err != nil {
+			t.Fatal(err)
+		}
+		if e.frames != 15 {
+			t.Fatalf("%d bits: expected 15 frames, got %d", bitDepth, e.frames)
+		}
+		// following writes append after the new end
+		if err := e.Write(&audio.IntBuffer{Format: format, Data: data[:2]}); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var exp []int
+		exp = append(exp, data[:10]...)
+		for i := 0; i < 10; i++ {
+			exp = append(exp, silence)
+		}
+		exp = append(exp, data[10:]...)
+		exp = append(exp, data[:2]...)
+		if !reflect.DeepEqual(nBuf.Data, exp) {
+			t.Fatalf("%d bits: expected %v, got %v", bitDepth, exp, nBuf.Data)
+		}
+	}
+}
+
+func TestEncoderWriteAtInvalidPosition(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	w := &memWriter{}
+	e := NewEncoder(w, 44100, 16, 2, 1)
+	if err := e.Write(&audio.IntBuffer{Format: format, Data: make([]int, 20)}); err != nil {
+		t.Fatal(err)
+	}
+	header := append([]byte(nil), w.buf[:e.pcmChunkPos]...)
+	for _, pos := range []int64{-4, -1, 2, 5} {
+		if _, err := e.WriteAt(&audio.IntBuffer{Format: format, Data: []int{1, 1}}, pos); err == nil {
+			t.Fatalf("expected writing at byte %d to fail", pos)
+		}
+	}
+	if !bytes.Equal(w.buf[:e.pcmChunkPos], header) {
+		t.Fatal("expected the header to be left untouched")
+	}
+	if e.frames != 10 {
+		t.Fatalf("expected 10 frames, got %d", e.frames)
+	}
+}
+
+func TestEncoderWriteAtSparse(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 8000}
+	region := func(frames, v int) *audio.IntBuffer {
+		buf := &audio.IntBuffer{Format: format, Data: make([]int, frames*2)}
+		for i := range buf.Data {
+			buf.Data[i] = v
+		}
+		return buf
+	}
+	for _, buffered := range []bool{false, true} {
+		w := &memWriter{}
+		e := NewEncoder(w, 8000, 16, 2, FormatPCM)
+		e.BufferWrites = buffered
+		// regions written out of order, the first one past the start
+		regions := []struct {
+			frame, frames, v int
+		}{
+			{50, 10, 1},
+			{10, 5, 2},
+			{80, 20, 3},
+			{30, 10, 4},
+		}
+		for _, r := range regions {
+			if _, err := e.WriteAt(region(r.frames, r.v), int64(r.frame*4)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		e.Metadata = &Metadata{Title: "sparse"}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if size := binary.LittleEndian.Uint32(w.buf[40:]); size != 100*4 {
+			t.Fatalf("buffered %t: expected the data chunk to hold 100 frames (%d bytes), got %d bytes", buffered, 100*4, size)
+		}
+		if size := binary.LittleEndian.Uint32(w.buf[4:]); int(size) != len(w.buf)-8 {
+			t.Fatalf("buffered %t: expected the RIFF size to be %d, got %d", buffered, len(w.buf)-8, size)
+		}
+		d := NewDecoder(bytes.NewReader(w.buf))
+		buf, err := d.FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp := make([]int, 100*2)
+		for _, r := range regions {
+			for i := r.frame * 2; i < (r.frame+r.frames)*2; i++ {
+				exp[i] = r.v
+			}
+		}
+		if !reflect.DeepEqual(buf.Data, exp) {
+			t.Fatalf("buffered %t: expected %v, got %v", buffered, exp, buf.Data)
+		}
+		d.ReadMetadata()
+		if d.Metadata == nil || d.Metadata.Title != "sparse" {
+			t.Fatalf("buffered %t: expected the metadata after the data, got %#v", buffered, d.Metadata)
+		}
+	}
+}
+
+func TestEncoderClone(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: []int{1, 2, 3, 4}}
+	base := NewEncoder(&memWriter{}, 48000, 24, 2, 1)
+	base.Strict = true
+	base.RoundingMode = RoundTruncate
+	base.SetDisplayTitle("take")
+	base.SetIXML([]byte("<BWFXML/>"))
+	base.SetResU([]byte(`{"a":1}`))
+	base.Metadata = &Metadata{
+		Artist:      "artist",
+		SamplerInfo: &SamplerInfo{MIDIUnityNote: 60, Loops: []*SampleLoop{{Start: 1}}},
+		CuePoints:   []*CuePoint{{Position: 10}},
+	}
+	if err := base.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &memWriter{}
+	c := base.Clone(w)
+	if c.WrittenBytes != 0 || c.frames != 0 || c.wroteHeader || c.pcmChunkStarted {
+		t.Fatal("expected the write state of the clone to be reset")
+	}
+	if c.SampleRate != 48000 || c.BitDepth != 24 || c.NumChans != 2 || c.WavAudioFormat != 1 ||
+		!c.Strict || c.RoundingMode != RoundTruncate || c.displayTitle != "take" {
+		t.Fatalf("expected the format and options to be copied, got %#v", c)
+	}
+	if c.bufPool == base.bufPool {
+		t.Fatal("expected the clone to have its own buffer pool")
+	}
+	if !reflect.DeepEqual(c.Metadata, base.Metadata) {
+		t.Fatalf("expected the metadata to be copied, got %#v", c.Metadata)
+	}
+	c.Metadata.Artist = "other"
+	c.Metadata.SamplerInfo.Loops[0].Start = 2
+	c.Metadata.CuePoints[0].Position = 20
+	if base.Metadata.Artist != "artist" || base.Metadata.SamplerInfo.Loops[0].Start != 1 || base.Metadata.CuePoints[0].Position != 10 {
+		t.Fatal("expected changes to the cloned metadata to not affect the original")
+	}
+	c.iXML[1] = 'X'
+	if string(base.iXML) != "<BWFXML/>" {
+		t.Fatalf("expected changes to the cloned iXML document to not affect the original, got %s", base.iXML)
+	}
+	c.resU[5] = '2'
+	if string(base.resU) != `{"a":1}` {
+		t.Fatalf("expected changes to the cloned ResU document to not affect the original, got %s", base.resU)
+	}
+
+	if err := c.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nBuf.Data, buf.Data) {
+		t.Fatalf("expected %v, got %v", buf.Data, nBuf.Data)
+	}
+}
+
+func TestEncoderUseMetadataTemplate(t *testing.T) {
+	template := &Metadata{
+		Artist:      "artist",
+		SamplerInfo: &SamplerInfo{Loops: []*SampleLoop{{Start: 1}}},
+		CuePoints:   []*CuePoint{NewCuePointAt(1, 0, 8000)},
+		Bext:        &BextChunk{CodingHistory: []string{"A=PCM"}},
+		IXML:        []byte("<BWFXML/>"),
+		ResU:        []byte(`{"a":1}`),
+	}
+	var files [][]byte
+	for i, title := range []string{"first", "second"} {
+		w := &memWriter{}
+		e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+		e.UseMetadataTemplate(template)
+		e.Metadata.Title = title
+		e.Metadata.SamplerInfo.Loops[0].Start = uint32(i + 10)
+		e.Metadata.CuePoints[0].Label = title
+		e.Metadata.Bext.CodingHistory[0] = title
+		e.Metadata.IXML[1] = 'X'
+		e.Metadata.ResU[5] = byte('2' + i)
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, w.buf)
+	}
+	if template.Title != "" || template.SamplerInfo.Loops[0].Start != 1 || template.CuePoints[0].Label != "" || template.Bext.CodingHistory[0] != "A=PCM" ||
+		string(template.IXML) != "<BWFXML/>" || string(template.ResU) != `{"a":1}` {
+		t.Fatalf("expected the template to be left untouched, got %#v", template)
+	}
+	for i, title := range []string{"first", "second"} {
+		d := NewDecoder(bytes.NewReader(files[i]))
+		d.ReadMetadata()
+		if err := d.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if d.Metadata.Title != title || d.Metadata.Artist != "artist" {
+			t.Fatalf("file %d: expected the title %q and the template artist, got %q and %q", i, title, d.Metadata.Title, d.Metadata.Artist)
+		}
+	}
+}
+
+func TestEncoderValidBitsPerSample(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 48000, 32, 2, 1)
+	e.ValidBitsPerSample = 24
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: []int{8388607, -8388608, 1, -1}}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteFloat(&audio.FloatBuffer{Format: buf.Format, Data: []float64{0.5, -1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := w.buf
+	if size := binary.LittleEndian.Uint32(b[16:]); size != 40 {
+		t.Fatalf("expected an extended fmt chunk of 40 bytes, got %d", size)
+	}
+	header := []struct {
+		desc   string
+		offset int
+		exp    uint32
+		got    func(b []byte) uint32
+	}{
+		{"audio format", 20, 0xFFFE, le16},
+		{"block align", 32, 8, le16},
+		{"bits per sample", 34, 32, le16},
+		{"extension size", 36, 22, le16},
+		{"valid bits per sample", 38, 24, le16},
+		{"channel mask", 40, 0, binary.LittleEndian.Uint32},
+		{"sub format", 44, 1, le16},
+	}
+	for _, h := range header {
+		if got := h.got(b[h.offset:]); got != h.exp {
+			t.Errorf("expected the %s to be %d, got %d", h.desc, h.exp, got)
+		}
+	}
+	if guid := b[46:60]; !bytes.Equal(guid, []byte{0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xAA, 0, 0x38, 0x9B, 0x71}) {
+		t.Errorf("unexpected sub format GUID % x", guid)
+	}
+
+	d := NewDecoder(bytes.NewReader(b))
+	nBuf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.WavAudioFormat != 0xFFFE || d.BitDepth != 32 {
+		t.Fatalf("unexpected decoded format %d with %d bits", d.WavAudioFormat, d.BitDepth)
+	}
+	expected := []int{8388607 << 8, -8388608 << 8, 1 << 8, -1 << 8, 4194304 << 8, -8388608 << 8}
+	if !reflect.DeepEqual(nBuf.Data, expected) {
+		t.Fatalf("expected %v, got %v", expected, nBuf.Data)
+	}
+	for i := 0; i < len(expected); i++ {
+		if low := b[68+i*4]; low != 0 {
+			t.Fatalf("expected the low byte of sample %d to be zero, got %#x", i, low)
+		}
+	}
+
+	e = NewEncoder(&memWriter{}, 48000, 16, 2, 1)
+	e.ValidBitsPerSample = 24
+	if err := e.Write(buf); err == nil {
+		t.Fatal("expected an error with more valid bits than the bit depth")
+	}
+}
+
+func le16(b []byte) uint32 {
+	return uint32(binary.LittleEndian.Uint16(b))
+}
+
+func TestEncoderWithSoftwareTag(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		tag      string
+		metadata *Metadata
+		expected string
+	}{
+		{"default name", "", &Metadata{Title: "take"}, defaultSoftwareTag},
+		{"custom name", "recorder v1.2", &Metadata{Title: "take"}, "recorder v1.2"},
+		{"user set value", "recorder v1.2", &Metadata{Software: "mine"}, "mine"},
+		{"no metadata", "recorder v1.2", nil, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 8000, 16, 1, 1)
+			e.Metadata = tc.metadata
+			e.WithSoftwareTag(tc.tag)
+			if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			d := NewDecoder(bytes.NewReader(w.buf))
+			d.ReadMetadata()
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			var software string
+			if d.Metadata != nil {
+				software = d.Metadata.Software
+			}
+			if software != tc.expected {
+				t.Fatalf("expected the software to be %q, got %q", tc.expected, software)
+			}
+			if tc.metadata != nil && tc.metadata.Software != "" && tc.tag != "" && tc.metadata.Software == tc.tag {
+				t.Fatal("expected the user metadata to be left untouched")
+			}
+		})
+	}
+}
+
+func TestEncoderSetEncoderName(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+	e.WithSoftwareTag("")
+	e.SetEncoderName("recorder v2", [4]byte{'v', 'n', 'd', 'r'})
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata == nil || d.Metadata.Software != "recorder v2" {
+		t.Fatalf("expected the ISFT field to hold the encoder name, got %#v", d.Metadata)
+	}
+	i := bytes.Index(w.buf, []byte("vndr"))
+	if i < 0 {
+		t.Fatal("expected the vendor chunk to be written")
+	}
+	if size := binary.LittleEndian.Uint32(w.buf[i+4:]); size != 12 {
+		t.Fatalf("expected the vendor chunk size to be 12, got %d", size)
+	}
+	if name := string(w.buf[i+8 : i+8+11]); name != "recorder v2" {
+		t.Fatalf("expected the vendor chunk to hold the encoder name, got %q", name)
+	}
+
+	// without a vendor chunk ID, only the INFO chunk is written
+	w = &memWriter{}
+	e = NewEncoder(w, 8000, 16, 1, FormatPCM)
+	e.Metadata = &Metadata{Software: "mine"}
+	e.SetEncoderName("recorder v2")
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(w.buf, []byte("recorder v2")) {
+		t.Fatal("expected the user set software to take precedence")
+	}
+}
+
+func TestEncoderLiveHeaderUpdates(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 1000, 16, 1, 1)
+	e.EnableLiveHeaderUpdates(100 * time.Millisecond)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 1000}, Data: make([]int, 60)}
+	for i := range buf.Data {
+		buf.Data[i] = i
+	}
+
+	sizes := func() (uint32, uint32) {
+		return binary.LittleEndian.Uint32(w.buf[4:]), binary.LittleEndian.Uint32(w.buf[40:])
+	}
+	expectations := []struct {
+		riffSize, dataSize uint32
+	}{
+		// 60 frames, not enough for an update
+		{sizePlaceholder, sizePlaceholder},
+		// 120 frames
+		{36 + 240, 240},
+		// 180 frames, 60 frames since the last update
+		{36 + 240, 240},
+		// 240 frames
+		{36 + 480, 480},
+	}
+	for i, exp := range expectations {
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if riffSize, dataSize := sizes(); riffSize != exp.riffSize || dataSize != exp.dataSize {
+			t.Fatalf("write %d: expected the sizes to be %d/%d, got %d/%d", i, exp.riffSize, exp.dataSize, riffSize, dataSize)
+		}
+		if w.pos != int64(len(w.buf)) {
+			t.Fatalf("write %d: expected the cursor to stay at the end of the file", i)
+		}
+	}
+
+	// the partially written file is readable up to the last update
+	nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nBuf.Data) != 240 {
+		t.Fatalf("expected 240 frames to be readable, got %d", len(nBuf.Data))
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if riffSize, dataSize := sizes(); riffSize != 36+480 || dataSize != 480 {
+		t.Fatalf("expected the final sizes to be %d/%d, got %d/%d", 36+480, 480, riffSize, dataSize)
+	}
+}
+
+func TestFramesForDuration(t *testing.T) {
+	testCases := []struct {
+		duration   time.Duration
+		sampleRate int
+		frames     int
+	}{
+		{time.Second, 44100, 44100},
+		{time.Millisecond, 44100, 44},
+		{time.Hour, 48000, 172800000},
+		{time.Second / 3, 48000, 15999},
+		{time.Second, 0, 0},
+	}
+	for _, tc := range testCases {
+		if frames := FramesForDuration(tc.duration, tc.sampleRate); frames != tc.frames {
+			t.Errorf("%s at %dHz: expected %d frames, got %d", tc.duration, tc.sampleRate, tc.frames, frames)
+		}
+		if tc.sampleRate == 0 {
+			continue
+		}
+		// converting back and forth must not drift
+		d := DurationForFrames(tc.frames, tc.sampleRate)
+		if frames := FramesForDuration(d, tc.sampleRate); frames != tc.frames {
+			t.Errorf("%s at %dHz: expected the round trip to give %d frames, got %d", d, tc.sampleRate, tc.frames, frames)
+		}
+	}
+	if d := DurationForFrames(22050, 44100); d != 500*time.Millisecond {
+		t.Fatalf("expected 500ms, got %s", d)
+	}
+
+	c := NewCuePointAt(3, 250*time.Millisecond, 48000)
+	if c.Position != 12000 || c.SampleOffset != 12000 || binary.LittleEndian.Uint32(c.ID[:]) != 3 {
+		t.Fatalf("unexpected cue point %#v", c)
+	}
+	l := NewSampleLoop(3, time.Second, 2*time.Second, 48000)
+	if l.Start != 48000 || l.End != 95999 || binary.LittleEndian.Uint32(l.CuePointID[:]) != 3 {
+		t.Fatalf("unexpected loop %#v", l)
+	}
+}
+
+func TestSignedUnsigned8(t *testing.T) {
+	testCases := []struct {
+		signed   int
+		unsigned uint8
+	}{
+		{0, 128},
+		{127, 255},
+		{-128, 0},
+		{-1, 127},
+	}
+	for _, tc := range testCases {
+		if u := SignedToUnsigned8(tc.signed); u != tc.unsigned {
+			t.Errorf("expected %d to convert to %d, got %d", tc.signed, tc.unsigned, u)
+		}
+		if s := UnsignedToSigned8(tc.unsigned); s != tc.signed {
+			t.Errorf("expected %d to convert to %d, got %d", tc.unsigned, tc.signed, s)
+		}
+	}
+	// values out of range are clipped to full scale
+	if u := SignedToUnsigned8(300); u != 255 {
+		t.Errorf("expected 300 to be clipped to 255, got %d", u)
+	}
+	if u := SignedToUnsigned8(-300); u != 0 {
+		t.Errorf("expected -300 to be clipped to 0, got %d", u)
+	}
+}
+
+func TestEncoderWriteErrorCounters(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: make([]int, 200)}
+	floatBuf := &audio.FloatBuffer{Format: buf.Format, Data: make([]float64, 200)}
+	for _, failAt := range []int64{44, 45, 47, 48, 100, 443} {
+		for _, float := range []bool{false, true} {
+			t.Run(fmt.Sprintf("fail at %d, float %t", failAt, float), func(t *testing.T) {
+				mw := &memWriter{}
+				var e *Encoder
+				var err error
+				if float {
+					e = NewEncoder(wavtest.NewFailingWriter(mw, failAt), 8000, 32, 2, 3)
+					err = e.WriteFloat(floatBuf)
+				} else {
+					e = NewEncoder(wavtest.NewFailingWriter(mw, failAt), 8000, 16, 2, 1)
+					e.EnableSilenceMarkers(-60, 0)
+					err = e.Write(buf)
+				}
+				if !errors.Is(err, wavtest.ErrInjected) {
+					t.Fatalf("expected the injected error, got %v", err)
+				}
+				blockAlign := int64(e.NumChans * e.BitDepth / 8)
+				if e.WrittenBytes != int(failAt) || e.WrittenBytes != len(mw.buf) {
+					t.Fatalf("expected %d written bytes, got %d (%d in the writer)", failAt, e.WrittenBytes, len(mw.buf))
+				}
+				if exp := int((failAt - 44) / blockAlign); e.frames != exp {
+					t.Fatalf("expected %d frames to be accounted for, got %d", exp, e.frames)
+				}
+				if e.silence != nil && e.frames > 0 && len(e.silence.markers) != 1 {
+					t.Fatalf("expected the written frames to be analyzed, got markers %v", e.silence.markers)
+				}
+			})
+		}
+	}
+}
+
+func TestEncoderFormatExtensible(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 44100, 16, 2, FormatExtensible)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{1, -1, 2, -2}}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := w.buf
+	for _, h := range []struct {
+		desc   string
+		offset int
+		exp    uint32
+	}{
+		{"fmt chunk size", 16, 40},
+		{"audio format", 20, FormatExtensible},
+		{"bits per sample", 34, 16},
+		{"valid bits per sample", 38, 16},
+		{"sub format", 44, FormatPCM},
+	} {
+		got := le16(b[h.offset:])
+		if h.offset == 16 {
+			got = binary.LittleEndian.Uint32(b[h.offset:])
+		}
+		if got != h.exp {
+			t.Errorf("expected the %s to be %d, got %d", h.desc, h.exp, got)
+		}
+	}
+	nBuf, err := NewDecoder(bytes.NewReader(b)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nBuf.Data, buf.Data) {
+		t.Fatalf("expected %v, got %v", buf.Data, nBuf.Data)
+	}
+
+	e = NewEncoder(&memWriter{}, 44100, 12, 2, FormatExtensible)
+	if err := e.Write(buf); !errors.Is(err, ErrInvalidFormatCombo) {
+		t.Fatalf("expected ErrInvalidFormatCombo, got %v", err)
+	}
+}
+
+func TestEncoderWriteFromChan(t *testing.T) {
+	newBuf := func(i int) *audio.IntBuffer {
+		return &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{i, -i}}
+	}
+
+	t.Run("closed channel", func(t *testing.T) {
+		w := &memWriter{}
+		e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+		ch := make(chan *audio.IntBuffer)
+		go func() {
+			for i := 1; i <= 10; i++ {
+				ch <- newBuf(i)
+			}
+			close(ch)
+		}()
+		if err := e.WriteFromChan(context.Background(), ch); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nBuf.Data) != 20 || nBuf.Data[18] != 10 || nBuf.Data[19] != -10 {
+			t.Fatalf("unexpected data %v", nBuf.Data)
+		}
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		e := NewEncoder(&memWriter{}, 8000, 16, 1, FormatPCM)
+		ch := make(chan *audio.IntBuffer, 1)
+		ch <- newBuf(1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := e.WriteFromChan(ctx, ch); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if e.frames != 0 {
+			t.Fatalf("expected nothing to be written after the cancelation, got %d frames", e.frames)
+		}
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		e := NewEncoder(wavtest.NewFailingWriter(&memWriter{}, 50), 8000, 16, 1, FormatPCM)
+		ch := make(chan *audio.IntBuffer, 5)
+		for i := 1; i <= 5; i++ {
+			ch <- newBuf(i)
+		}
+		close(ch)
+		if err := e.WriteFromChan(context.Background(), ch); !errors.Is(err, wavtest.ErrInjected) {
+			t.Fatalf("expected the injected error, got %v", err)
+		}
+		if len(ch) != 3 {
+			t.Fatalf("expected the consumption to stop at the error, %d buffers left", len(ch))
+		}
+	})
+}
+
+func TestEncoderSizeOverflow(t *testing.T) {
+	t.Run("header fields", func(t *testing.T) {
+		testCases := []struct {
+			desc                          string
+			sampleRate, bitDepth, numChan int
+			valid                         bool
+		}{
+			{"max channels", 8000, 8, 0xFFFF, true},
+			{"too many channels", 8000, 8, 0x10000, false},
+			{"max avg bytes per sec", 0xFFFFFFFF / 4, 16, 2, true},
+			{"avg bytes per sec overflow", 0xFFFFFFFF/4 + 1, 16, 2, false},
+			{"block align overflow", 8000, 32, 0x4000, false},
+			{"negative sample rate", -1, 16, 2, false},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.desc, func(t *testing.T) {
+				e := NewEncoder(&memWriter{}, 8000, tc.bitDepth, tc.numChan, FormatPCM)
+				e.SampleRate = tc.sampleRate
+				err := e.writeHeader()
+				if tc.valid && err != nil {
+					t.Fatal(err)
+				}
+				if !tc.valid && !errors.Is(err, ErrSizeOverflow) {
+					t.Fatalf("expected ErrSizeOverflow, got %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		defer func(size int64) { maxRIFFSize = size }(maxRIFFSize)
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: make([]int, 50)}
+		// header (44 bytes) + 100 bytes of data
+		for _, tc := range []struct {
+			maxSize int64
+			valid   bool
+		}{
+			{136, true},
+			{135, false},
+		} {
+			maxRIFFSize = tc.maxSize
+			w := &memWriter{}
+			e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			err := e.Close()
+			if tc.valid {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if size := binary.LittleEndian.Uint32(w.buf[4:]); int64(size) != tc.maxSize {
+					t.Fatalf("expected the RIFF size to be %d, got %d", tc.maxSize, size)
+				}
+				continue
+			}
+			if !errors.Is(err, ErrSizeOverflow) {
+				t.Fatalf("expected ErrSizeOverflow, got %v", err)
+			}
+			if size := binary.LittleEndian.Uint32(w.buf[4:]); size != sizePlaceholder {
+				t.Fatalf("expected the placeholder size to be left, got %d", size)
+			}
+		}
+	})
+
+	t.Run("nothing written", func(t *testing.T) {
+		w := &memWriter{}
+		e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(w.buf) != 44 || binary.LittleEndian.Uint32(w.buf[4:]) != 36 || binary.LittleEndian.Uint32(w.buf[40:]) != 0 {
+			t.Fatalf("expected an empty but valid file, got % x", w.buf)
+		}
+	})
+}
+
+func TestEncoderMetadataSizeOverflow(t *testing.T) {
+	defer func(size int64) { maxRIFFSize = size }(maxRIFFSize)
+	// pretend 32 bytes is the 32 bit limit rather than allocating 4 GB
+	maxRIFFSize = 32
+
+	testCases := []struct {
+		desc     string
+		metadata *Metadata
+		expMsg   string
+	}{
+		{"oversized field", &Metadata{Title: strings.Repeat("t", 40)}, "INAM field size"},
+		{"oversized list", &Metadata{Title: strings.Repeat("t", 10), Artist: strings.Repeat("a", 10)}, "LIST chunk size"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			e := NewEncoder(&memWriter{}, 8000, 16, 1, FormatPCM)
+			e.Metadata = tc.metadata
+			err := e.Close()
+			if !errors.Is(err, ErrSizeOverflow) {
+				t.Fatalf("expected ErrSizeOverflow, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tc.expMsg) {
+				t.Fatalf("expected the error to mention the %s, got %v", tc.expMsg, err)
+			}
+		})
+	}
+}
+
+func TestEncoderAlignDataChunk(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: []int{1, 2, 3, 4, 5, 6}}
+
+	testCases := []struct {
+		desc      string
+		boundary  int
+		validBits int
+	}{
+		{"already aligned", 4, 0},
+		{"sector", 2048, 0},
+		{"extensible fmt", 2048, 20},
+		{"small boundary", 6, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 48000, 24, 2, FormatPCM)
+			e.ValidBitsPerSample = tc.validBits
+			e.AlignDataChunk(tc.boundary)
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if e.pcmChunkPos%int64(tc.boundary) != 0 {
+				t.Fatalf("expected the audio data to start on a multiple of %d, got %d", tc.boundary, e.pcmChunkPos)
+			}
+			if id := string(w.buf[e.pcmChunkPos-8 : e.pcmChunkPos-4]); id != "data" {
+				t.Fatalf("expected the data chunk header before the audio data, got %q", id)
+			}
+			nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			exp := make([]int, len(buf.Data))
+			for i, v := range buf.Data {
+				// the decoder doesn't undo the shift of the valid bits
+				exp[i] = v
+				if tc.validBits > 0 {
+					exp[i] = v << uint(24-tc.validBits)
+				}
+			}
+			if !reflect.DeepEqual(nBuf.Data, exp) {
+				t.Fatalf("expected %v, got %v", exp, nBuf.Data)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 48000, 16, 2, FormatPCM)
+	e.AlignDataChunk(511)
+	if err := e.Write(buf); err == nil {
+		t.Fatal("expected an error with an odd boundary")
+	}
+}
+
+func TestEncoderInputBigEndian(t *testing.T) {
+	for _, tc := range []struct {
+		bitDepth int
+		// beSample is a sample serialized in big endian and exp its value
+		beSample []byte
+		exp      int
+	}{
+		{16, []byte{0x01, 0x02}, 0x0102},
+		{24, []byte{0x01, 0x02, 0x03}, 0x010203},
+		{32, []byte{0x01, 0x02, 0x03, 0x04}, 0x01020304},
+	} {
+		t.Run(fmt.Sprintf("%d bits", tc.bitDepth), func(t *testing.T) {
+			// stereo frame with the sample repeated
+			raw := append(append([]byte{}, tc.beSample...), tc.beSample...)
+			orig := append([]byte{}, raw...)
+			// the same bytes interpreted as little endian, like a decoder
+			// unaware of the source endianness would
+			leValue := 0
+			for i := len(tc.beSample) - 1; i >= 0; i-- {
+				leValue = leValue<<8 | int(tc.beSample[i])
+			}
+
+			w := &memWriter{}
+			e := NewEncoder(w, 44100, tc.bitDepth, 2, FormatPCM)
+			e.InputBigEndian = true
+			if _, err := e.WriteRaw(raw); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{leValue, leValue}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(raw, orig) {
+				t.Fatal("expected the raw input to be left untouched")
+			}
+			nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := []int{tc.exp, tc.exp, tc.exp, tc.exp}; !reflect.DeepEqual(nBuf.Data, exp) {
+				t.Fatalf("expected %#x, got %#x", exp, nBuf.Data)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+	if _, err := e.WriteRaw([]byte{1, 2, 3}); err == nil {
+		t.Fatal("expected an error for a partial frame")
+	}
+}
+
+func TestEncoderLowLatency(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	out, err := os.Create("testOutput/lowlatency.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	e := NewEncoder(out, 8000, 16, 2, FormatPCM)
+	// without LowLatency the small writes would stay in the buffer
+	e.BufferWrites = true
+	e.LowLatency = true
+	for i := 1; i <= 3; i++ {
+		// the trailing partial frame isn't written
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: []int{i, i, i, i, i}}
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(out.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := 44 + i*2*4; len(b) != exp {
+			t.Fatalf("write %d: expected %d bytes to be visible, got %d", i, exp, len(b))
+		}
+		if v := int16(binary.LittleEndian.Uint16(b[len(b)-2:])); int(v) != i {
+			t.Fatalf("write %d: expected the last sample to be %d, got %d", i, i, v)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pipeWriter is a memWriter which can't seek, like a pipe.
+type pipeWriter struct {
+	memWriter
+}
+
+func (w *pipeWriter) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("illegal seek")
+}
+
+func TestEncoderNotSeekable(t *testing.T) {
+	w := &pipeWriter{}
+	e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+	err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2}})
+	if !errors.Is(err, ErrWriterNotSeekable) {
+		t.Fatalf("expected ErrWriterNotSeekable, got %v", err)
+	}
+	if len(w.buf) != 0 {
+		t.Fatalf("expected nothing to be written, got %d bytes", len(w.buf))
+	}
+	if err := e.Close(); !errors.Is(err, ErrWriterNotSeekable) {
+		t.Fatalf("expected Close to return ErrWriterNotSeekable, got %v", err)
+	}
+}
+
+func TestEncoderRelease(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+	e.Metadata = &Metadata{Title: "released"}
+	e.SetIXML([]byte("<BWFXML/>"))
+	e.SetResU([]byte("{}"))
+	e.EnableOverview(2)
+	e.EnableLoudnessMeter(false)
+	e.EnableDCBlocker()
+	e.EnableSilenceMarkers(-60, 0)
+	e.TrimTrailingSilence(-60)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2, 3}}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	size := len(w.buf)
+
+	e.Release()
+	if e.w != nil || e.bufPool != nil || e.Metadata != nil || e.iXML != nil || e.resU != nil ||
+		e.overview != nil || e.loudness != nil || e.dcBlocker != nil || e.silence != nil || e.trim != nil {
+		t.Fatal("expected the references to be dropped")
+	}
+	if e.buffers() == nil {
+		t.Fatal("expected the buffer pool to be created again")
+	}
+	if e.WrittenBytes != size {
+		t.Fatalf("expected the counters to stay available, got %d written bytes", e.WrittenBytes)
+	}
+	if err := e.Write(buf); err == nil {
+		t.Fatal("expected writing with a released encoder to fail")
+	}
+	if err := e.WriteFrame(int16(1)); err == nil {
+		t.Fatal("expected writing a frame with a released encoder to fail")
+	}
+	if err := e.WriteFrames([]int16{1}); err == nil {
+		t.Fatal("expected writing frames with a released encoder to fail")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.buf) != size {
+		t.Fatal("expected the file to be left untouched")
+	}
+}
+
+func TestEncoderWriteHeaderNow(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 8000, 16, 2, FormatPCM)
+	if err := e.WriteHeaderNow(); err == nil {
+		t.Fatal("expected an error when the total frames weren't set")
+	}
+	e.SetTotalFrames(100)
+	if err := e.WriteHeaderNow(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.buf) != 44 {
+		t.Fatalf("expected the 44 bytes header to be written, got %d bytes", len(w.buf))
+	}
+	if riffSize, dataSize := binary.LittleEndian.Uint32(w.buf[4:]), binary.LittleEndian.Uint32(w.buf[40:]); riffSize != 436 || dataSize != 400 {
+		t.Fatalf("expected the final sizes 436/400, got %d/%d", riffSize, dataSize)
+	}
+	if err := e.WriteHeaderNow(); err == nil {
+		t.Fatal("expected an error when writing the header twice")
+	}
+
+	raw := make([]byte, 400)
+	for i := range raw {
+		raw[i] = byte(i)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := e.WriteRaw(raw[i*100 : (i+1)*100]); err != nil {
+			t.Fatal(err)
+		}
+		// the sizes are final from the start
+		if riffSize := binary.LittleEndian.Uint32(w.buf[4:]); riffSize != 436 {
+			t.Fatalf("expected the RIFF size to stay 436, got %d", riffSize)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.buf[44:], raw) {
+		t.Fatal("expected the raw data to be appended after the header")
+	}
+	if riffSize, dataSize := binary.LittleEndian.Uint32(w.buf[4:]), binary.LittleEndian.Uint32(w.buf[40:]); riffSize != 436 || dataSize != 400 {
+		t.Fatalf("expected the sizes 436/400 after Close, got %d/%d", riffSize, dataSize)
+	}
+}
+
+func TestEncoderFormType(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2}}
+	for _, tc := range []struct {
+		formType [4]byte
+		exp      string
+		valid    bool
+	}{
+		{[4]byte{}, "WAVE", true},
+		{[4]byte{'w', 'a', 'v', 'e'}, "wave", true},
+		{[4]byte{'A', 'B', 'C', ' '}, "ABC ", true},
+		{[4]byte{'A', 'B', 0, 0}, "", false},
+	} {
+		t.Run(tc.exp, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+			e.FormType = tc.formType
+			err := e.Write(buf)
+			if !tc.valid {
+				if err == nil {
+					t.Fatal("expected an invalid form type to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(w.buf[8:12]); got != tc.exp {
+				t.Fatalf("expected the form type %q, got %q", tc.exp, got)
+			}
+		})
+	}
+}
+
+func TestEncoderMetadataBytes(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2, 3}}
+
+	w := &memWriter{}
+	e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := e.MetadataBytes(); n != 0 {
+		t.Fatalf("expected no metadata bytes, got %d", n)
+	}
+
+	w = &memWriter{}
+	e = NewEncoder(w, 8000, 16, 1, FormatPCM)
+	e.Metadata = &Metadata{Title: "title"}
+	e.SetDisplayTitle("display")
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := e.MetadataBytes(); n != 0 {
+		t.Fatalf("expected no metadata bytes before Close, got %d", n)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// LIST: 8 + INFO + INAM (8 + "title\x00"), DISP: 8 + 4 + "display\x00"
+	if exp := (8 + 4 + 8 + 6) + (8 + 4 + 8); e.MetadataBytes() != exp {
+		t.Fatalf("expected %d metadata bytes, got %d", exp, e.MetadataBytes())
+	}
+	audioEnd := e.WrittenBytes - e.MetadataBytes()
+	if audioEnd != 44+6 || string(w.buf[audioEnd:audioEnd+4]) != "LIST" {
+		t.Fatalf("expected the metadata to begin at %d", audioEnd)
+	}
+}
+
+func TestEncoderInfoShortcuts(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+	e.SetComment("first take")
+	e.SetTitle("title")
+	e.SetArtist("artist")
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2, 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"ICMT\x0b\x00\x00\x00first take\x00", "INAM\x06\x00\x00\x00title\x00", "IART\x07\x00\x00\x00artist\x00"} {
+		if !bytes.Contains(w.buf, []byte(field)) {
+			t.Fatalf("expected the INFO chunk to contain %q", field)
+		}
+	}
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if m := d.Metadata; m == nil || m.Comments != "first take" || m.Title != "title" || m.Artist != "artist" {
+		t.Fatalf("expected the fields to be decoded, got %#v", d.Metadata)
+	}
+
+	// the existing metadata is kept
+	e = NewEncoder(&memWriter{}, 8000, 16, 1, FormatPCM)
+	e.Metadata = &Metadata{Engineer: "engineer"}
+	e.SetComment("comment")
+	if e.Metadata.Engineer != "engineer" || e.Metadata.Comments != "comment" {
+		t.Fatalf("expected the comment to be added to the metadata, got %#v", e.Metadata)
+	}
+}
+
+// countingWriter is a memWriter counting the calls to Write.
+type countingWriter struct {
+	memWriter
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.memWriter.Write(p)
+}
+
+func TestEncoderBufferWrites(t *testing.T) {
+	encode := func(w WriterAtSeeker, buffered bool) *Encoder {
+		e := NewEncoder(w, 8000, 16, 2, FormatPCM)
+		e.BufferWrites = buffered
+		e.Metadata = &Metadata{Title: "title", Artist: "artist", Comments: "comments"}
+		e.EnableLiveHeaderUpdates(time.Millisecond)
+		if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: make([]int, 100)}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			if err := e.WriteFrame(int16(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := e.Truncate(55); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	unbuffered := &countingWriter{}
+	encode(unbuffered, false)
+	buffered := &countingWriter{}
+	e := encode(buffered, true)
+	if !bytes.Equal(buffered.buf, unbuffered.buf) {
+		t.Fatal("expected the buffered output to match the unbuffered one")
+	}
+	if buffered.writes >= unbuffered.writes/4 {
+		t.Fatalf("expected far fewer writes when buffering, got %d vs %d", buffered.writes, unbuffered.writes)
+	}
+
+	// the buffer doesn't hide the underlying writer
+	os.Mkdir("testOutput", 0777)
+	f, err := os.Create("testOutput/buffered.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	e = e.Clone(f)
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: make([]int, 100)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CloseWriter(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err == nil {
+		t.Fatal("expected CloseWriter to close the file")
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != e.WrittenBytes {
+		t.Fatalf("expected %d bytes to be flushed, got %d", e.WrittenBytes, len(b))
+	}
+}
+
+func BenchmarkEncoderSmallFile(b *testing.B) {
+	os.Mkdir("testOutput", 0777)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 200)}
+	for _, buffered := range []bool{false, true} {
+		b.Run(fmt.Sprintf("buffered %t", buffered), func(b *testing.B) {
+			f, err := os.Create("testOutput/small.wav")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+			for i := 0; i < b.N; i++ {
+				if err := f.Truncate(0); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := f.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				e := NewEncoder(f, 44100, 16, 2, FormatPCM)
+				e.BufferWrites = buffered
+				e.Metadata = &Metadata{Title: "title", Artist: "artist", Software: "bench"}
+				if err := e.Write(buf); err != nil {
+					b.Fatal(err)
+				}
+				if err := e.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderInfoAndAdtlLists(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2, 3, 4}}
+
+	w := &memWriter{}
+	e := NewEncoder(w, 8000, 16, 1, FormatPCM)
+	e.Metadata = &Metadata{
+		Title: "title",
+		CuePoints: []*CuePoint{
+			NewCuePointAt(1, 0, 8000),
+			NewCuePointAt(2, 0, 8000),
+			NewCuePointAt(3, 0, 8000),
+		},
+	}
+	e.Metadata.CuePoints[0].Label = "intro"
+	e.Metadata.CuePoints[2].Label = "verse"
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// walk the chunks following the data chunk
+	var lists []string
+	for pos := 44 + 8; pos < len(w.buf); {
+		id := string(w.buf[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(w.buf[pos+4:]))
+		if id == "LIST" {
+			lists = append(lists, string(w.buf[pos+8:pos+12]))
+		}
+		pos += 8 + size + size%2
+		if pos > len(w.buf) {
+			t.Fatalf("the %s chunk size %d overflows the file", id, size)
+		}
+	}
+	if exp := []string{"INFO", "adtl"}; !reflect.DeepEqual(lists, exp) {
+		t.Fatalf("expected the LIST chunks %v, got %v", exp, lists)
+	}
+
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata.Title != "title" {
+		t.Fatalf("expected the title to be decoded, got %q", d.Metadata.Title)
+	}
+	if len(d.Metadata.CuePoints) != 3 {
+		t.Fatalf("expected 3 cue points, got %d", len(d.Metadata.CuePoints))
+	}
+	for i, exp := range []string{"intro", "", "verse"} {
+		if label := d.Metadata.CuePoints[i].Label; label != exp {
+			t.Errorf("cue point %d: expected the label %q, got %q", i, exp, label)
+		}
+	}
+}
+
+func TestEncoderWriteEmptyBuffer(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 44100, 16, 2, FormatPCM)
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	if err := e.Write(&audio.IntBuffer{Format: format}); err != nil {
+		t.Fatal(err)
+	}
+	if e.pcmChunkStarted || e.WrittenBytes != 0 || len(w.buf) != 0 {
+		t.Fatalf("expected an empty write not to start the data chunk, %d bytes were written", len(w.buf))
+	}
+
+	if err := e.Write(&audio.IntBuffer{Format: format, Data: []int{1, -1, 2, -2}}); err != nil {
+		t.Fatal(err)
+	}
+	if !e.pcmChunkStarted {
+		t.Fatal("expected the first write of samples to start the data chunk")
+	}
+	if err := e.Write(&audio.IntBuffer{Format: format, Data: []int{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buf.Data, []int{1, -1, 2, -2}) {
+		t.Fatalf("unexpected samples %v", buf.Data)
+	}
+}
+
+func TestEncoderWrite24Allocations(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 48000}
+	e := NewEncoder(discardWriter{}, 48000, 24, 2, FormatPCM)
+	allocs := func(samples int) float64 {
+		buf := &audio.IntBuffer{Format: format, Data: make([]int, samples)}
+		for i := range buf.Data {
+			buf.Data[i] = i<<8 - 1<<20
+		}
+		return testing.AllocsPerRun(100, func() {
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	small, large := allocs(64), allocs(4096)
+	if large != small {
+		t.Fatalf("expected no allocation per sample, got %v allocations for 64 samples and %v for 4096", small, large)
+	}
+}
+
+func BenchmarkEncoderWrite24(b *testing.B) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: make([]int, 4096)}
+	for i := range buf.Data {
+		buf.Data[i] = i<<8 - 1<<20
+	}
+	e := NewEncoder(discardWriter{}, 48000, 24, 2, FormatPCM)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf.Data) * 3))
+	for i := 0; i < b.N; i++ {
+		if err := e.Write(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
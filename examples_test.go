@@ -1,9 +1,13 @@
 package wav
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"os"
+	"time"
+
+	"github.com/go-audio/audio"
 )
 
 func ExampleDecoder_Duration() {
@@ -17,7 +21,7 @@ func ExampleDecoder_Duration() {
 		log.Fatal(err)
 	}
 	fmt.Printf("%s duration: %s\n", f.Name(), dur)
-	// Output: fixtures/kick.wav duration: 204.172335ms
+	// Output: fixtures/kick.wav duration: 203.35601ms
 }
 
 func ExampleDecoder_IsValidFile() {
@@ -84,6 +88,30 @@ func ExampleEncoder_Write() {
 	// New file -> Format: WAVE - 1 channels @ 22050 / 16 bits - Duration: 0.204172 seconds
 }
 
+func ExampleSliceWriter() {
+	// size the output for one second of audio, a memory mapped region of a
+	// file truncated to that size (see syscall.Mmap) can be used the same way.
+	size := EstimateSize(8000, 16, 1, FormatPCM, time.Second, nil)
+	region := make([]byte, size)
+
+	w := NewSliceWriter(region)
+	e := NewEncoder(w, 8000, 16, 1, 1)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: make([]int, 8000)}
+	if err := e.Write(buf); err != nil {
+		panic(err)
+	}
+	if err := e.Close(); err != nil {
+		panic(err)
+	}
+
+	decoded, err := NewDecoder(bytes.NewReader(region[:w.Len()])).FullPCMBuffer()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("wrote %d of %d bytes, %d frames\n", w.Len(), size, decoded.NumFrames())
+	// Output: wrote 16044 of 16044 bytes, 8000 frames
+}
+
 func ExampleDecoder_ReadMetadata() {
 	f, err := os.Open("fixtures/listinfo.wav")
 	if err != nil {
@@ -97,5 +125,5 @@ func ExampleDecoder_ReadMetadata() {
 	}
 	fmt.Printf("%#v\n", d.Metadata)
 	// Output:
-	// &wav.Metadata{SamplerInfo:(*wav.SamplerInfo)(nil), Artist:"artist", Comments:"my comment", Copyright:"", CreationDate:"2017", Engineer:"", Technician:"", Genre:"genre", Keywords:"", Medium:"", Title:"track title", Product:"album title", Subject:"", Software:"", Source:"", Location:"", TrackNbr:"42", CuePoints:[]*wav.CuePoint(nil)}
+	// &wav.Metadata{SamplerInfo:(*wav.SamplerInfo)(nil), Artist:"artist", Comments:"my comment", Copyright:"", CreationDate:"2017", Engineer:"", Technician:"", Genre:"genre", Keywords:"", Medium:"", Title:"track title", Product:"album title", Subject:"", Software:"", Source:"", Location:"", TrackNbr:"42", Commissioned:"", Language:"", Part:"", SourceForm:"", Bext:(*wav.BextChunk)(nil), IXML:[]uint8(nil), ResU:[]uint8(nil), Gapless:(*wav.GaplessInfo)(nil), CuePoints:[]*wav.CuePoint(nil)}
 }
@@ -0,0 +1,349 @@
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+// RoundingMode defines how float samples are quantized to integer samples.
+type RoundingMode int
+
+const (
+	// RoundNearest rounds to the nearest integer, half away from zero.
+	RoundNearest RoundingMode = iota
+	// RoundNearestEven rounds to the nearest integer, half to even.
+	RoundNearestEven
+	// RoundTruncate rounds toward zero.
+	RoundTruncate
+)
+
+// NoiseShapingMode defines how the quantization error of float samples is fed
+// back to shape its spectrum.
+type NoiseShapingMode int
+
+const (
+	// NoiseShapingOff quantizes each sample independently, the quantization
+	// noise is flat.
+	NoiseShapingOff NoiseShapingMode = iota
+	// NoiseShapingFirstOrder subtracts the quantization error of the
+	// previous sample of the same channel before quantizing, which pushes
+	// the noise toward the high frequencies where the ear is less sensitive.
+	NoiseShapingFirstOrder
+)
+
+// WriteFloat encodes and writes the passed float buffer. Samples are expected
+// to be in the [-1, 1] range. When the audio format is IEEE float (3), the
+// samples are written as 32 or 64 bit floats, otherwise they are quantized to
+// the encoder bit depth using its RoundingMode, after adding noise if Dither
+// is set and shaping the quantization error according to NoiseShaping, and
+// clipped to full scale.
+// NaN samples are written as silence and infinite samples as full scale, in
+// Strict mode they are refused with ErrNonFiniteSample and nothing is written.
+func (e *Encoder) WriteFloat(buf *audio.FloatBuffer) error {
+	if buf == nil {
+		return fmt.Errorf("can't add a nil buffer")
+	}
+	if e.Strict {
+		for i, v := range buf.Data {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("%w: sample %d is %v", ErrNonFiniteSample, i, v)
+			}
+		}
+	}
+	if e.UpmixMono {
+		var err error
+		if buf, err = e.upmixFloat(buf); err != nil {
+			return err
+		}
+	}
+	if err := e.writeSetup(); err != nil {
+		return err
+	}
+	numChans := e.NumChans
+	if buf.Format != nil {
+		numChans = buf.Format.NumChannels
+	}
+	if numChans < 1 {
+		return fmt.Errorf("invalid number of channels %d", numChans)
+	}
+	if e.dcBlocker != nil {
+		buf = &audio.FloatBuffer{Format: buf.Format, Data: e.blockDCFloat(buf.Data, numChans)}
+	}
+
+	if e.WavAudioFormat == FormatIEEEFloat {
+		return e.addFloatBuffer(buf)
+	}
+	intBuf := &audio.IntBuffer{Format: buf.Format, Data: make([]int, len(buf.Data)), SourceBitDepth: e.BitDepth}
+	// the lock guards the dither and noise shaping states
+	e.lock()
+	for i, v := range buf.Data {
+		intBuf.Data[i] = e.quantize(v, i%numChans)
+	}
+	e.unlock()
+	_, err := e.addBuffer(intBuf, nil)
+	return err
+}
+
+// WriteFloat32 encodes and writes the passed interleaved float32 samples, as
+// produced by ML and DSP pipelines, attenuated by HeadroomDB. The samples
+// still out of the [-1, 1] range are clamped to full scale and counted in
+// ClippedSamples, then they are written like with WriteFloat. The samples
+// must be whole frames.
+func (e *Encoder) WriteFloat32(samples []float32) error {
+	numChans := e.NumChans
+	if numChans < 1 || len(samples)%numChans != 0 {
+		return fmt.Errorf("%d samples aren't whole frames of %d channels", len(samples), numChans)
+	}
+	if e.Strict {
+		for i, v := range samples {
+			if f := float64(v); math.IsNaN(f) || math.IsInf(f, 0) {
+				return fmt.Errorf("%w: sample %d is %v", ErrNonFiniteSample, i, v)
+			}
+		}
+	}
+	gain := 1.0
+	if e.HeadroomDB > 0 {
+		gain = math.Pow(10, -e.HeadroomDB/20)
+	}
+	data := make([]float64, len(samples))
+	clipped := 0
+	for i := range data {
+		v := finite(float64(samples[i])) * gain
+		if v > 1 {
+			v = 1
+			clipped++
+		} else if v < -1 {
+			v = -1
+			clipped++
+		}
+		data[i] = v
+	}
+	if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: numChans, SampleRate: e.SampleRate}, Data: data}); err != nil {
+		return err
+	}
+	e.addClipped(clipped)
+	return nil
+}
+
+// WriteAudio encodes and writes the passed buffer by dispatching it to Write
+// or WriteFloat depending on its concrete type. *audio.IntBuffer,
+// *audio.FloatBuffer and *audio.Float32Buffer are supported.
+func (e *Encoder) WriteAudio(buf audio.Buffer) error {
+	switch b := buf.(type) {
+	case *audio.IntBuffer:
+		return e.Write(b)
+	case *audio.FloatBuffer:
+		return e.WriteFloat(b)
+	case *audio.Float32Buffer:
+		return e.WriteFloat(b.AsFloatBuffer())
+	default:
+		return fmt.Errorf("unsupported buffer type %T", buf)
+	}
+}
+
+// WriteFloatPlanar encodes and writes non interleaved float samples, one slice
+// per channel, all of the same length. The samples are interleaved while being
+// converted so no interleaved copy is needed: they are written as 32 or 64 bit
+// floats when the audio format is IEEE float (3), and quantized like with
+// WriteFloat otherwise.
+func (e *Encoder) WriteFloatPlanar(channels [][]float64) error {
+	if len(channels) == 0 || len(channels) != e.NumChans {
+		return fmt.Errorf("expected %d channels, got %d", e.NumChans, len(channels))
+	}
+	frames := len(channels[0])
+	for i, ch := range channels {
+		if len(ch) != frames {
+			return fmt.Errorf("channel %d has %d samples, expected %d", i, len(ch), frames)
+		}
+	}
+	if e.Strict {
+		for i, ch := range channels {
+			for j, v := range ch {
+				if math.IsNaN(v) || math.IsInf(v, 0) {
+					return fmt.Errorf("%w: sample %d of channel %d is %v", ErrNonFiniteSample, j, i, v)
+				}
+			}
+		}
+	}
+	if err := e.writeSetup(); err != nil {
+		return err
+	}
+	if e.dcBlocker != nil {
+		channels = e.blockDCPlanar(channels)
+	}
+
+	numChans := len(channels)
+	if e.WavAudioFormat != FormatIEEEFloat {
+		intBuf := &audio.IntBuffer{
+			Format:         &audio.Format{NumChannels: numChans, SampleRate: e.SampleRate},
+			Data:           make([]int, frames*numChans),
+			SourceBitDepth: e.BitDepth,
+		}
+		// the samples are quantized in the interleaved order so the dither
+		// matches the one of WriteFloat
+		e.lock()
+		for i := 0; i < frames; i++ {
+			for c, ch := range channels {
+				intBuf.Data[i*numChans+c] = e.quantize(ch[i], c)
+			}
+		}
+		e.unlock()
+		_, err := e.addBuffer(intBuf, nil)
+		return err
+	}
+
+	var b []byte
+	switch e.BitDepth {
+	case 32:
+		b = make([]byte, frames*numChans*4)
+		for c, ch := range channels {
+			for i, v := range ch {
+				binary.LittleEndian.PutUint32(b[(i*numChans+c)*4:], math.Float32bits(float32(finite(v))))
+			}
+		}
+	case 64:
+		b = make([]byte, frames*numChans*8)
+		for c, ch := range channels {
+			for i, v := range ch {
+				binary.LittleEndian.PutUint64(b[(i*numChans+c)*8:], math.Float64bits(finite(v)))
+			}
+		}
+	default:
+		return fmt.Errorf("can't add float frames of bit size %d", e.BitDepth)
+	}
+	if e.silence != nil {
+		e.lock()
+		e.silence.analyzePlanar(channels, e.frames)
+		e.unlock()
+	}
+	if e.trim != nil {
+		e.lock()
+		e.trim.analyzePlanar(channels, e.frames)
+		e.unlock()
+	}
+	if e.overview != nil {
+		e.lock()
+		e.overview.analyzePlanar(channels)
+		e.unlock()
+	}
+	if e.loudness != nil {
+		e.lock()
+		e.loudness.analyzePlanar(channels)
+		e.unlock()
+	}
+	_, err := e.addBytes(b, frames)
+	return err
+}
+
+// quantize converts a float sample to an integer sample of the encoder bit
+// depth, or to ValidBitsPerSample when set. 8 bit samples are unsigned.
+// c is the channel of the sample, whose quantization error is fed back when
+// NoiseShaping is set. It must be called under the lock when Dither or
+// NoiseShaping are set.
+func (e *Encoder) quantize(v float64, c int) int {
+	scale := float64(int64(1) << (uint(e.BitDepth-1) - e.sampleShift()))
+	v = finite(v) * scale
+	if e.NoiseShaping == NoiseShapingFirstOrder {
+		for c >= len(e.shapingErr) {
+			e.shapingErr = append(e.shapingErr, 0)
+		}
+		v -= e.shapingErr[c]
+	}
+	target := v
+	if e.Dither {
+		if e.dither == nil {
+			e.dither = newDitherSource(e.ditherSeed)
+		}
+		v += e.dither.tpdf()
+	}
+	switch e.RoundingMode {
+	case RoundNearestEven:
+		v = math.RoundToEven(v)
+	case RoundTruncate:
+		v = math.Trunc(v)
+	default:
+		v = math.Round(v)
+	}
+	if v > scale-1 {
+		v = scale - 1
+	} else if v < -scale {
+		v = -scale
+	}
+	if e.NoiseShaping == NoiseShapingFirstOrder {
+		// the error is bounded so clipped samples don't make the feedback
+		// diverge
+		e.shapingErr[c] = math.Max(-1, math.Min(1, v-target))
+	}
+	if e.BitDepth == 8 {
+		return int(v) + 128
+	}
+	return int(v)
+}
+
+// addFloatBuffer writes the samples as IEEE floats.
+func (e *Encoder) addFloatBuffer(buf *audio.FloatBuffer) error {
+	numChans := e.NumChans
+	if buf.Format != nil {
+		numChans = buf.Format.NumChannels
+	}
+	if numChans < 1 {
+		return fmt.Errorf("invalid number of channels %d", numChans)
+	}
+	frames := len(buf.Data) / numChans
+	data := buf.Data[:frames*numChans]
+
+	var b []byte
+	switch e.BitDepth {
+	case 32:
+		b = make([]byte, len(data)*4)
+		for i, v := range data {
+			binary.LittleEndian.PutUint32(b[i*4:], math.Float32bits(float32(finite(v))))
+		}
+	case 64:
+		b = make([]byte, len(data)*8)
+		for i, v := range data {
+			binary.LittleEndian.PutUint64(b[i*8:], math.Float64bits(finite(v)))
+		}
+	default:
+		return fmt.Errorf("can't add float frames of bit size %d", e.BitDepth)
+	}
+	if e.silence != nil {
+		e.lock()
+		e.silence.analyzeFloat(data, numChans, e.frames)
+		e.unlock()
+	}
+	if e.trim != nil {
+		e.lock()
+		e.trim.analyzeFloat(data, numChans, e.frames)
+		e.unlock()
+	}
+	if e.overview != nil {
+		e.lock()
+		e.overview.analyzeFloat(data, numChans)
+		e.unlock()
+	}
+	if e.loudness != nil {
+		e.lock()
+		e.loudness.analyzeFloat(data, numChans)
+		e.unlock()
+	}
+	_, err := e.addBytes(b, frames)
+	return err
+}
+
+// finite replaces NaN with silence and clamps infinite values to full scale
+// so they don't end up in the file.
+func finite(v float64) float64 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case math.IsInf(v, 1):
+		return 1
+	case math.IsInf(v, -1):
+		return -1
+	}
+	return v
+}
@@ -0,0 +1,359 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderWriteFloatRoundingMode(t *testing.T) {
+	// values landing exactly between two 16 bit steps or beyond full scale
+	in := []float64{0.5, 1.5, 2.5, -0.5, -1.5, -2.5, 1.25, 32768, -32769}
+	for i := range in {
+		in[i] /= 32768
+	}
+
+	testCases := []struct {
+		desc string
+		mode RoundingMode
+		exp  []int
+	}{
+		{"nearest", RoundNearest, []int{1, 2, 3, -1, -2, -3, 1, 32767, -32768}},
+		{"nearest even", RoundNearestEven, []int{0, 2, 2, 0, -2, -2, 1, 32767, -32768}},
+		{"truncate", RoundTruncate, []int{0, 1, 2, 0, -1, -2, 1, 32767, -32768}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 44100, 16, 1, 1)
+			e.RoundingMode = tc.mode
+			buf := &audio.FloatBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, Data: in}
+			if err := e.WriteFloat(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(nBuf.Data, tc.exp) {
+				t.Fatalf("expected %v, got %v", tc.exp, nBuf.Data)
+			}
+		})
+	}
+}
+
+func TestEncoderWriteFloat(t *testing.T) {
+	in := []float64{0, 0.5, -0.5, 1, -1, 0.25}
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+
+	t.Run("8 bit", func(t *testing.T) {
+		w := &memWriter{}
+		e := NewEncoder(w, 44100, 8, 2, 1)
+		if err := e.WriteFloat(&audio.FloatBuffer{Format: format, Data: in}); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		exp := []byte{128, 192, 64, 255, 0, 160}
+		if !bytes.Equal(w.buf[44:], exp) {
+			t.Fatalf("expected %v, got %v", exp, w.buf[44:])
+		}
+	})
+
+	for _, bitDepth := range []int{32, 64} {
+		w := &memWriter{}
+		e := NewEncoder(w, 44100, bitDepth, 2, 3)
+		if err := e.WriteFloat(&audio.FloatBuffer{Format: format, Data: in}); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if size := binary.LittleEndian.Uint32(w.buf[40:]); int(size) != len(in)*bitDepth/8 {
+			t.Fatalf("expected a %d bytes data chunk, got %d", len(in)*bitDepth/8, size)
+		}
+		for i, v := range in {
+			var got float64
+			if bitDepth == 32 {
+				got = float64(math.Float32frombits(binary.LittleEndian.Uint32(w.buf[44+i*4:])))
+			} else {
+				got = math.Float64frombits(binary.LittleEndian.Uint64(w.buf[44+i*8:]))
+			}
+			if got != v {
+				t.Fatalf("%d bits sample %d: expected %f, got %f", bitDepth, i, v, got)
+			}
+		}
+	}
+}
+
+func TestEncoderWriteAudio(t *testing.T) {
+	format := &audio.Format{NumChannels: 1, SampleRate: 44100}
+	testCases := []struct {
+		desc string
+		buf  audio.Buffer
+	}{
+		{"int", &audio.IntBuffer{Format: format, Data: []int{0, 16384, -16384, 32767}}},
+		{"float", &audio.FloatBuffer{Format: format, Data: []float64{0, 0.5, -0.5, 1}}},
+		{"float32", &audio.Float32Buffer{Format: format, Data: []float32{0, 0.5, -0.5, 1}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 44100, 16, 1, 1)
+			if err := e.WriteAudio(tc.buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exp := []int{0, 16384, -16384, 32767}; !reflect.DeepEqual(nBuf.Data, exp) {
+				t.Fatalf("expected %v, got %v", exp, nBuf.Data)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 44100, 16, 1, 1)
+	if err := e.WriteAudio(&audio.PCMBuffer{Format: format}); err == nil {
+		t.Fatal("expected an error for an unsupported buffer type")
+	}
+}
+
+func TestEncoderWriteFloatNonFinite(t *testing.T) {
+	in := []float64{math.NaN(), math.Inf(1), math.Inf(-1), 0.5}
+	format := &audio.Format{NumChannels: 1, SampleRate: 44100}
+
+	t.Run("PCM", func(t *testing.T) {
+		w := &memWriter{}
+		e := NewEncoder(w, 44100, 16, 1, 1)
+		if err := e.WriteFloat(&audio.FloatBuffer{Format: format, Data: in}); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp := []int{0, 32767, -32768, 16384}; !reflect.DeepEqual(nBuf.Data, exp) {
+			t.Fatalf("expected %v, got %v", exp, nBuf.Data)
+		}
+	})
+
+	t.Run("IEEE float", func(t *testing.T) {
+		w := &memWriter{}
+		e := NewEncoder(w, 44100, 32, 1, 3)
+		if err := e.WriteFloat(&audio.FloatBuffer{Format: format, Data: in}); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		exp := []float32{0, 1, -1, 0.5}
+		for i, v := range exp {
+			if got := math.Float32frombits(binary.LittleEndian.Uint32(w.buf[44+i*4:])); got != v {
+				t.Fatalf("sample %d: expected %v, got %v", i, v, got)
+			}
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		w := &memWriter{}
+		e := NewEncoder(w, 44100, 16, 1, 1)
+		e.Strict = true
+		err := e.WriteFloat(&audio.FloatBuffer{Format: format, Data: in})
+		if !errors.Is(err, ErrNonFiniteSample) {
+			t.Fatalf("expected ErrNonFiniteSample, got %v", err)
+		}
+		if e.frames != 0 || len(w.buf) != 0 {
+			t.Fatal("expected nothing to be written")
+		}
+	})
+}
+
+func TestEncoderWriteFloatPlanar(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		channels [][]float64
+		format   int
+		bitDepth int
+	}{
+		{"mono float", [][]float64{{0, 0.5, -0.5, 1}}, FormatIEEEFloat, 32},
+		{"stereo float", [][]float64{{0, 0.5, -0.5}, {1, -1, 0.25}}, FormatIEEEFloat, 32},
+		{"stereo double", [][]float64{{0, 0.5, -0.5}, {1, -1, 0.25}}, FormatIEEEFloat, 64},
+		{"stereo pcm", [][]float64{{0, 0.5, -0.5}, {1, -1, 0.25}}, FormatPCM, 16},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			numChans := len(tc.channels)
+			interleaved := make([]float64, 0, numChans*len(tc.channels[0]))
+			for i := range tc.channels[0] {
+				for _, ch := range tc.channels {
+					interleaved = append(interleaved, ch[i])
+				}
+			}
+			exp := &memWriter{}
+			e := NewEncoder(exp, 44100, tc.bitDepth, numChans, tc.format)
+			buf := &audio.FloatBuffer{Format: &audio.Format{NumChannels: numChans, SampleRate: 44100}, Data: interleaved}
+			if err := e.WriteFloat(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			w := &memWriter{}
+			e = NewEncoder(w, 44100, tc.bitDepth, numChans, tc.format)
+			if err := e.WriteFloatPlanar(tc.channels); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w.buf, exp.buf) {
+				t.Fatalf("expected the planar samples to be written like the interleaved ones\n%v\n%v", exp.buf, w.buf)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 44100, 32, 2, FormatIEEEFloat)
+	if err := e.WriteFloatPlanar([][]float64{{0, 1}}); err == nil {
+		t.Fatal("expected an error when the channel count doesn't match")
+	}
+	if err := e.WriteFloatPlanar([][]float64{{0, 1}, {0}}); err == nil {
+		t.Fatal("expected an error when the channels have different lengths")
+	}
+}
+
+func TestEncoderNoiseShaping(t *testing.T) {
+	const lsb = 1.0 / 32768
+	encode := func(e *Encoder, bufs ...[]float64) []int {
+		for _, data := range bufs {
+			if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: data}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		out := e.w.(*memWriter).buf[44:]
+		samples := make([]int, len(out)/2)
+		for i := range samples {
+			samples[i] = int(int16(le16(out[i*2:])))
+		}
+		return samples
+	}
+
+	// a constant of 0.3 LSB on the left channel and -0.6 LSB on the right
+	data := make([]float64, 2000)
+	for i := 0; i < len(data); i += 2 {
+		data[i], data[i+1] = 0.3*lsb, -0.6*lsb
+	}
+
+	e := NewEncoder(&memWriter{}, 8000, 16, 2, FormatPCM)
+	e.NoiseShaping = NoiseShapingFirstOrder
+	if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: data[:6]}); err != nil {
+		t.Fatal(err)
+	}
+	// left: 0.3 -> 0 (error -0.3), 0.6 -> 1 (error 0.4), -0.1 -> 0 (error 0.1)
+	// right: -0.6 -> -1 (error -0.4), -0.2 -> 0 (error 0.2), -0.8 -> -1 (error -0.2)
+	exp := []float64{0.1, -0.2}
+	for c, v := range e.shapingErr {
+		if math.Abs(v-exp[c]) > 1e-9 {
+			t.Fatalf("expected the errors %v, got %v", exp, e.shapingErr)
+		}
+	}
+
+	// the error carries across buffers
+	whole := NewEncoder(&memWriter{}, 8000, 16, 2, FormatPCM)
+	whole.NoiseShaping = NoiseShapingFirstOrder
+	split := whole.Clone(&memWriter{})
+	shaped := encode(whole, data)
+	if got := encode(split, data[:500], data[500:]); !reflect.DeepEqual(got, shaped) {
+		t.Fatal("expected the shaping state to carry across buffers")
+	}
+
+	// the feedback keeps the average of each channel while plain rounding
+	// loses the signal
+	var sums [2]int
+	for i, v := range shaped {
+		sums[i%2] += v
+	}
+	frames := float64(len(shaped) / 2)
+	if left, right := float64(sums[0])/frames, float64(sums[1])/frames; math.Abs(left-0.3) > 0.01 || math.Abs(right+0.6) > 0.01 {
+		t.Fatalf("expected the averages to be 0.3 and -0.6 LSB, got %f and %f", left, right)
+	}
+	flat := encode(NewEncoder(&memWriter{}, 8000, 16, 2, FormatPCM), data)
+	for i, v := range flat {
+		if exp := []int{0, -1}[i%2]; v != exp {
+			t.Fatalf("expected sample %d to be rounded to %d without shaping, got %d", i, exp, v)
+		}
+	}
+}
+
+func TestEncoderWriteFloat32(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		headroom   float64
+		peak       float32
+		expPeak    int
+		expClipped int
+	}{
+		{"full scale", 0, 1, 32767, 0},
+		// 32768 * 10^(-1/20)
+		{"1dB headroom", 1, 1, 29205, 0},
+		{"over full scale", 0, 1.5, 32767, 2},
+		// 1.5 * 32768 * 10^(-6/20)
+		{"over full scale with headroom", 6, 1.5, 24634, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 48000, 16, 2, FormatPCM)
+			e.HeadroomDB = tc.headroom
+			samples := []float32{tc.peak, -tc.peak, 0.5, -0.5}
+			if err := e.WriteFloat32(samples); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			buf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(buf.Data) != 4 {
+				t.Fatalf("expected 2 frames, got %v", buf.Data)
+			}
+			if d := buf.Data[0] - tc.expPeak; d < -1 || d > 1 {
+				t.Fatalf("expected a peak of %d, got %d", tc.expPeak, buf.Data[0])
+			}
+			if buf.Data[1] > -buf.Data[0] {
+				t.Fatalf("expected a negative peak of at least %d, got %d", -buf.Data[0], buf.Data[1])
+			}
+			if e.ClippedSamples() != tc.expClipped {
+				t.Fatalf("expected %d clipped samples, got %d", tc.expClipped, e.ClippedSamples())
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 48000, 16, 2, FormatPCM)
+	if err := e.WriteFloat32([]float32{0.5, -0.5, 0}); err == nil {
+		t.Fatal("expected a trailing partial frame to be refused")
+	}
+}
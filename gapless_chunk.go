@@ -0,0 +1,84 @@
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/riff"
+)
+
+// GaplessInfo describes the frames to skip for gapless playback of
+// concatenated tracks, for instance when the file is an intermediate before
+// a lossy encoding.
+type GaplessInfo struct {
+	// Delay is the number of leading frames added by the encoder (or the
+	// decoder) before the audio of the track.
+	Delay int
+	// Padding is the number of trailing frames added to complete the last
+	// block after the audio of the track.
+	Padding int
+}
+
+// gaplessChunkSize is the size of the gapl chunk data: the delay and the
+// padding as 32 bit values.
+const gaplessChunkSize = 4 + 4
+
+// SetGaplessInfo sets the leading delay and trailing padding, in frames,
+// written in a gapl chunk on Close so players can trim them and join the
+// tracks of an album without gaps. It takes precedence over
+// Metadata.Gapless. The counts can't be negative.
+func (e *Encoder) SetGaplessInfo(delay, padding int) error {
+	if delay < 0 || padding < 0 || int64(delay) > 0xFFFFFFFF || int64(padding) > 0xFFFFFFFF {
+		return fmt.Errorf("invalid gapless delay %d and padding %d", delay, padding)
+	}
+	e.gapless = &GaplessInfo{Delay: delay, Padding: padding}
+	return nil
+}
+
+// gaplessInfo returns the gapless info to write, nil if there is none.
+func (e *Encoder) gaplessInfo() *GaplessInfo {
+	if e.gapless != nil {
+		return e.gapless
+	}
+	if e.Metadata != nil {
+		return e.Metadata.Gapless
+	}
+	return nil
+}
+
+func encodeGaplessChunk(g *GaplessInfo) []byte {
+	data := make([]byte, gaplessChunkSize)
+	binary.LittleEndian.PutUint32(data, uint32(g.Delay))
+	binary.LittleEndian.PutUint32(data[4:], uint32(g.Padding))
+	return data
+}
+
+// DecodeGaplessChunk decodes a gapl chunk and stores its values in
+// d.Metadata.Gapless.
+func DecodeGaplessChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID != CIDGapl {
+		return nil
+	}
+	if ch.Size < gaplessChunkSize {
+		return fmt.Errorf("the gapless chunk is too short, %d bytes", ch.Size)
+	}
+	buf := make([]byte, ch.Size)
+	if _, err := io.ReadFull(ch, buf); err != nil {
+		return fmt.Errorf("failed to read the gapless chunk - %w", err)
+	}
+	if d.Metadata == nil {
+		d.Metadata = &Metadata{}
+	}
+	d.Metadata.Gapless = &GaplessInfo{
+		Delay:   int(binary.LittleEndian.Uint32(buf)),
+		Padding: int(binary.LittleEndian.Uint32(buf[4:])),
+	}
+	return nil
+}
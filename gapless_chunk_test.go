@@ -0,0 +1,71 @@
+package wav
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderGaplessInfo(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		set      *GaplessInfo
+		metadata *GaplessInfo
+		exp      GaplessInfo
+	}{
+		{"set", &GaplessInfo{Delay: 576, Padding: 1234}, nil, GaplessInfo{Delay: 576, Padding: 1234}},
+		{"from metadata", nil, &GaplessInfo{Delay: 2112, Padding: 0}, GaplessInfo{Delay: 2112}},
+		{"precedence", &GaplessInfo{Delay: 1, Padding: 2}, &GaplessInfo{Delay: 3, Padding: 4}, GaplessInfo{Delay: 1, Padding: 2}},
+		{"max", &GaplessInfo{Delay: 0xFFFFFFFF, Padding: 0xFFFFFFFF}, nil, GaplessInfo{Delay: 0xFFFFFFFF, Padding: 0xFFFFFFFF}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 44100, 16, 2, FormatPCM)
+			e.Metadata = &Metadata{Title: "track 2", Gapless: tc.metadata}
+			if tc.set != nil {
+				if err := e.SetGaplessInfo(tc.set.Delay, tc.set.Padding); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{1, 2, 3, 4}}); err != nil {
+				t.Fatal(err)
+			}
+			planned := e.PlannedChunks()
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			chunks := fileChunks(w.buf)
+			if last := chunks[len(chunks)-1]; last.ID != CIDGapl || last.Size != gaplessChunkSize {
+				t.Fatalf("expected the file to end with the gapless chunk, got %v", chunks)
+			}
+			if len(planned) != len(chunks) || planned[len(planned)-1] != chunks[len(chunks)-1] {
+				t.Fatalf("expected the planned chunks %v to match the written ones %v", planned, chunks)
+			}
+
+			d := NewDecoder(bytes.NewReader(w.buf))
+			d.ReadMetadata()
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d.Metadata == nil || d.Metadata.Gapless == nil || *d.Metadata.Gapless != tc.exp {
+				t.Fatalf("expected the gapless info %+v, got %#v", tc.exp, d.Metadata)
+			}
+			if d.Metadata.Title != "track 2" {
+				t.Fatalf("expected the INFO chunk to be decoded, got %q", d.Metadata.Title)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+	for _, v := range [][2]int{{-1, 0}, {0, -1}, {1 << 32, 0}} {
+		if err := e.SetGaplessInfo(v[0], v[1]); err == nil {
+			t.Errorf("expected the delay %d and padding %d to be refused", v[0], v[1])
+		}
+	}
+	if e.gaplessInfo() != nil {
+		t.Fatal("expected the refused values not to be set")
+	}
+}
@@ -0,0 +1,115 @@
+package wav
+
+import (
+	"sync"
+	"time"
+)
+
+// InstrumentedWriter wraps a WriterAtSeeker to count the calls made by an
+// encoder and the bytes written, and to time them, for instance to export
+// write throughput and latency metrics. It is safe for concurrent use. The
+// optional interfaces of the wrapped writer, such as the Truncate method of
+// *os.File, aren't exposed.
+type InstrumentedWriter struct {
+	w WriterAtSeeker
+
+	mu            sync.Mutex
+	writes        int
+	writeAts      int
+	seeks         int
+	bytes         int64
+	writeDuration time.Duration
+	maxLatency    time.Duration
+}
+
+// NewInstrumentedWriter returns a writer recording the calls made to w.
+func NewInstrumentedWriter(w WriterAtSeeker) *InstrumentedWriter {
+	return &InstrumentedWriter{w: w}
+}
+
+func (iw *InstrumentedWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := iw.w.Write(p)
+	iw.record(&iw.writes, n, time.Since(start))
+	return n, err
+}
+
+func (iw *InstrumentedWriter) WriteAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := iw.w.WriteAt(p, off)
+	iw.record(&iw.writeAts, n, time.Since(start))
+	return n, err
+}
+
+func (iw *InstrumentedWriter) Seek(offset int64, whence int) (int64, error) {
+	iw.mu.Lock()
+	iw.seeks++
+	iw.mu.Unlock()
+	return iw.w.Seek(offset, whence)
+}
+
+// record accounts for a write call of n bytes which took d.
+func (iw *InstrumentedWriter) record(calls *int, n int, d time.Duration) {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	*calls++
+	iw.bytes += int64(n)
+	iw.writeDuration += d
+	if d > iw.maxLatency {
+		iw.maxLatency = d
+	}
+}
+
+// Writes returns the number of calls to Write.
+func (iw *InstrumentedWriter) Writes() int {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	return iw.writes
+}
+
+// WriteAts returns the number of calls to WriteAt.
+func (iw *InstrumentedWriter) WriteAts() int {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	return iw.writeAts
+}
+
+// Seeks returns the number of calls to Seek.
+func (iw *InstrumentedWriter) Seeks() int {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	return iw.seeks
+}
+
+// BytesWritten returns the number of bytes written by Write and WriteAt.
+func (iw *InstrumentedWriter) BytesWritten() int64 {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	return iw.bytes
+}
+
+// WriteDuration returns the time spent in Write and WriteAt.
+func (iw *InstrumentedWriter) WriteDuration() time.Duration {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	return iw.writeDuration
+}
+
+// MaxWriteLatency returns the duration of the slowest call to Write or
+// WriteAt.
+func (iw *InstrumentedWriter) MaxWriteLatency() time.Duration {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	return iw.maxLatency
+}
+
+// BytesPerSecond returns the throughput of the wrapped writer: the bytes
+// written divided by the time spent writing them, 0 if nothing was written.
+func (iw *InstrumentedWriter) BytesPerSecond() float64 {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	if iw.writeDuration <= 0 {
+		return 0
+	}
+	return float64(iw.bytes) / iw.writeDuration.Seconds()
+}
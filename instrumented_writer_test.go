@@ -0,0 +1,47 @@
+package wav
+
+import (
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestInstrumentedWriter(t *testing.T) {
+	cw := &countingWriter{}
+	iw := NewInstrumentedWriter(cw)
+	e := NewEncoder(iw, 8000, 16, 1, FormatPCM)
+	for i := 0; i < 3; i++ {
+		if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 8000}, Data: []int{1, 2, 3}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if iw.Writes() != cw.writes {
+		t.Fatalf("expected %d writes, got %d", cw.writes, iw.Writes())
+	}
+	// the RIFF and data chunk sizes are patched on Close
+	if iw.WriteAts() != 2 {
+		t.Fatalf("expected 2 positioned writes, got %d", iw.WriteAts())
+	}
+	// the writer is probed before writing the header and Close moves back
+	// to the end of the data
+	if iw.Seeks() != 2 {
+		t.Fatalf("expected 2 seeks, got %d", iw.Seeks())
+	}
+	if exp := int64(len(cw.buf) + 8); iw.BytesWritten() != exp {
+		t.Fatalf("expected %d bytes written, got %d", exp, iw.BytesWritten())
+	}
+	if iw.WriteDuration() <= 0 || iw.MaxWriteLatency() <= 0 || iw.MaxWriteLatency() > iw.WriteDuration() {
+		t.Fatalf("expected the writes to be timed, got %s in total and %s at most", iw.WriteDuration(), iw.MaxWriteLatency())
+	}
+	if iw.BytesPerSecond() <= 0 {
+		t.Fatalf("expected a throughput, got %f", iw.BytesPerSecond())
+	}
+
+	if NewInstrumentedWriter(&memWriter{}).BytesPerSecond() != 0 {
+		t.Fatal("expected no throughput before writing")
+	}
+}
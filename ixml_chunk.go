@@ -0,0 +1,54 @@
+package wav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/riff"
+)
+
+// SetIXML sets the XML document written in an iXML chunk on Close, following
+// the bext chunk as field recorders do. The document, carrying the scene, take
+// and notes of location recordings, is written as is, the package doesn't
+// parse it. It takes precedence over Metadata.IXML, a nil document falls back
+// to it.
+func (e *Encoder) SetIXML(xml []byte) {
+	e.iXML = xml
+}
+
+// iXMLChunk returns the document of the iXML chunk, nil if there is none.
+func (e *Encoder) iXMLChunk() []byte {
+	if len(e.iXML) > 0 {
+		return e.iXML
+	}
+	if e.Metadata != nil && len(e.Metadata.IXML) > 0 {
+		return e.Metadata.IXML
+	}
+	return nil
+}
+
+// DecodeIXMLChunk decodes an iXML chunk and stores its XML document in
+// d.Metadata.IXML.
+func DecodeIXMLChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID != CIDIXML {
+		return nil
+	}
+	buf := make([]byte, ch.Size)
+	if _, err := io.ReadFull(ch, buf); err != nil {
+		return fmt.Errorf("failed to read the iXML chunk - %w", err)
+	}
+	if d.Metadata == nil {
+		d.Metadata = &Metadata{}
+	}
+	// the parser includes the pad byte of odd sized chunks, and recorders
+	// often null terminate or null pad the document
+	d.Metadata.IXML = bytes.TrimRight(buf, "\x00")
+	return nil
+}
@@ -0,0 +1,82 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderIXML(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?><BWFXML><IXML_VERSION>2.10</IXML_VERSION><SCENE>12A</SCENE><TAKE>3</TAKE><NOTE>plane</NOTE></BWFXML>`
+	testCases := []struct {
+		desc     string
+		setIXML  []byte
+		metadata []byte
+		exp      string
+	}{
+		// odd length so the chunk needs a pad byte
+		{"odd", []byte(doc + " "), nil, doc + " "},
+		{"even", []byte(doc), nil, doc},
+		{"from metadata", nil, []byte(doc), doc},
+		{"precedence", []byte("<BWFXML/>"), []byte(doc), "<BWFXML/>"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 48000, 24, 2, FormatPCM)
+			e.Metadata = &Metadata{
+				Title: "scene 12A",
+				Bext:  &BextChunk{Description: "take 3", Originator: "recorder", TimeReference: 48000 * 3600},
+				IXML:  tc.metadata,
+			}
+			e.SetIXML(tc.setIXML)
+			if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: []int{1, 2, 3, 4}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if size := binary.LittleEndian.Uint32(w.buf[4:]); int(size) != len(w.buf)-8 {
+				t.Fatalf("expected the RIFF size %d, got %d", len(w.buf)-8, size)
+			}
+			chunks := fileChunks(w.buf)
+			found := false
+			for i, c := range chunks {
+				if c.ID != CIDIXML {
+					continue
+				}
+				found = true
+				if c.Size != int64(len(tc.exp)) {
+					t.Fatalf("expected a %d bytes iXML chunk, got %d", len(tc.exp), c.Size)
+				}
+				if i == 0 || chunks[i-1].ID != CIDBext {
+					t.Fatalf("expected the iXML chunk to follow the bext chunk, got %v", chunks)
+				}
+			}
+			if !found {
+				t.Fatalf("expected an iXML chunk, got %v", chunks)
+			}
+			if planned := e.PlannedChunks(); len(planned) != len(chunks) {
+				t.Fatalf("expected the planned chunks %v to match the written ones %v", planned, chunks)
+			}
+
+			d := NewDecoder(bytes.NewReader(w.buf))
+			d.ReadMetadata()
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d.Metadata == nil || string(d.Metadata.IXML) != tc.exp {
+				t.Fatalf("expected the iXML document %s, got %#v", tc.exp, d.Metadata)
+			}
+			if d.Metadata.Bext == nil || d.Metadata.Bext.Description != "take 3" || d.Metadata.Bext.TimeReference != 48000*3600 {
+				t.Fatalf("expected the bext chunk to be decoded, got %#v", d.Metadata.Bext)
+			}
+			if d.Metadata.Title != "scene 12A" {
+				t.Fatalf("expected the INFO chunk to be decoded, got %q", d.Metadata.Title)
+			}
+		})
+	}
+}
@@ -29,6 +29,11 @@ var (
 	markerITCH    = [4]byte{'I', 'T', 'C', 'H'}
 	markerIKEY    = [4]byte{'I', 'K', 'E', 'Y'}
 	markerIMED    = [4]byte{'I', 'M', 'E', 'D'}
+	markerICMS    = [4]byte{'I', 'C', 'M', 'S'}
+	markerILNG    = [4]byte{'I', 'L', 'N', 'G'}
+	markerIPRT    = [4]byte{'I', 'P', 'R', 'T'}
+	markerISRF    = [4]byte{'I', 'S', 'R', 'F'}
+	markerLabl    = [4]byte{'l', 'a', 'b', 'l'}
 )
 
 // DecodeListChunk decodes a LIST chunk
@@ -52,9 +57,11 @@ func DecodeListChunk(d *Decoder, ch *riff.Chunk) error {
 		if _, err = r.Read(scratch); err != nil {
 			return fmt.Errorf("failed to read the INFO subchunk - %w", err)
 		}
+		if bytes.Equal(scratch, CIDAdtl) {
+			return decodeAdtlChunk(d, r)
+		}
 		if !bytes.Equal(scratch, CIDInfo[:]) {
 			// "expected an INFO subchunk but got %s", string(scratch)
-			// TODO: support adtl subchunks
 			ch.Drain()
 			return nil
 		}
@@ -134,6 +141,14 @@ func DecodeListChunk(d *Decoder, ch *riff.Chunk) error {
 				d.Metadata.Keywords = nullTermStr(scratch)
 			case markerIMED:
 				d.Metadata.Medium = nullTermStr(scratch)
+			case markerICMS:
+				d.Metadata.Commissioned = nullTermStr(scratch)
+			case markerILNG:
+				d.Metadata.Language = nullTermStr(scratch)
+			case markerIPRT:
+				d.Metadata.Part = nullTermStr(scratch)
+			case markerISRF:
+				d.Metadata.SourceForm = nullTermStr(scratch)
 			}
 		}
 	}
@@ -141,65 +156,167 @@ func DecodeListChunk(d *Decoder, ch *riff.Chunk) error {
 	return nil
 }
 
-func encodeInfoChunk(e *Encoder) []byte {
-	if e == nil || e.Metadata == nil {
-		return nil
+// encodeInfoChunk returns the content of the INFO LIST chunk, or nil if there
+// is nothing to write. An error is returned if a field is too large for a 32
+// bit chunk size.
+func encodeInfoChunk(e *Encoder) ([]byte, error) {
+	if e == nil {
+		return nil, nil
+	}
+	md := e.Metadata
+	if md == nil {
+		if e.encoderName == "" {
+			return nil, nil
+		}
+		md = &Metadata{}
 	}
 	buf := bytes.NewBuffer(nil)
 
+	var err error
 	writeSection := func(id [4]byte, val string) {
+		if err != nil {
+			return
+		}
+		// the size is checked before anything is copied
+		if _, err = checkedSize(int64(len(val))+1, fmt.Sprintf("INFO %s field size", id)); err != nil {
+			return
+		}
 		buf.Write(id[:])
 		binary.Write(buf, binary.LittleEndian, uint32(len(val)+1))
 		buf.Write(append([]byte(val), 0x00))
 	}
-	if e.Metadata.Artist != "" {
-		writeSection(markerIART, e.Metadata.Artist)
+	if md.Artist != "" {
+		writeSection(markerIART, md.Artist)
+	}
+	if md.Comments != "" {
+		writeSection(markerICMT, md.Comments)
+	}
+	if md.Copyright != "" {
+		writeSection(markerICOP, md.Copyright)
 	}
-	if e.Metadata.Comments != "" {
-		writeSection(markerICMT, e.Metadata.Comments)
+	if md.CreationDate != "" {
+		writeSection(markerICRD, md.CreationDate)
 	}
-	if e.Metadata.Copyright != "" {
-		writeSection(markerICOP, e.Metadata.Copyright)
+	if md.Engineer != "" {
+		writeSection(markerIENG, md.Engineer)
 	}
-	if e.Metadata.CreationDate != "" {
-		writeSection(markerICRD, e.Metadata.CreationDate)
+	if md.Technician != "" {
+		writeSection(markerITCH, md.Technician)
 	}
-	if e.Metadata.Engineer != "" {
-		writeSection(markerIENG, e.Metadata.Engineer)
+	if md.Genre != "" {
+		writeSection(markerIGNR, md.Genre)
 	}
-	if e.Metadata.Technician != "" {
-		writeSection(markerITCH, e.Metadata.Technician)
+	if md.Keywords != "" {
+		writeSection(markerIKEY, md.Keywords)
 	}
-	if e.Metadata.Genre != "" {
-		writeSection(markerIGNR, e.Metadata.Genre)
+	if md.Medium != "" {
+		writeSection(markerIMED, md.Medium)
 	}
-	if e.Metadata.Keywords != "" {
-		writeSection(markerIKEY, e.Metadata.Keywords)
+	if md.Title != "" {
+		writeSection(markerINAM, md.Title)
 	}
-	if e.Metadata.Medium != "" {
-		writeSection(markerIMED, e.Metadata.Medium)
+	if md.Product != "" {
+		writeSection(markerIPRD, md.Product)
 	}
-	if e.Metadata.Title != "" {
-		writeSection(markerINAM, e.Metadata.Title)
+	if md.Subject != "" {
+		writeSection(markerISBJ, md.Subject)
 	}
-	if e.Metadata.Product != "" {
-		writeSection(markerIPRD, e.Metadata.Product)
+	if md.Software != "" {
+		writeSection(markerISFT, md.Software)
+	} else if e.encoderName != "" {
+		writeSection(markerISFT, e.encoderName)
+	} else if e.softwareTag != "" {
+		writeSection(markerISFT, e.softwareTag)
 	}
-	if e.Metadata.Subject != "" {
-		writeSection(markerISBJ, e.Metadata.Subject)
+	if md.Source != "" {
+		writeSection(markerISRC, md.Source)
 	}
-	if e.Metadata.Software != "" {
-		writeSection(markerISFT, e.Metadata.Software)
+	if md.Location != "" {
+		writeSection(markerIARL, md.Location)
 	}
-	if e.Metadata.Source != "" {
-		writeSection(markerISRC, e.Metadata.Source)
+	if md.TrackNbr != "" {
+		writeSection(markerITRK, md.TrackNbr)
 	}
-	if e.Metadata.Location != "" {
-		writeSection(markerIARL, e.Metadata.Location)
+	if md.Commissioned != "" {
+		writeSection(markerICMS, md.Commissioned)
 	}
-	if e.Metadata.TrackNbr != "" {
-		writeSection(markerITRK, e.Metadata.TrackNbr)
+	if md.Language != "" {
+		writeSection(markerILNG, md.Language)
+	}
+	if md.Part != "" {
+		writeSection(markerIPRT, md.Part)
+	}
+	if md.SourceForm != "" {
+		writeSection(markerISRF, md.SourceForm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return append(CIDInfo, buf.Bytes()...), nil
+}
+
+// decodeAdtlChunk decodes the labl chunks of an adtl list and sets the labels
+// of the matching cue points. The labels are kept for the cue points decoded
+// later if the cue chunk follows the list.
+func decodeAdtlChunk(d *Decoder, r *bytes.Reader) error {
+	for {
+		var header struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+			// the end of the list or a trailing pad byte
+			return nil
+		}
+		size := int64(header.Size)
+		if size%2 == 1 {
+			size++
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("failed to read the %s subchunk - %w", header.ID, err)
+		}
+		if header.ID != markerLabl || len(data) < 4 {
+			continue
+		}
+		var cueID [4]byte
+		copy(cueID[:], data)
+		label := nullTermStr(data[4:])
+		if d.cueLabels == nil {
+			d.cueLabels = map[[4]byte]string{}
+		}
+		d.cueLabels[cueID] = label
+		if d.Metadata != nil {
+			for _, c := range d.Metadata.CuePoints {
+				if c.ID == cueID {
+					c.Label = label
+				}
+			}
+		}
 	}
+}
 
-	return append(CIDInfo, buf.Bytes()...)
+// encodeAdtlChunk returns the content of an adtl LIST chunk holding a labl
+// chunk per labeled cue point, or nil if no cue point is labeled.
+func encodeAdtlChunk(points []*CuePoint) []byte {
+	buf := bytes.NewBuffer(nil)
+	for _, c := range points {
+		if c.Label == "" {
+			continue
+		}
+		buf.Write(markerLabl[:])
+		binary.Write(buf, binary.LittleEndian, uint32(4+len(c.Label)+1))
+		buf.Write(c.ID[:])
+		buf.WriteString(c.Label)
+		buf.WriteByte(0)
+		// sub chunks are word aligned too
+		if len(c.Label)%2 == 0 {
+			buf.WriteByte(0)
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return append(append([]byte{}, CIDAdtl...), buf.Bytes()...)
 }
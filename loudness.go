@@ -0,0 +1,454 @@
+package wav
+
+import (
+	"math"
+	"sort"
+)
+
+// biquad is a second order IIR filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// kWeighting returns the two stages of the K-weighting filter of ITU-R
+// BS.1770 at the passed sample rate: a high shelf modeling the head followed
+// by the RLB high pass. The coefficients are derived from the analog
+// prototypes so any sample rate is supported, they match the tables of the
+// recommendation at 48 kHz.
+func kWeighting(sampleRate int) [2]biquad {
+	fs := float64(sampleRate)
+
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// loudnessMeter measures the integrated loudness of ITU-R BS.1770: the
+// K-weighted mean square of each channel is computed over 400ms blocks
+// overlapping by 75%, the blocks are gated and averaged. The 3s short-term
+// windows of EBU Tech 3341 are computed every 100ms for the loudness range,
+// and the true peak is measured alongside. Its state carries across buffers.
+type loudnessMeter struct {
+	filters [2]biquad
+	// stepFrames is the number of frames of a 100ms step, a block being made
+	// of 4 steps.
+	stepFrames int
+	// mask is the speaker layout used to weight the channels, if any.
+	mask      SpeakerLayout
+	writeBext bool
+
+	numChans int
+	weights  []float64
+	// state holds the 2 delays of the 2 filter stages of each channel.
+	state [][2][2]float64
+	// sums holds the sum of the squared samples of each channel over the
+	// current step of n frames.
+	sums []float64
+	n    int
+	// steps holds the weighted power of the last 4 steps.
+	steps      [4]float64
+	stepsCount int
+	// blocks holds the weighted mean square of each block.
+	blocks []float64
+	// shortSteps holds the weighted power of the last steps of a short-term
+	// window.
+	shortSteps [shortTermSteps]float64
+	// shortTerm holds the weighted mean square of each short-term window.
+	shortTerm []float64
+	peak      *truePeakMeter
+}
+
+// shortTermSteps is the number of 100ms steps of a 3s short-term window.
+const shortTermSteps = 30
+
+func newLoudnessMeter(sampleRate int, mask SpeakerLayout) *loudnessMeter {
+	stepFrames := int(math.Round(float64(sampleRate) / 10))
+	if stepFrames < 1 {
+		stepFrames = 1
+	}
+	return &loudnessMeter{
+		filters:    kWeighting(sampleRate),
+		stepFrames: stepFrames,
+		mask:       mask,
+		peak:       newTruePeakMeter(sampleRate),
+	}
+}
+
+// channelWeights returns the weight of each channel in the loudness sum: the
+// surround channels weigh 1.41 and the LFE channel is left out. Without a
+// speaker layout, 6 channels are assumed to be 5.1 and other counts to only
+// have front channels.
+func channelWeights(numChans int, mask SpeakerLayout) []float64 {
+	weights := make([]float64, numChans)
+	for c := range weights {
+		weights[c] = 1
+	}
+	if mask == 0 {
+		if numChans == 6 {
+			mask = LayoutFivePointOne
+		} else {
+			return weights
+		}
+	}
+	c := 0
+	for bit := SpeakerLayout(1); bit != 0 && c < numChans; bit <<= 1 {
+		if mask&bit == 0 {
+			continue
+		}
+		switch bit {
+		case SpeakerLowFrequency:
+			weights[c] = 0
+		case SpeakerBackLeft, SpeakerBackRight, SpeakerSideLeft, SpeakerSideRight:
+			weights[c] = 1.41
+		}
+		c++
+	}
+	return weights
+}
+
+func (m *loudnessMeter) setChans(numChans int) {
+	if m.numChans == numChans {
+		return
+	}
+	m.numChans = numChans
+	m.weights = channelWeights(numChans, m.mask)
+	m.state = make([][2][2]float64, numChans)
+	m.sums = make([]float64, numChans)
+	m.n = 0
+	m.peak.setChans(numChans)
+}
+
+// add filters a sample of channel c, in the [-1, 1] range.
+func (m *loudnessMeter) add(c int, x float64) {
+	m.peak.add(c, x)
+	st := &m.state[c]
+	for i, f := range m.filters {
+		y := f.b0*x + st[i][0]
+		st[i][0] = f.b1*x - f.a1*y + st[i][1]
+		st[i][1] = f.b2*x - f.a2*y
+		x = y
+	}
+	m.sums[c] += x * x
+}
+
+func (m *loudnessMeter) endFrame() {
+	m.n++
+	if m.n < m.stepFrames {
+		return
+	}
+	var power float64
+	for c, sum := range m.sums {
+		power += m.weights[c] * sum
+		m.sums[c] = 0
+	}
+	m.n = 0
+	m.steps[m.stepsCount%4] = power
+	m.shortSteps[m.stepsCount%shortTermSteps] = power
+	m.stepsCount++
+	if m.stepsCount >= 4 {
+		block := (m.steps[0] + m.steps[1] + m.steps[2] + m.steps[3]) / float64(4*m.stepFrames)
+		m.blocks = append(m.blocks, block)
+	}
+	if m.stepsCount >= shortTermSteps {
+		var sum float64
+		for _, p := range m.shortSteps {
+			sum += p
+		}
+		m.shortTerm = append(m.shortTerm, sum/float64(shortTermSteps*m.stepFrames))
+	}
+}
+
+// analyze processes interleaved int samples, center being the value of
+// silence and fullScale the magnitude of a full scale sample.
+func (m *loudnessMeter) analyze(data []int, numChans, center int, fullScale float64) {
+	m.setChans(numChans)
+	for i := 0; i+numChans <= len(data); i += numChans {
+		for c, v := range data[i : i+numChans] {
+			m.add(c, float64(v-center)/fullScale)
+		}
+		m.endFrame()
+	}
+}
+
+// analyzeFloat processes interleaved float samples.
+func (m *loudnessMeter) analyzeFloat(data []float64, numChans int) {
+	m.setChans(numChans)
+	for i := 0; i+numChans <= len(data); i += numChans {
+		for c, v := range data[i : i+numChans] {
+			m.add(c, finite(v))
+		}
+		m.endFrame()
+	}
+}
+
+// analyzePlanar processes non interleaved float samples.
+func (m *loudnessMeter) analyzePlanar(channels [][]float64) {
+	m.setChans(len(channels))
+	for i := range channels[0] {
+		for c, ch := range channels {
+			m.add(c, finite(ch[i]))
+		}
+		m.endFrame()
+	}
+}
+
+// blockLoudness converts a weighted mean square to LUFS.
+func blockLoudness(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+// integrated returns the gated loudness of the blocks: the blocks below the
+// absolute gate of -70 LUFS are discarded, then the ones 10 LU below the
+// loudness of the remaining blocks.
+func (m *loudnessMeter) integrated() float64 {
+	gatedMean := func(threshold float64) (float64, int) {
+		var sum float64
+		var n int
+		for _, p := range m.blocks {
+			if p > threshold {
+				sum += p
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, 0
+		}
+		return sum / float64(n), n
+	}
+	// the power of a -70 LUFS block
+	absolute := math.Pow(10, (-70+0.691)/10)
+	mean, n := gatedMean(absolute)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+	relative := mean * math.Pow(10, -10.0/10)
+	if relative < absolute {
+		relative = absolute
+	}
+	mean, n = gatedMean(relative)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+	return blockLoudness(mean)
+}
+
+// loudnessRange returns the loudness range of EBU Tech 3342 in LU: the
+// spread between the 10th and the 95th percentiles of the short-term
+// loudness, once the windows below the absolute gate of -70 LUFS and the
+// ones 20 LU below the loudness of the remaining windows are discarded.
+func (m *loudnessMeter) loudnessRange() float64 {
+	absolute := math.Pow(10, (-70+0.691)/10)
+	var sum float64
+	var gated []float64
+	for _, p := range m.shortTerm {
+		if p > absolute {
+			sum += p
+			gated = append(gated, p)
+		}
+	}
+	if len(gated) == 0 {
+		return 0
+	}
+	relative := sum / float64(len(gated)) * math.Pow(10, -20.0/10)
+	var levels []float64
+	for _, p := range gated {
+		if p > relative {
+			levels = append(levels, blockLoudness(p))
+		}
+	}
+	if len(levels) == 0 {
+		return 0
+	}
+	sort.Float64s(levels)
+	percentile := func(p float64) float64 {
+		return levels[int(math.Round(p*float64(len(levels)-1)))]
+	}
+	return percentile(0.95) - percentile(0.1)
+}
+
+// maxLoudness returns the loudness of the loudest of the passed mean
+// squares, -Inf if there is none.
+func maxLoudness(powers []float64) float64 {
+	max := math.Inf(-1)
+	for _, p := range powers {
+		if l := blockLoudness(p); l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+// stats returns the measurements of the meter.
+func (m *loudnessMeter) stats() LoudnessStats {
+	return LoudnessStats{
+		Integrated:   m.integrated(),
+		Range:        m.loudnessRange(),
+		MaxTruePeak:  20 * math.Log10(m.peak.max),
+		MaxMomentary: maxLoudness(m.blocks),
+		MaxShortTerm: maxLoudness(m.shortTerm),
+	}
+}
+
+// measureLoudness processes interleaved int samples of the encoder bit depth.
+func (e *Encoder) measureLoudness(data []int, numChans int) {
+	center := 0
+	if e.BitDepth == 8 {
+		center = 128
+	}
+	fullScale := float64(int64(1) << (uint(e.BitDepth-1) - e.sampleShift()))
+	e.loudness.analyze(data, numChans, center, fullScale)
+}
+
+// EnableLoudnessMeter makes the encoder measure the integrated loudness of
+// the appended audio as defined by ITU-R BS.1770, see IntegratedLUFS, along
+// with the other measurements of LoudnessStats. The channels are weighted
+// according to the layout set by SetChannelLayout, so it should be called
+// first. If writeBext is set, the measurements are written in the loudness
+// fields of the bext chunk on Close, upgrading it to version 2 if needed, a
+// bext chunk holding only them being written if Metadata.Bext isn't set. The metering costs a few dozen multiplications per
+// sample, most of them by the oversampling of the true peak measurement. The
+// audio written by WriteAt, WriteFrame and WriteRaw isn't measured.
+func (e *Encoder) EnableLoudnessMeter(writeBext bool) {
+	e.loudness = newLoudnessMeter(e.SampleRate, e.channelMask)
+	e.loudness.writeBext = writeBext
+}
+
+// IntegratedLUFS returns the integrated loudness in LUFS of the audio written
+// so far, measured when EnableLoudnessMeter is set. It returns -Inf if the
+// meter isn't enabled, if less than 400ms were written or if the audio is
+// below the -70 LUFS gate.
+func (e *Encoder) IntegratedLUFS() float64 {
+	e.lock()
+	defer e.unlock()
+	if e.loudness == nil {
+		return math.Inf(-1)
+	}
+	return e.loudness.integrated()
+}
+
+// LoudnessStats holds the loudness measurements of EBU R 128, written in the
+// version 2 bext chunk, see EnableLoudnessMeter.
+type LoudnessStats struct {
+	// Integrated is the integrated loudness in LUFS.
+	Integrated float64
+	// Range is the loudness range (LRA) in LU.
+	Range float64
+	// MaxTruePeak is the highest true peak level in dBTP, measured on the
+	// signal oversampled to at least 192 kHz.
+	MaxTruePeak float64
+	// MaxMomentary is the highest loudness of the 400ms blocks in LUFS.
+	MaxMomentary float64
+	// MaxShortTerm is the highest loudness of the 3s windows in LUFS.
+	MaxShortTerm float64
+}
+
+// LoudnessStats returns the loudness measurements of the audio written so
+// far when EnableLoudnessMeter is set. The levels are -Inf if the meter isn't
+// enabled or if the audio is too short or too quiet to be measured, the
+// range being 0.
+func (e *Encoder) LoudnessStats() LoudnessStats {
+	e.lock()
+	defer e.unlock()
+	if e.loudness == nil {
+		inf := math.Inf(-1)
+		return LoudnessStats{Integrated: inf, MaxTruePeak: inf, MaxMomentary: inf, MaxShortTerm: inf}
+	}
+	return e.loudness.stats()
+}
+
+// truePeakTaps is the number of samples interpolated by the true peak meter.
+const truePeakTaps = 12
+
+// truePeakMeter measures the true peak of ITU-R BS.1770 Annex 2: the peak of
+// the signal oversampled 4 times below 96 kHz and twice below 192 kHz,
+// catching the peaks between the samples which clip once converted to
+// analog.
+type truePeakMeter struct {
+	// phases holds the interpolation filter of each position between two
+	// samples, the samples themselves being measured as is.
+	phases [][truePeakTaps]float64
+	// history holds the last samples of each channel twice so the window
+	// is contiguous, pos being the index of the oldest one.
+	history [][2 * truePeakTaps]float64
+	pos     []int
+	max     float64
+}
+
+func newTruePeakMeter(sampleRate int) *truePeakMeter {
+	factor := 1
+	switch {
+	case sampleRate < 96000:
+		factor = 4
+	case sampleRate < 192000:
+		factor = 2
+	}
+	t := &truePeakMeter{}
+	// Hann windowed sinc filters interpolating between the 2 middle samples
+	center := truePeakTaps/2 - 1
+	for p := 1; p < factor; p++ {
+		var phase [truePeakTaps]float64
+		var sum float64
+		for k := range phase {
+			d := float64(center-k) + float64(p)/float64(factor)
+			phase[k] = math.Sin(math.Pi*d) / (math.Pi * d) * 0.5 * (1 + math.Cos(math.Pi*d/(truePeakTaps/2)))
+			sum += phase[k]
+		}
+		// unity gain
+		for k := range phase {
+			phase[k] /= sum
+		}
+		t.phases = append(t.phases, phase)
+	}
+	return t
+}
+
+func (t *truePeakMeter) setChans(numChans int) {
+	t.history = make([][2 * truePeakTaps]float64, numChans)
+	t.pos = make([]int, numChans)
+}
+
+// add measures a sample of channel c, in the [-1, 1] range.
+func (t *truePeakMeter) add(c int, x float64) {
+	if a := math.Abs(x); a > t.max {
+		t.max = a
+	}
+	if len(t.phases) == 0 {
+		return
+	}
+	h := &t.history[c]
+	i := t.pos[c]
+	h[i], h[i+truePeakTaps] = x, x
+	i = (i + 1) % truePeakTaps
+	t.pos[c] = i
+	window := h[i : i+truePeakTaps]
+	for _, phase := range t.phases {
+		var y float64
+		for k, coef := range phase {
+			y += coef * window[k]
+		}
+		if a := math.Abs(y); a > t.max {
+			t.max = a
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package wav
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
+)
+
+// sine returns interleaved frames of a 1 kHz sine of the passed peak level in
+// dBFS, on every channel.
+func sine(sampleRate, numChans int, seconds, levelDB float64) []float64 {
+	amplitude := math.Pow(10, levelDB/20)
+	frames := int(seconds * float64(sampleRate))
+	data := make([]float64, 0, frames*numChans)
+	for i := 0; i < frames; i++ {
+		v := amplitude * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate))
+		for c := 0; c < numChans; c++ {
+			data = append(data, v)
+		}
+	}
+	return data
+}
+
+func TestEncoderLoudnessMeter(t *testing.T) {
+	// the reference tone of EBU Tech 3341: a stereo 1 kHz sine at -23 dBFS
+	// measures -23 LUFS
+	testCases := []struct {
+		desc        string
+		sampleRate  int
+		bitDepth    int
+		audioFormat int
+		data        []float64
+		exp         float64
+		tolerance   float64
+	}{
+		{"48kHz float", 48000, 32, FormatIEEEFloat, sine(48000, 2, 5, -23), -23, 0.1},
+		{"44.1kHz 24 bit", 44100, 24, FormatPCM, sine(44100, 2, 5, -23), -23, 0.1},
+		{"16 bit louder", 48000, 16, FormatPCM, sine(48000, 2, 5, -18), -18, 0.1},
+		// the silent tail is discarded by the absolute gate, the 3 blocks
+		// overlapping the end of the tone pass the gates and lower the
+		// loudness by about 0.14 LU
+		{"gated silence", 48000, 32, FormatIEEEFloat, append(sine(48000, 2, 5, -23), make([]float64, 48000*2*10)...), -23.14, 0.05},
+		// the quiet tail is discarded by the relative gate
+		{"gated quiet tail", 48000, 32, FormatIEEEFloat, append(sine(48000, 2, 5, -23), sine(48000, 2, 5, -50)...), -23.14, 0.05},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			e := NewEncoder(&memWriter{}, tc.sampleRate, tc.bitDepth, 2, tc.audioFormat)
+			e.EnableLoudnessMeter(false)
+			format := &audio.Format{NumChannels: 2, SampleRate: tc.sampleRate}
+			// split the writes to carry the state across buffers
+			for start := 0; start < len(tc.data); start += 2 * 1000 {
+				end := start + 2*1000
+				if end > len(tc.data) {
+					end = len(tc.data)
+				}
+				if err := e.WriteFloat(&audio.FloatBuffer{Format: format, Data: tc.data[start:end]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if lufs := e.IntegratedLUFS(); math.Abs(lufs-tc.exp) > tc.tolerance {
+				t.Fatalf("expected %.2f LUFS, got %.2f", tc.exp, lufs)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 48000, 16, 2, FormatPCM)
+	if lufs := e.IntegratedLUFS(); !math.IsInf(lufs, -1) {
+		t.Fatalf("expected -Inf without the meter, got %f", lufs)
+	}
+}
+
+func TestEncoderLoudnessMeterSurround(t *testing.T) {
+	// the 5.1 LFE channel is left out and the surround channels weigh 1.41
+	const sampleRate = 48000
+	tone := sine(sampleRate, 1, 5, -23)
+	data := make([]float64, len(tone)*6)
+	for i, v := range tone {
+		data[i*6+3] = v
+		data[i*6+4] = v
+	}
+	e := NewEncoder(&memWriter{}, sampleRate, 32, 6, FormatIEEEFloat)
+	if err := e.SetChannelLayout(LayoutFivePointOne); err != nil {
+		t.Fatal(err)
+	}
+	e.EnableLoudnessMeter(false)
+	if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: 6, SampleRate: sampleRate}, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	// a single channel is 3 dB below the stereo tone, weighted by 1.41
+	exp := -23 - 10*math.Log10(2) + 10*math.Log10(1.41)
+	if lufs := e.IntegratedLUFS(); math.Abs(lufs-exp) > 0.1 {
+		t.Fatalf("expected %.2f LUFS, got %.2f", exp, lufs)
+	}
+}
+
+func TestEncoderLoudnessMeterBext(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 48000, 16, 2, FormatPCM)
+	e.Metadata = &Metadata{Bext: &BextChunk{Description: "take", Version: 1}}
+	e.EnableLoudnessMeter(true)
+	if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: sine(48000, 2, 4, -23)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if e.Metadata.Bext.LoudnessValue != 0 || e.Metadata.Bext.Version != 1 {
+		t.Fatal("expected the user metadata to be left untouched")
+	}
+
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	bext := d.Metadata.Bext
+	if bext == nil || bext.Version != 2 {
+		t.Fatalf("expected a version 2 bext chunk, got %#v", bext)
+	}
+	if bext.LoudnessValue < -2310 || bext.LoudnessValue > -2290 {
+		t.Fatalf("expected a loudness value of about -2300, got %d", bext.LoudnessValue)
+	}
+	// the levels of a steady tone are its loudness, and its range is null
+	for _, v := range []struct {
+		field    string
+		got, exp int16
+	}{
+		{"loudness range", bext.LoudnessRange, 0},
+		{"max true peak", bext.MaxTruePeakLevel, -2300},
+		{"max momentary loudness", bext.MaxMomentaryLoudness, -2300},
+		{"max short-term loudness", bext.MaxShortTermLoudness, -2300},
+	} {
+		if v.got < v.exp-10 || v.got > v.exp+10 {
+			t.Errorf("expected a %s of about %d, got %d", v.field, v.exp, v.got)
+		}
+	}
+}
+
+func TestEncoderLoudnessMeterBextWithoutMetadata(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 48000, 16, 2, FormatPCM)
+	e.EnableLoudnessMeter(true)
+	if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 48000}, Data: sine(48000, 2, 4, -23)}); err != nil {
+		t.Fatal(err)
+	}
+	planned := e.EstimateSize(4 * time.Second)
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if e.Metadata != nil {
+		t.Fatal("expected the metadata to be left unset")
+	}
+	if planned != int64(len(w.buf)) {
+		t.Fatalf("expected the planned chunks to describe %d bytes, got %d", len(w.buf), planned)
+	}
+
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata == nil || d.Metadata.Bext == nil {
+		t.Fatal("expected a bext chunk holding the loudness")
+	}
+	bext := d.Metadata.Bext
+	if bext.Version != 2 || bext.LoudnessValue < -2310 || bext.LoudnessValue > -2290 {
+		t.Fatalf("expected a version 2 bext chunk with a loudness value of about -2300, got %#v", bext)
+	}
+}
+
+func TestEncoderLoudnessStats(t *testing.T) {
+	const sampleRate = 48000
+	testCases := []struct {
+		desc string
+		data []float64
+		exp  LoudnessStats
+		// tolerance of the levels in dB, and of the range in LU
+		tolerance, rangeTolerance float64
+	}{
+		{"steady tone", sine(sampleRate, 2, 10, -23), LoudnessStats{Integrated: -23, Range: 0, MaxTruePeak: -23, MaxMomentary: -23, MaxShortTerm: -23}, 0.1, 0.1},
+		// EBU Tech 3342, cases 1 and 2
+		// the integrated loudness is the mean power of both halves
+		{"range of 10 LU", append(sine(sampleRate, 2, 20, -20), sine(sampleRate, 2, 20, -30)...), LoudnessStats{Integrated: -22.6, Range: 10, MaxTruePeak: -20, MaxMomentary: -20, MaxShortTerm: -20}, 0.1, 1},
+		{"range of 5 LU", append(sine(sampleRate, 2, 20, -20), sine(sampleRate, 2, 20, -15)...), LoudnessStats{Integrated: -16.81, Range: 5, MaxTruePeak: -15, MaxMomentary: -15, MaxShortTerm: -15}, 0.1, 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			e := NewEncoder(discardWriter{}, sampleRate, 32, 2, FormatIEEEFloat)
+			e.EnableLoudnessMeter(false)
+			if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: sampleRate}, Data: tc.data}); err != nil {
+				t.Fatal(err)
+			}
+			got := e.LoudnessStats()
+			for _, v := range []struct {
+				name           string
+				got, exp, diff float64
+			}{
+				{"integrated loudness", got.Integrated, tc.exp.Integrated, tc.tolerance},
+				{"loudness range", got.Range, tc.exp.Range, tc.rangeTolerance},
+				{"max true peak", got.MaxTruePeak, tc.exp.MaxTruePeak, tc.tolerance},
+				{"max momentary loudness", got.MaxMomentary, tc.exp.MaxMomentary, tc.tolerance},
+				{"max short-term loudness", got.MaxShortTerm, tc.exp.MaxShortTerm, tc.tolerance},
+			} {
+				if math.Abs(v.got-v.exp) > v.diff {
+					t.Errorf("expected the %s to be %.2f, got %.2f", v.name, v.exp, v.got)
+				}
+			}
+		})
+	}
+
+	// the samples of a quarter sample rate sine at 45 degrees peak 3 dB below
+	// its true peak, EBU Tech 3341 case 15
+	for _, rate := range []float64{sampleRate, 96000} {
+		e := NewEncoder(discardWriter{}, int(rate), 32, 2, FormatIEEEFloat)
+		e.EnableLoudnessMeter(false)
+		amplitude := math.Pow(10, -6.0/20)
+		data := make([]float64, 2*int(rate))
+		for i := 0; i < len(data)/2; i++ {
+			v := amplitude * math.Sin(math.Pi/2*float64(i)+math.Pi/4)
+			data[2*i], data[2*i+1] = v, v
+		}
+		if err := e.WriteFloat(&audio.FloatBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: int(rate)}, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+		// the spec tolerates an error of +0.2 and -0.4 dB
+		if peak := e.LoudnessStats().MaxTruePeak; peak < -6.4 || peak > -5.8 {
+			t.Errorf("%.0fHz: expected a true peak of -6 dBTP, the samples peaking at -9 dBFS, got %.2f", rate, peak)
+		}
+	}
+
+	stats := NewEncoder(&memWriter{}, sampleRate, 16, 2, FormatPCM).LoudnessStats()
+	if !math.IsInf(stats.Integrated, -1) || !math.IsInf(stats.MaxTruePeak, -1) || stats.Range != 0 {
+		t.Fatalf("expected no measurement without the meter, got %+v", stats)
+	}
+}
@@ -1,5 +1,12 @@
 package wav
 
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
 // Metadata represents optional metadata added to the wav file.
 type Metadata struct {
 	SamplerInfo *SamplerInfo
@@ -48,6 +55,30 @@ type Metadata struct {
 	Location string
 	// TrackNbr is the track number
 	TrackNbr string
+	// Commissioned lists the name of the person or organization that
+	// commissioned the subject of the file. For example: Pope Julian II.
+	Commissioned string
+	// Language specifies the language of the spoken content of the file, such
+	// as English or fr-FR.
+	Language string
+	// Part identifies the part of a multi-part work the file belongs to. For
+	// example: 2/3.
+	Part string
+	// SourceForm identifies the original form of the material that was
+	// digitized, the Source Form of the INFO ISRF field. For example: record,
+	// sampling CD or TV sound track.
+	SourceForm string
+	// Bext is the broadcast audio extension of Broadcast Wave Format files.
+	Bext *BextChunk
+	// IXML is the XML document of the iXML chunk written by field recorders,
+	// holding the scene, take and notes of a recording, left uninterpreted.
+	IXML []byte
+	// ResU is the JSON document of the ResU chunk written by iZotope RX and
+	// other mastering tools, left uninterpreted.
+	ResU []byte
+	// Gapless holds the encoder delay and padding of the gapl chunk, see
+	// Encoder.SetGaplessInfo.
+	Gapless *GaplessInfo
 	// CuePoints is a list of cue points in the wav file.
 	CuePoints []*CuePoint
 }
@@ -108,6 +139,28 @@ type SamplerInfo struct {
 	Loops []*SampleLoop
 }
 
+// SetPitchFraction sets MIDIPitchFraction from a fine tuning expressed in
+// cents above MIDIUnityNote, converting it to the fraction of a semitone
+// scaled to 32 bits: 50 cents is 0x80000000. The cents must be in [0, 100),
+// a sample tuned down being described by the note below.
+func (s *SamplerInfo) SetPitchFraction(cents float64) error {
+	if math.IsNaN(cents) || cents < 0 || cents >= 100 {
+		return fmt.Errorf("invalid pitch fraction of %v cents, it must be in [0, 100)", cents)
+	}
+	v := math.Round(cents / 100 * (1 << 32))
+	// the cents right below 100 round up to a full semitone
+	if v > math.MaxUint32 {
+		v = math.MaxUint32
+	}
+	s.MIDIPitchFraction = uint32(v)
+	return nil
+}
+
+// PitchFraction returns MIDIPitchFraction in cents above MIDIUnityNote.
+func (s *SamplerInfo) PitchFraction() float64 {
+	return float64(s.MIDIPitchFraction) / (1 << 32) * 100
+}
+
 // SampleLoop indicates a loop and its properties within the audio file
 type SampleLoop struct {
 	// CuePointID - The Cue Point ID specifies the unique ID that corresponds to one of the
@@ -142,3 +195,51 @@ type SampleLoop struct {
 	// loop.
 	PlayCount uint32
 }
+
+// NewSampleLoop returns a forward loop tied to the passed cue point ID playing
+// the frames from start (inclusive) to end (exclusive), expressed as times in
+// the data chunk.
+func NewSampleLoop(cuePointID uint32, start, end time.Duration, sampleRate int) *SampleLoop {
+	l := &SampleLoop{Start: uint32(FramesForDuration(start, sampleRate))}
+	if endFrame := uint32(FramesForDuration(end, sampleRate)); endFrame > l.Start {
+		l.End = endFrame - 1
+	} else {
+		l.End = l.Start
+	}
+	binary.LittleEndian.PutUint32(l.CuePointID[:], cuePointID)
+	return l
+}
+
+// clone returns a deep copy of the metadata.
+func (m *Metadata) clone() *Metadata {
+	if m == nil {
+		return nil
+	}
+	c := *m
+	if m.SamplerInfo != nil {
+		si := *m.SamplerInfo
+		si.Loops = nil
+		for _, l := range m.SamplerInfo.Loops {
+			loop := *l
+			si.Loops = append(si.Loops, &loop)
+		}
+		c.SamplerInfo = &si
+	}
+	if m.Bext != nil {
+		bext := *m.Bext
+		bext.CodingHistory = append([]string(nil), m.Bext.CodingHistory...)
+		c.Bext = &bext
+	}
+	if m.Gapless != nil {
+		gapless := *m.Gapless
+		c.Gapless = &gapless
+	}
+	c.IXML = append([]byte(nil), m.IXML...)
+	c.ResU = append([]byte(nil), m.ResU...)
+	c.CuePoints = nil
+	for _, p := range m.CuePoints {
+		point := *p
+		c.CuePoints = append(c.CuePoints, &point)
+	}
+	return &c
+}
@@ -0,0 +1,209 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MultiEncoder writes the same wav file to several sinks, for instance to
+// record to disk while streaming the audio elsewhere. The audio is serialized
+// once by the embedded Encoder and fanned out to the sinks.
+//
+// Sinks which can seek, the WriterAtSeeker ones whose Seek works, get a
+// regular file. The other ones are degraded to streaming mode like with a
+// StreamEncoder: they get the header with StreamingDataSize sizes followed by
+// the audio, the size patches, the trimming and the metadata chunks written
+// on Close being left out. When a sink is streaming, overwriting the audio
+// already sent with WriteAt, or writing after a Truncate, fails with
+// ErrWriterNotSeekable.
+//
+// A sink failing is reported with a *SinkError. The sinks preceding it got
+// the bytes while the following ones didn't, so the files diverge and the
+// encoder is unusable afterwards.
+type MultiEncoder struct {
+	*Encoder
+	w *teeWriter
+}
+
+// NewMultiEncoder creates an encoder writing a wav file to each of the passed
+// sinks.
+func NewMultiEncoder(sinks []io.Writer, sampleRate, bitDepth, numChans, audioFormat int) *MultiEncoder {
+	tw := &teeWriter{}
+	for _, w := range sinks {
+		tw.sinks = append(tw.sinks, &teeSink{w: w})
+	}
+	e := NewEncoder(tw, sampleRate, bitDepth, numChans, audioFormat)
+	tw.audioStart = func() int64 { return e.pcmChunkPos }
+	return &MultiEncoder{Encoder: e, w: tw}
+}
+
+// Close finalizes the file of each sink, see Encoder.Close. The streaming
+// sinks end with the audio.
+func (m *MultiEncoder) Close() error {
+	if !m.wroteHeader {
+		// nothing was written, still produce valid empty files
+		if err := m.writeSetup(); err != nil {
+			return err
+		}
+	}
+	if err := m.flush(); err != nil {
+		return err
+	}
+	m.w.endStreams()
+	return m.Encoder.Close()
+}
+
+// CloseWriter finalizes the files like Close and then closes the sinks
+// implementing io.Closer.
+func (m *MultiEncoder) CloseWriter() error {
+	if err := m.Close(); err != nil {
+		return err
+	}
+	var firstErr error
+	for _, s := range m.w.sinks {
+		if c, ok := s.w.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// teeSink is a sink of a teeWriter, seeker being set if it can seek.
+type teeSink struct {
+	w      io.Writer
+	seeker WriterAtSeeker
+	// pos is the position of a streaming sink.
+	pos int64
+}
+
+// teeWriter duplicates the writes to its sinks. The streaming sinks only get
+// the sequential writes, the positioned ones patching the header are dropped
+// which leaves the placeholder sizes of the streaming convention.
+type teeWriter struct {
+	sinks  []*teeSink
+	probed bool
+	// ended is set once the streaming sinks got all the audio.
+	ended bool
+	// audioStart returns the offset of the audio data, 0 until the data
+	// chunk header is written.
+	audioStart func() int64
+	pos, end   int64
+}
+
+var errTeeStreamSeek = errors.New("a sink is streaming")
+
+// SinkError reports the failure of a sink of a MultiEncoder.
+type SinkError struct {
+	// Sink is the index of the failing sink in the sinks passed to
+	// NewMultiEncoder.
+	Sink int
+	// Written is the number of bytes of the failed write the sink accepted,
+	// the preceding sinks accepting all of them.
+	Written int
+	Err     error
+}
+
+func (e *SinkError) Error() string {
+	return fmt.Sprintf("sink %d failed after %d bytes - %v", e.Sink, e.Written, e.Err)
+}
+
+// Unwrap returns the error of the sink.
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
+
+// probe finds out which sinks can seek.
+func (tw *teeWriter) probe() {
+	if tw.probed {
+		return
+	}
+	tw.probed = true
+	for _, s := range tw.sinks {
+		if ws, ok := s.w.(WriterAtSeeker); ok {
+			if _, err := ws.Seek(0, io.SeekCurrent); err == nil {
+				s.seeker = ws
+			}
+		}
+	}
+}
+
+func (tw *teeWriter) endStreams() {
+	tw.ended = true
+}
+
+func (tw *teeWriter) Write(p []byte) (int, error) {
+	tw.probe()
+	for i, s := range tw.sinks {
+		if s.seeker != nil {
+			if n, err := s.seeker.Write(p); err != nil {
+				return 0, &SinkError{Sink: i, Written: n, Err: err}
+			}
+			continue
+		}
+		if tw.ended {
+			continue
+		}
+		if s.pos != tw.pos {
+			return 0, fmt.Errorf("%w: can't write at offset %d, %v", ErrWriterNotSeekable, tw.pos, errTeeStreamSeek)
+		}
+		n, err := s.w.Write(p)
+		s.pos += int64(n)
+		if err != nil {
+			return 0, &SinkError{Sink: i, Written: n, Err: err}
+		}
+	}
+	tw.pos += int64(len(p))
+	if tw.pos > tw.end {
+		tw.end = tw.pos
+	}
+	return len(p), nil
+}
+
+func (tw *teeWriter) WriteAt(p []byte, off int64) (int, error) {
+	tw.probe()
+	// the streaming sinks drop the header patches, but overwriting the audio
+	// would silently diverge from the other sinks
+	if start := tw.audioStart(); !tw.ended && start > 0 && off+int64(len(p)) > start {
+		for _, s := range tw.sinks {
+			if s.seeker == nil {
+				return 0, fmt.Errorf("%w: can't write at offset %d, %v", ErrWriterNotSeekable, off, errTeeStreamSeek)
+			}
+		}
+	}
+	for i, s := range tw.sinks {
+		if s.seeker != nil {
+			if n, err := s.seeker.WriteAt(p, off); err != nil {
+				return 0, &SinkError{Sink: i, Written: n, Err: err}
+			}
+		}
+	}
+	if end := off + int64(len(p)); end > tw.end {
+		tw.end = end
+	}
+	return len(p), nil
+}
+
+func (tw *teeWriter) Seek(offset int64, whence int) (int64, error) {
+	tw.probe()
+	switch whence {
+	case io.SeekCurrent:
+		offset += tw.pos
+	case io.SeekEnd:
+		offset += tw.end
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	for _, s := range tw.sinks {
+		if s.seeker != nil {
+			if _, err := s.seeker.Seek(offset, io.SeekStart); err != nil {
+				return 0, err
+			}
+		}
+	}
+	tw.pos = offset
+	return offset, nil
+}
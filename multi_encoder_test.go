@@ -0,0 +1,115 @@
+package wav
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestMultiEncoder(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{1, -1, 2, -2, 3, -3}}
+
+	// the references written by a regular and a stream encoder
+	ref := &memWriter{}
+	e := NewEncoder(ref, 44100, 16, 2, FormatPCM)
+	e.Metadata = &Metadata{Title: "tee"}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var refStream bytes.Buffer
+	s := NewStreamEncoder(&refStream, 44100, 16, 2, FormatPCM)
+	if err := s.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	disk := &memWriter{}
+	var stream bytes.Buffer
+	m := NewMultiEncoder([]io.Writer{disk, struct{ io.Writer }{&stream}}, 44100, 16, 2, FormatPCM)
+	m.Metadata = &Metadata{Title: "tee"}
+	// written in two parts to check the sinks stay in sync
+	for _, data := range [][]int{buf.Data[:2], buf.Data[2:]} {
+		if err := m.Write(&audio.IntBuffer{Format: buf.Format, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.WriteAt(buf, 0); !errors.Is(err, ErrWriterNotSeekable) {
+		t.Fatalf("expected ErrWriterNotSeekable when overwriting streamed audio, got %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(disk.buf, ref.buf) {
+		t.Fatal("expected the seekable sink to get a regular file")
+	}
+	if !bytes.Equal(stream.Bytes(), refStream.Bytes()) {
+		t.Fatal("expected the unseekable sink to get a stream")
+	}
+	for _, b := range [][]byte{disk.buf, stream.Bytes()} {
+		nBuf, err := NewDecoder(bytes.NewReader(b)).FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(nBuf.Data, buf.Data) {
+			t.Fatalf("expected %v, got %v", buf.Data, nBuf.Data)
+		}
+	}
+
+	// with only seekable sinks, the audio can be overwritten
+	a, b := &memWriter{}, &memWriter{}
+	m = NewMultiEncoder([]io.Writer{a, b}, 44100, 16, 2, FormatPCM)
+	if err := m.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.WriteAt(&audio.IntBuffer{Format: buf.Format, Data: []int{9, 9}}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.buf, b.buf) {
+		t.Fatal("expected the seekable sinks to get the same file")
+	}
+}
+
+// failingWriter accepts limit bytes and fails the writes past them.
+type failingWriter struct {
+	memWriter
+	limit int
+}
+
+var errSinkFull = errors.New("sink full")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if room := w.limit - len(w.buf); len(p) > room {
+		n, _ := w.memWriter.Write(p[:room])
+		return n, errSinkFull
+	}
+	return w.memWriter.Write(p)
+}
+
+func TestMultiEncoderSinkError(t *testing.T) {
+	a, b := &memWriter{}, &failingWriter{limit: 50}
+	m := NewMultiEncoder([]io.Writer{a, b}, 44100, 16, 2, FormatPCM)
+	err := m.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 20)})
+	var sinkErr *SinkError
+	if !errors.As(err, &sinkErr) {
+		t.Fatalf("expected a sink error, got %v", err)
+	}
+	if sinkErr.Sink != 1 || sinkErr.Written != 50-44 || !errors.Is(err, errSinkFull) {
+		t.Fatalf("expected the sink 1 to fail after %d bytes, got %v", 50-44, sinkErr)
+	}
+	if len(a.buf) != 44+40 {
+		t.Fatalf("expected the first sink to get the audio, got %d bytes", len(a.buf))
+	}
+}
@@ -0,0 +1,159 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/audio"
+)
+
+// HeaderFinalizer is implemented by backends which can't seek back to patch
+// the header, such as multipart uploads to cloud object stores. The body of
+// the file, everything after the header, is streamed to Write, and the
+// finalized header is passed to FinalizeHeader on Close. The file is the
+// header followed by the body.
+type HeaderFinalizer interface {
+	io.Writer
+	// FinalizeHeader receives the header with its final sizes, for instance
+	// to upload it as the first part. It is called once, after the body was
+	// written.
+	FinalizeHeader(header []byte) error
+}
+
+// MultipartEncoder writes a wav file to a HeaderFinalizer: only the header,
+// up to the start of the audio data, is kept in memory and patched, the audio
+// and the metadata chunks written on Close are streamed. It allows generating
+// a file straight to a cloud object store. Since the header is emitted last,
+// the backend has to assemble the parts, for instance by uploading the header
+// as part 1 of a multipart upload while the body is uploaded from part 2. With
+// backends requiring a minimum part size, the beginning of the body can be
+// held back to be uploaded along with the header.
+type MultipartEncoder struct {
+	e *Encoder
+	w *multipartWriter
+}
+
+// NewMultipartEncoder creates an encoder writing a wav file to hf.
+func NewMultipartEncoder(hf HeaderFinalizer, sampleRate, bitDepth, numChans, audioFormat int) *MultipartEncoder {
+	mw := &multipartWriter{hf: hf}
+	return &MultipartEncoder{
+		e: NewEncoder(mw, sampleRate, bitDepth, numChans, audioFormat),
+		w: mw,
+	}
+}
+
+// Encoder returns the encoder serializing the audio, to set its options and
+// metadata before writing. The options patching the header, like
+// ReserveDS64 or EnableLiveHeaderUpdates, are supported, but the methods
+// overwriting the audio, like WriteAt or Truncate, fail with
+// ErrWriterNotSeekable since the body is already streamed.
+func (m *MultipartEncoder) Encoder() *Encoder {
+	return m.e
+}
+
+// Write encodes and writes the passed buffer, see Encoder.Write.
+func (m *MultipartEncoder) Write(buf *audio.IntBuffer) error {
+	if err := m.writeHeader(); err != nil {
+		return err
+	}
+	return m.e.Write(buf)
+}
+
+// WriteFloat encodes and writes the passed float buffer, see
+// Encoder.WriteFloat.
+func (m *MultipartEncoder) WriteFloat(buf *audio.FloatBuffer) error {
+	if err := m.writeHeader(); err != nil {
+		return err
+	}
+	return m.e.WriteFloat(buf)
+}
+
+// Close finalizes the file: the metadata chunks are streamed to the body and
+// the header is passed to FinalizeHeader. It doesn't close the backend.
+func (m *MultipartEncoder) Close() error {
+	if m.w.finalized {
+		return nil
+	}
+	if err := m.writeHeader(); err != nil {
+		return err
+	}
+	if err := m.e.Close(); err != nil {
+		return err
+	}
+	m.w.finalized = true
+	return m.w.hf.FinalizeHeader(m.w.header)
+}
+
+// writeHeader writes the header up to the data chunk in memory, the following
+// writes being streamed.
+func (m *MultipartEncoder) writeHeader() error {
+	if m.w.streaming {
+		return nil
+	}
+	if err := m.e.writeSetup(); err != nil {
+		return err
+	}
+	if err := m.e.flush(); err != nil {
+		return err
+	}
+	m.w.streaming = true
+	return nil
+}
+
+// multipartWriter keeps the header in memory and streams the following bytes
+// to the backend. Once streaming, only the header can be overwritten.
+type multipartWriter struct {
+	hf     HeaderFinalizer
+	header []byte
+	// streaming is set once the header is complete.
+	streaming bool
+	finalized bool
+	pos, end  int64
+}
+
+var errBodyUploaded = errors.New("the body is already streamed")
+
+func (mw *multipartWriter) Write(p []byte) (int, error) {
+	n, err := mw.WriteAt(p, mw.pos)
+	mw.pos += int64(n)
+	return n, err
+}
+
+func (mw *multipartWriter) WriteAt(p []byte, off int64) (int, error) {
+	end := off + int64(len(p))
+	headerLen := int64(len(mw.header))
+	switch {
+	case !mw.streaming:
+		if end > headerLen {
+			mw.header = append(mw.header, make([]byte, end-headerLen)...)
+		}
+		copy(mw.header[off:], p)
+	case end <= headerLen:
+		copy(mw.header[off:], p)
+	case off == mw.end:
+		n, err := mw.hf.Write(p)
+		mw.end += int64(n)
+		return n, err
+	default:
+		return 0, fmt.Errorf("%w: can't write at offset %d, %v", ErrWriterNotSeekable, off, errBodyUploaded)
+	}
+	if end > mw.end {
+		mw.end = end
+	}
+	return len(p), nil
+}
+
+func (mw *multipartWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += mw.pos
+	case io.SeekEnd:
+		offset += mw.end
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	mw.pos = offset
+	return offset, nil
+}
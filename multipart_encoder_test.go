@@ -0,0 +1,96 @@
+package wav
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+// partsBackend mimics a multipart upload: the body is uploaded in parts of
+// partSize bytes from part 2, the header being uploaded as part 1 once
+// finalized.
+type partsBackend struct {
+	partSize int
+	parts    [][]byte
+	pending  []byte
+}
+
+func (b *partsBackend) Write(p []byte) (int, error) {
+	b.pending = append(b.pending, p...)
+	for len(b.pending) >= b.partSize {
+		b.upload(b.pending[:b.partSize])
+		b.pending = b.pending[b.partSize:]
+	}
+	return len(p), nil
+}
+
+func (b *partsBackend) FinalizeHeader(header []byte) error {
+	if len(b.pending) > 0 {
+		b.upload(b.pending)
+		b.pending = nil
+	}
+	b.parts = append([][]byte{append([]byte(nil), header...)}, b.parts...)
+	return nil
+}
+
+func (b *partsBackend) upload(part []byte) {
+	b.parts = append(b.parts, append([]byte(nil), part...))
+}
+
+// object returns the assembled object.
+func (b *partsBackend) object() []byte {
+	return bytes.Join(b.parts, nil)
+}
+
+func TestMultipartEncoder(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 2000)}
+	for i := range buf.Data {
+		buf.Data[i] = i - 1000
+	}
+	configure := func(e *Encoder) {
+		e.ReserveDS64 = true
+		e.BufferWrites = true
+		e.Metadata = &Metadata{
+			Title:     "cloud",
+			Artist:    "encoder",
+			CuePoints: []*CuePoint{{ID: [4]byte{1}, Position: 10, DataChunkID: [4]byte{'d', 'a', 't', 'a'}, SampleOffset: 10, Label: "start"}},
+		}
+	}
+
+	// the reference file written to a seekable writer
+	ref := &memWriter{}
+	e := NewEncoder(ref, 44100, 16, 2, FormatPCM)
+	configure(e)
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &partsBackend{partSize: 1000}
+	m := NewMultipartEncoder(backend, 44100, 16, 2, FormatPCM)
+	configure(m.Encoder())
+	if err := m.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(backend.object(), ref.buf) {
+		t.Fatal("expected the assembled object to match the file written to a seekable writer")
+	}
+	if header := backend.parts[0]; len(header) != int(m.Encoder().pcmChunkPos) {
+		t.Fatalf("expected the header part to end at the audio data, got %d bytes", len(header))
+	}
+
+	m = NewMultipartEncoder(&partsBackend{partSize: 1000}, 44100, 16, 2, FormatPCM)
+	if err := m.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Encoder().WriteAt(buf, 0); !errors.Is(err, ErrWriterNotSeekable) {
+		t.Fatalf("expected ErrWriterNotSeekable when overwriting the body, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// overview computes the min/max peaks of blocks of frames to draw a waveform
+// without reading the audio. Its state carries across buffers.
+type overview struct {
+	decimation int
+	// center is the value of silence, 8 bit samples being unsigned, and bits
+	// the number of significant bits of the int samples.
+	center int
+	bits   int
+
+	numChans int
+	// min and max hold the peaks of the current block of n frames.
+	min, max []int
+	n        int
+	peaks    []int16
+}
+
+// analyze processes interleaved int samples.
+func (o *overview) analyze(data []int, numChans int) {
+	o.setChans(numChans)
+	for i := 0; i+numChans <= len(data); i += numChans {
+		for c, v := range data[i : i+numChans] {
+			v -= o.center
+			if o.bits > 16 {
+				v >>= uint(o.bits - 16)
+			} else {
+				v <<= uint(16 - o.bits)
+			}
+			o.add(c, v)
+		}
+		o.endFrame()
+	}
+}
+
+// analyzeFloat processes interleaved float samples.
+func (o *overview) analyzeFloat(data []float64, numChans int) {
+	o.setChans(numChans)
+	for i := 0; i+numChans <= len(data); i += numChans {
+		for c, v := range data[i : i+numChans] {
+			o.add(c, int(math.Round(finite(v)*math.MaxInt16)))
+		}
+		o.endFrame()
+	}
+}
+
+// analyzePlanar processes non interleaved float samples.
+func (o *overview) analyzePlanar(channels [][]float64) {
+	o.setChans(len(channels))
+	for i := range channels[0] {
+		for c, ch := range channels {
+			o.add(c, int(math.Round(finite(ch[i])*math.MaxInt16)))
+		}
+		o.endFrame()
+	}
+}
+
+func (o *overview) setChans(numChans int) {
+	if o.numChans == numChans {
+		return
+	}
+	o.numChans = numChans
+	o.min = make([]int, numChans)
+	o.max = make([]int, numChans)
+	o.n = 0
+}
+
+func (o *overview) add(c, v int) {
+	if o.n == 0 || v < o.min[c] {
+		o.min[c] = v
+	}
+	if o.n == 0 || v > o.max[c] {
+		o.max[c] = v
+	}
+}
+
+func (o *overview) endFrame() {
+	o.n++
+	if o.n == o.decimation {
+		o.endBlock()
+	}
+}
+
+// endBlock appends the peaks of the current block.
+func (o *overview) endBlock() {
+	if o.n == 0 {
+		return
+	}
+	for c := range o.min {
+		o.peaks = append(o.peaks, clampInt16(o.min[c]), clampInt16(o.max[c]))
+	}
+	o.n = 0
+}
+
+func clampInt16(v int) int16 {
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+// encode returns the content of the overview chunk, limited to the blocks
+// covering the passed number of frames so trimmed frames are left out.
+func (o *overview) encode(frames int) []byte {
+	o.endBlock()
+	if o.numChans == 0 {
+		return nil
+	}
+	blocks := (frames + o.decimation - 1) / o.decimation
+	peaks := o.peaks
+	if n := blocks * 2 * o.numChans; n < len(peaks) {
+		peaks = peaks[:n]
+	}
+	if len(peaks) == 0 {
+		return nil
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, 6+len(peaks)*2))
+	binary.Write(buf, binary.LittleEndian, uint32(o.decimation))
+	binary.Write(buf, binary.LittleEndian, uint16(o.numChans))
+	binary.Write(buf, binary.LittleEndian, peaks)
+	return buf.Bytes()
+}
+
+// EnableOverview makes the encoder compute the min and max peaks of each
+// block of decimation frames of the appended audio and write them in an ovwf
+// chunk on Close, see CIDOvwf, so applications can draw the waveform without
+// reading the audio. The audio written by WriteAt, WriteFrame and WriteRaw
+// isn't analyzed. A non positive decimation disables the overview.
+//
+// The ovwf chunk is a vendor chunk with the following little endian layout:
+//
+//	uint32  number of frames summarized by each peak (the decimation factor)
+//	uint16  number of channels
+//	int16   min and max pairs of each channel, for each block of frames
+//
+// The peaks are scaled to 16 bits whatever the bit depth of the audio.
+func (e *Encoder) EnableOverview(decimation int) {
+	e.overview = nil
+	if decimation < 1 {
+		return
+	}
+	o := &overview{decimation: decimation, bits: e.BitDepth - int(e.sampleShift())}
+	if e.BitDepth == 8 {
+		o.center = 128
+	}
+	e.overview = o
+}
@@ -0,0 +1,87 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+// readOverview returns the decimation factor, the number of channels and the
+// peaks of the ovwf chunk of the passed file.
+func readOverview(t *testing.T, b []byte) (int, int, []int16) {
+	t.Helper()
+	i := bytes.Index(b, CIDOvwf[:])
+	if i < 0 {
+		t.Fatal("expected an ovwf chunk")
+	}
+	size := int(binary.LittleEndian.Uint32(b[i+4:]))
+	data := b[i+8 : i+8+size]
+	peaks := make([]int16, (size-6)/2)
+	for j := range peaks {
+		peaks[j] = int16(binary.LittleEndian.Uint16(data[6+j*2:]))
+	}
+	return int(binary.LittleEndian.Uint32(data)), int(binary.LittleEndian.Uint16(data[4:])), peaks
+}
+
+func TestEncoderOverview(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		bitDepth int
+		scale    int
+	}{
+		{"16 bit", 16, 1},
+		// 24 bit peaks are scaled down to 16 bits
+		{"24 bit", 24, 256},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// 10 stereo frames, the right channel is the inverted left one
+			var data []int
+			for _, v := range []int{1, -3, 7, 2, 0, 5, -8, 4, 6, -2} {
+				data = append(data, v*tc.scale, -v*tc.scale)
+			}
+			w := &memWriter{}
+			e := NewEncoder(w, 8000, tc.bitDepth, 2, FormatPCM)
+			e.EnableOverview(4)
+			// split the writes in the middle of a block
+			for _, r := range [][2]int{{0, 12}, {12, len(data)}} {
+				buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: data[r[0]:r[1]]}
+				if err := e.Write(buf); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			decimation, numChans, peaks := readOverview(t, w.buf)
+			if decimation != 4 || numChans != 2 {
+				t.Fatalf("expected a decimation of 4 and 2 channels, got %d and %d", decimation, numChans)
+			}
+			// min and max of the left then right channel for each block
+			exp := []int16{-3, 7, -7, 3, -8, 5, -5, 8, -2, 6, -6, 2}
+			if !reflect.DeepEqual(peaks, exp) {
+				t.Fatalf("expected the peaks %v, got %v", exp, peaks)
+			}
+		})
+	}
+}
+
+func TestEncoderOverviewFloat(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 8000, 32, 1, FormatIEEEFloat)
+	e.EnableOverview(2)
+	if err := e.WriteFloatPlanar([][]float64{{0.5, -1, 0.25}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, _, peaks := readOverview(t, w.buf)
+	if exp := []int16{-32767, 16384, 8192, 8192}; !reflect.DeepEqual(peaks, exp) {
+		t.Fatalf("expected the peaks %v, got %v", exp, peaks)
+	}
+}
@@ -0,0 +1,81 @@
+package wav
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// PositionedWriter adapts an io.WriterAt, such as an object store upload
+// addressed by offset, to the WriterAtSeeker an Encoder writes to. The
+// wrapped writer only receives WriteAt calls: the cursor of Write and Seek is
+// tracked by the adapter, the encoder knowing the offset of everything it
+// writes. It is safe for concurrent use.
+type PositionedWriter struct {
+	w io.WriterAt
+
+	mu  sync.Mutex
+	pos int64
+	len int64
+}
+
+// NewPositionedWriter creates a writer writing to w from offset 0.
+func NewPositionedWriter(w io.WriterAt) *PositionedWriter {
+	return &PositionedWriter{w: w}
+}
+
+// Write writes p at the current position and advances it.
+func (w *PositionedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.w.WriteAt(p, w.pos)
+	w.pos += int64(n)
+	if w.pos > w.len {
+		w.len = w.pos
+	}
+	return n, err
+}
+
+// WriteAt writes p at the passed offset without moving the cursor.
+func (w *PositionedWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n, err := w.w.WriteAt(p, off)
+	w.mu.Lock()
+	if end := off + int64(n); end > w.len {
+		w.len = end
+	}
+	w.mu.Unlock()
+	return n, err
+}
+
+// Seek moves the cursor without calling the wrapped writer, io.SeekEnd being
+// relative to the end of the written data.
+func (w *PositionedWriter) Seek(offset int64, whence int) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = w.pos + offset
+	case io.SeekEnd:
+		pos = w.len + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	w.pos = pos
+	return pos, nil
+}
+
+// Len returns the offset of the end of the written data.
+func (w *PositionedWriter) Len() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.len
+}
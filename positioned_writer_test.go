@@ -0,0 +1,85 @@
+package wav
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+// writerAtOnly only supports positioned writes, its Write and Seek methods
+// fail so the test catches any call bypassing WriteAt.
+type writerAtOnly struct {
+	buf []byte
+}
+
+var errNotPositioned = errors.New("only WriteAt is supported")
+
+func (w *writerAtOnly) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(w.buf) {
+		w.buf = append(w.buf, make([]byte, end-len(w.buf))...)
+	}
+	return copy(w.buf[off:], p), nil
+}
+
+func (w *writerAtOnly) Write(p []byte) (int, error) {
+	return 0, errNotPositioned
+}
+
+func (w *writerAtOnly) Seek(offset int64, whence int) (int64, error) {
+	return 0, errNotPositioned
+}
+
+func TestPositionedWriter(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 48000}
+	buf := &audio.IntBuffer{Format: format, Data: make([]int, 200)}
+	for i := range buf.Data {
+		buf.Data[i] = i - 100
+	}
+	patch := &audio.IntBuffer{Format: format, Data: []int{7, 7, 7, 7}}
+	encode := func(w WriterAtSeeker, buffered bool) *Encoder {
+		e := NewEncoder(w, 48000, 24, 2, FormatPCM)
+		e.BufferWrites = buffered
+		e.Metadata = &Metadata{Title: "positioned", Bext: &BextChunk{Description: "take"}}
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		// overwrite frames 10 and 11, then extend the data past a gap
+		if _, err := e.WriteAtFrame(patch, 10); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.WriteAt(patch, 120*6); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	exp := &memWriter{}
+	encode(exp, false)
+
+	for _, buffered := range []bool{false, true} {
+		target := &writerAtOnly{}
+		w := NewPositionedWriter(target)
+		e := encode(w, buffered)
+		if !bytes.Equal(target.buf, exp.buf) {
+			t.Fatalf("buffered %t: expected the file written through WriteAt to match the one written sequentially", buffered)
+		}
+		if w.Len() != int64(e.WrittenBytes) {
+			t.Fatalf("buffered %t: expected %d bytes to be written, got %d", buffered, e.WrittenBytes, w.Len())
+		}
+	}
+
+	w := NewPositionedWriter(&writerAtOnly{})
+	if _, err := w.Seek(-1, 0); err == nil {
+		t.Fatal("expected a negative position to be refused")
+	}
+	if _, err := w.WriteAt([]byte{1}, -1); err == nil {
+		t.Fatal("expected a negative offset to be refused")
+	}
+}
@@ -0,0 +1,115 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/riff"
+)
+
+// Repair finalizes a wav file that was never closed, for instance because the
+// process writing it died before calling Encoder.Close. The data chunk is
+// assumed to extend to the end of the file, its size is recomputed from the
+// file size (dropping any trailing partial frame) and the RIFF and data chunk
+// sizes are patched. Files with a consistent RIFF size are left untouched.
+// The passed writer also needs to implement io.Reader so the existing chunks
+// can be parsed. If it supports it, the trailing partial frame is truncated.
+// Files with a custom form type, see Encoder.FormType, are repaired too.
+func Repair(f WriterAtSeeker) error {
+	r, ok := f.(io.Reader)
+	if !ok {
+		return errors.New("can't repair a file that can't be read")
+	}
+	fileSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var header struct {
+		ID     [4]byte
+		Size   uint32
+		Format [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("failed to read the RIFF header - %w", err)
+	}
+	if header.ID != riff.RiffID || !validFormType(header.Format) {
+		return fmt.Errorf("%s - %s", header.ID, riff.ErrFmtNotSupported)
+	}
+	if int64(header.Size)+8 == fileSize {
+		return nil
+	}
+
+	var (
+		blockAlign uint16
+		pos        int64 = 12
+	)
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return ErrPCMChunkNotFound
+			}
+			return err
+		}
+		pos += 8
+		if chunk.ID == riff.DataFormatID {
+			break
+		}
+		if chunk.ID == riff.FmtID {
+			var fmtChunk struct {
+				AudioFormat    uint16
+				NumChans       uint16
+				SampleRate     uint32
+				AvgBytesPerSec uint32
+				BlockAlign     uint16
+			}
+			if err := binary.Read(r, binary.LittleEndian, &fmtChunk); err != nil {
+				return fmt.Errorf("failed to read the fmt chunk - %w", err)
+			}
+			blockAlign = fmtChunk.BlockAlign
+		}
+		// all RIFF chunks must be word aligned
+		size := int64(chunk.Size)
+		if size%2 == 1 {
+			size++
+		}
+		pos += size
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if blockAlign == 0 {
+		return errors.New("fmt chunk not found before the data chunk")
+	}
+
+	dataSize := fileSize - pos
+	dataSize -= dataSize % int64(blockAlign)
+	if dataSize > int64(sizePlaceholder) || pos+dataSize-8 > int64(sizePlaceholder) {
+		return errors.New("the data is too large to fit in a wav file")
+	}
+	if t, ok := f.(interface{ Truncate(size int64) error }); ok && pos+dataSize < fileSize {
+		if err := t.Truncate(pos + dataSize); err != nil {
+			return fmt.Errorf("failed to truncate the trailing partial frame - %w", err)
+		}
+	}
+
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(pos+dataSize-8))
+	if _, err := f.WriteAt(b, 4); err != nil {
+		return fmt.Errorf("failed to patch the RIFF size - %w", err)
+	}
+	binary.LittleEndian.PutUint32(b, uint32(dataSize))
+	if _, err := f.WriteAt(b, pos-4); err != nil {
+		return fmt.Errorf("failed to patch the data chunk size - %w", err)
+	}
+	return nil
+}
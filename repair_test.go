@@ -0,0 +1,155 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestRepair(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 200)}
+	for i := range buf.Data {
+		buf.Data[i] = i - 100
+	}
+
+	testCases := []struct {
+		desc string
+		// damage simulates an interrupted recording on the raw bytes of an
+		// unfinished file.
+		damage      func(b []byte) []byte
+		expFrames   int
+		expFileSize int
+	}{
+		{"placeholder sizes", func(b []byte) []byte { return b }, 100, 444},
+		{"partial trailing frame", func(b []byte) []byte { return append(b, 0x01, 0x02, 0x03) }, 100, 444},
+		{"legacy placeholder sizes", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[4:], 42)
+			binary.LittleEndian.PutUint32(b[40:], 42)
+			return b[:len(b)-40]
+		}, 90, 404},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			out, err := os.Create("testOutput/repair.wav")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(out.Name())
+			defer out.Close()
+
+			e := NewEncoder(out, 44100, 16, 2, 1)
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			// the encoder is never closed
+			b, err := ioutil.ReadFile(out.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := out.Truncate(0); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := out.WriteAt(tc.damage(b), 0); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Repair(out); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err = ioutil.ReadFile(out.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != tc.expFileSize {
+				t.Fatalf("expected the repaired file to be %d bytes, got %d", tc.expFileSize, len(b))
+			}
+			if size := binary.LittleEndian.Uint32(b[4:]); int(size) != tc.expFileSize-8 {
+				t.Errorf("expected the RIFF size to be %d, got %d", tc.expFileSize-8, size)
+			}
+			d := NewDecoder(bytes.NewReader(b))
+			nBuf, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.PCMSize != tc.expFrames*4 {
+				t.Errorf("expected the data chunk size to be %d, got %d", tc.expFrames*4, d.PCMSize)
+			}
+			if len(nBuf.Data) != tc.expFrames*2 {
+				t.Fatalf("expected %d samples, got %d", tc.expFrames*2, len(nBuf.Data))
+			}
+			for i := range nBuf.Data {
+				if nBuf.Data[i] != buf.Data[i] {
+					t.Fatalf("sample %d: expected %d, got %d", i, buf.Data[i], nBuf.Data[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRepairFormType(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	out, err := os.Create("testOutput/repair-form-type.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	e := NewEncoder(out, 44100, 16, 2, 1)
+	e.FormType = [4]byte{'B', 'W', 'F', '1'}
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 20)}); err != nil {
+		t.Fatal(err)
+	}
+	// the encoder is never closed
+	if err := Repair(out); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[8:12]) != "BWF1" {
+		t.Fatalf("expected the form type to be kept, got %q", b[8:12])
+	}
+	if size := binary.LittleEndian.Uint32(b[4:]); int(size) != len(b)-8 {
+		t.Fatalf("expected the RIFF size to be %d, got %d", len(b)-8, size)
+	}
+	if size := binary.LittleEndian.Uint32(b[40:]); size != 40 {
+		t.Fatalf("expected the data chunk size to be 40, got %d", size)
+	}
+}
+
+func TestRepairFinalizedFile(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	orig, err := ioutil.ReadFile("fixtures/kick.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("testOutput/repair-kick.wav", orig, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testOutput/repair-kick.wav")
+	f, err := os.OpenFile("testOutput/repair-kick.wav", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := Repair(f); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(orig, b) {
+		t.Fatal("expected a finalized file to be left untouched")
+	}
+}
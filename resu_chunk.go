@@ -0,0 +1,53 @@
+package wav
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/riff"
+)
+
+// SetResU sets the JSON document written in a ResU chunk on Close, read by
+// iZotope RX and other mastering tools. The document is written as is, the
+// package doesn't interpret it. It takes precedence over Metadata.ResU, a nil
+// document falls back to it.
+func (e *Encoder) SetResU(json []byte) {
+	e.resU = json
+}
+
+// resUChunk returns the document of the ResU chunk, nil if there is none.
+func (e *Encoder) resUChunk() []byte {
+	if len(e.resU) > 0 {
+		return e.resU
+	}
+	if e.Metadata != nil && len(e.Metadata.ResU) > 0 {
+		return e.Metadata.ResU
+	}
+	return nil
+}
+
+// DecodeResUChunk decodes a ResU chunk and stores its JSON document in
+// d.Metadata.ResU.
+func DecodeResUChunk(d *Decoder, ch *riff.Chunk) error {
+	if ch == nil {
+		return fmt.Errorf("can't decode a nil chunk")
+	}
+	if d == nil {
+		return fmt.Errorf("nil decoder")
+	}
+	if ch.ID != CIDResU {
+		return nil
+	}
+	buf := make([]byte, ch.Size)
+	if _, err := io.ReadFull(ch, buf); err != nil {
+		return fmt.Errorf("failed to read the ResU chunk - %w", err)
+	}
+	if d.Metadata == nil {
+		d.Metadata = &Metadata{}
+	}
+	// the parser includes the pad byte of odd sized chunks, and some writers
+	// null terminate the document
+	d.Metadata.ResU = bytes.TrimRight(buf, "\x00")
+	return nil
+}
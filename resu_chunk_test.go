@@ -0,0 +1,61 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderResU(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		setResU  []byte
+		metadata []byte
+		exp      string
+	}{
+		// odd length so the chunk needs a pad byte
+		{"odd", []byte(`{"version":1}`), nil, `{"version":1}`},
+		{"even", []byte(`{"version":12}`), nil, `{"version":12}`},
+		{"from metadata", nil, []byte(`{"a":"b"}`), `{"a":"b"}`},
+		{"precedence", []byte(`{"set":1}`), []byte(`{"metadata":1}`), `{"set":1}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 48000, 16, 1, FormatPCM)
+			e.Metadata = &Metadata{Title: "master", ResU: tc.metadata}
+			e.SetResU(tc.setResU)
+			if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 48000}, Data: []int{1, 2, 3}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(w.buf)%2 != 0 {
+				t.Fatalf("expected the file to be padded to an even size, got %d bytes", len(w.buf))
+			}
+			if size := binary.LittleEndian.Uint32(w.buf[4:]); int(size) != len(w.buf)-8 {
+				t.Fatalf("expected the RIFF size %d, got %d", len(w.buf)-8, size)
+			}
+			chunks := fileChunks(w.buf)
+			if last := chunks[len(chunks)-1]; last.ID != CIDResU || last.Size != int64(len(tc.exp)) {
+				t.Fatalf("expected the file to end with a %d bytes ResU chunk, got %v", len(tc.exp), chunks)
+			}
+
+			d := NewDecoder(bytes.NewReader(w.buf))
+			d.ReadMetadata()
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d.Metadata == nil || string(d.Metadata.ResU) != tc.exp {
+				t.Fatalf("expected the ResU document %s, got %#v", tc.exp, d.Metadata)
+			}
+			if d.Metadata.Title != "master" {
+				t.Fatalf("expected the INFO chunk to be decoded, got %q", d.Metadata.Title)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package wav
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/go-audio/audio"
+)
+
+// RoundTripOptions configures the encoding done by RoundTrip.
+type RoundTripOptions struct {
+	// BitDepth defaults to the source bit depth of the buffer, or 16 if it
+	// isn't set.
+	BitDepth int
+	// AudioFormat defaults to FormatPCM.
+	AudioFormat int
+	// Configure, if set, is called with the encoder before writing to set
+	// its other options such as ValidBitsPerSample.
+	Configure func(e *Encoder)
+}
+
+// RoundTrip encodes the passed buffer to a wav file in memory and decodes it
+// back, so users can check how their samples survive a bit depth or format
+// choice by comparing the returned buffer with the original one. opts can be
+// nil to use the defaults.
+func RoundTrip(buf *audio.IntBuffer, opts *RoundTripOptions) (*audio.IntBuffer, error) {
+	if buf == nil || buf.Format == nil {
+		return nil, errors.New("can't round trip a buffer without a format")
+	}
+	if opts == nil {
+		opts = &RoundTripOptions{}
+	}
+	bitDepth := opts.BitDepth
+	if bitDepth == 0 {
+		bitDepth = buf.SourceBitDepth
+	}
+	if bitDepth == 0 {
+		bitDepth = 16
+	}
+	audioFormat := opts.AudioFormat
+	if audioFormat == 0 {
+		audioFormat = FormatPCM
+	}
+
+	// the file is written in a single allocation sized for the header and
+	// the data
+	w := NewSliceWriter(make([]byte, 1024+len(buf.Data)*((bitDepth+7)/8)))
+	e := NewEncoder(w, buf.Format.SampleRate, bitDepth, buf.Format.NumChannels, audioFormat)
+	if opts.Configure != nil {
+		opts.Configure(e)
+	}
+	if err := e.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return NewDecoder(bytes.NewReader(w.buf[:w.Len()])).FullPCMBuffer()
+}
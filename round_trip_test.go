@@ -0,0 +1,40 @@
+package wav
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestRoundTrip(t *testing.T) {
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	testCases := []struct {
+		desc string
+		in   []int
+		opts *RoundTripOptions
+		exp  []int
+	}{
+		{"defaults", []int{0, 1, -1, 32767, -32768, 42}, nil, []int{0, 1, -1, 32767, -32768, 42}},
+		{"24 bit", []int{0, 8388607, -8388608, 42}, &RoundTripOptions{BitDepth: 24}, []int{0, 8388607, -8388608, 42}},
+		{"configured", []int{1, 2}, &RoundTripOptions{BitDepth: 24, Configure: func(e *Encoder) { e.ValidBitsPerSample = 20 }}, []int{16, 32}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			out, err := RoundTrip(&audio.IntBuffer{Format: format, Data: tc.in}, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out.Data, tc.exp) {
+				t.Fatalf("expected %v, got %v", tc.exp, out.Data)
+			}
+			if out.Format.SampleRate != 44100 || out.Format.NumChannels != 2 {
+				t.Fatalf("unexpected format %+v", out.Format)
+			}
+		})
+	}
+
+	if _, err := RoundTrip(&audio.IntBuffer{Format: format, Data: []int{1, 2}}, &RoundTripOptions{BitDepth: 12}); err == nil {
+		t.Fatal("expected an error with an unsupported bit depth")
+	}
+}
@@ -0,0 +1,123 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+// SampleFormat describes the layout of raw interleaved samples, see
+// WriteInterleavedBytes.
+type SampleFormat struct {
+	// BitDepth is the size of a sample: 8, 16, 24 or 32 bits for int
+	// samples, 32 or 64 bits for float samples. 8 bit samples are unsigned
+	// like in wav files, silence being 128.
+	BitDepth int
+	// Float indicates IEEE float samples, full scale being [-1, 1].
+	Float bool
+	// BigEndian indicates the byte order of the samples, little endian
+	// otherwise.
+	BigEndian bool
+}
+
+// validate returns an error if the format can't be decoded.
+func (f SampleFormat) validate() error {
+	if f.Float {
+		if f.BitDepth != 32 && f.BitDepth != 64 {
+			return fmt.Errorf("invalid float sample size of %d bits", f.BitDepth)
+		}
+		return nil
+	}
+	switch f.BitDepth {
+	case 8, 16, 24, 32:
+		return nil
+	}
+	return fmt.Errorf("invalid int sample size of %d bits", f.BitDepth)
+}
+
+// WriteInterleavedBytes converts the passed raw interleaved samples, made of
+// whole frames in the passed format, to the format of the encoder and writes
+// them. It is the entry point of bindings handing over opaque buffers: the
+// byte order is swapped as needed, int samples are scaled to the bit depth
+// (or to ValidBitsPerSample) of the encoder, truncating the extra bits, and
+// int and float samples are converted to one another. Float samples written
+// to an int encoder are quantized like WriteFloat does. The byte order being
+// described by the format, InputBigEndian must not be set.
+func (e *Encoder) WriteInterleavedBytes(b []byte, format SampleFormat) error {
+	if err := format.validate(); err != nil {
+		return err
+	}
+	if e.InputBigEndian {
+		return errors.New("the byte order of the samples is given by their format, InputBigEndian must not be set")
+	}
+	if e.NumChans < 1 {
+		return fmt.Errorf("invalid number of channels %d", e.NumChans)
+	}
+	size := format.BitDepth / 8
+	if frameSize := size * e.NumChans; len(b)%frameSize != 0 {
+		return fmt.Errorf("%d bytes aren't whole frames of %d bytes", len(b), frameSize)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if format.BigEndian {
+		order = binary.BigEndian
+	}
+	bufFormat := &audio.Format{NumChannels: e.NumChans, SampleRate: e.SampleRate}
+
+	if format.Float {
+		data := make([]float64, len(b)/size)
+		for i := range data {
+			if size == 4 {
+				data[i] = float64(math.Float32frombits(order.Uint32(b[i*size:])))
+			} else {
+				data[i] = math.Float64frombits(order.Uint64(b[i*size:]))
+			}
+		}
+		return e.WriteFloat(&audio.FloatBuffer{Format: bufFormat, Data: data})
+	}
+
+	// the samples are decoded signed, 8 bit samples being centered on 0
+	data := make([]int, len(b)/size)
+	for i := range data {
+		s := b[i*size : (i+1)*size]
+		switch size {
+		case 1:
+			data[i] = int(s[0]) - 128
+		case 2:
+			data[i] = int(int16(order.Uint16(s)))
+		case 3:
+			if format.BigEndian {
+				data[i] = int(int32(uint32(s[0])<<24|uint32(s[1])<<16|uint32(s[2])<<8) >> 8)
+			} else {
+				data[i] = int(audio.Int24LETo32(s))
+			}
+		case 4:
+			data[i] = int(int32(order.Uint32(s)))
+		}
+	}
+
+	if e.WavAudioFormat == FormatIEEEFloat {
+		full := float64(int(1) << uint(format.BitDepth-1))
+		floats := make([]float64, len(data))
+		for i, v := range data {
+			floats[i] = float64(v) / full
+		}
+		return e.WriteFloat(&audio.FloatBuffer{Format: bufFormat, Data: floats})
+	}
+
+	bits := e.BitDepth - int(e.sampleShift())
+	for i, v := range data {
+		if bits > format.BitDepth {
+			v <<= uint(bits - format.BitDepth)
+		} else {
+			v >>= uint(format.BitDepth - bits)
+		}
+		if e.BitDepth == 8 {
+			v += 128
+		}
+		data[i] = v
+	}
+	return e.Write(&audio.IntBuffer{Format: bufFormat, Data: data, SourceBitDepth: e.BitDepth})
+}
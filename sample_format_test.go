@@ -0,0 +1,117 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderWriteInterleavedBytes(t *testing.T) {
+	// pack serializes the passed samples in the passed format
+	pack := func(format SampleFormat, samples ...float64) []byte {
+		var order binary.ByteOrder = binary.LittleEndian
+		if format.BigEndian {
+			order = binary.BigEndian
+		}
+		size := format.BitDepth / 8
+		b := make([]byte, len(samples)*size)
+		for i, v := range samples {
+			s := b[i*size:]
+			switch {
+			case format.Float && size == 4:
+				order.PutUint32(s, math.Float32bits(float32(v)))
+			case format.Float:
+				order.PutUint64(s, math.Float64bits(v))
+			case size == 1:
+				s[0] = uint8(v)
+			case size == 2:
+				order.PutUint16(s, uint16(int16(v)))
+			case size == 3:
+				u := uint32(int32(v))
+				if format.BigEndian {
+					s[0], s[1], s[2] = byte(u>>16), byte(u>>8), byte(u)
+				} else {
+					s[0], s[1], s[2] = byte(u), byte(u>>8), byte(u>>16)
+				}
+			default:
+				order.PutUint32(s, uint32(int32(v)))
+			}
+		}
+		return b
+	}
+	testCases := []struct {
+		desc        string
+		format      SampleFormat
+		in          []float64
+		bitDepth    int
+		audioFormat int
+		// exp is written with Write, or with WriteFloat if expFloat is set
+		exp      []float64
+		expFloat bool
+	}{
+		{"int16 LE to 16 bit", SampleFormat{BitDepth: 16}, []float64{1, -2, 300, -32768}, 16, FormatPCM, []float64{1, -2, 300, -32768}, false},
+		{"int16 BE to 24 bit", SampleFormat{BitDepth: 16, BigEndian: true}, []float64{1, -2, 300, -32768}, 24, FormatPCM, []float64{256, -512, 76800, -8388608}, false},
+		{"int24 LE to 16 bit", SampleFormat{BitDepth: 24}, []float64{256, -512, 8388607, -8388608}, 16, FormatPCM, []float64{1, -2, 32767, -32768}, false},
+		{"int24 BE to 32 bit", SampleFormat{BitDepth: 24, BigEndian: true}, []float64{1, -1, 8388607, -8388608}, 32, FormatPCM, []float64{256, -256, 2147483392, -2147483648}, false},
+		{"uint8 to 16 bit", SampleFormat{BitDepth: 8}, []float64{128, 0, 255, 129}, 16, FormatPCM, []float64{0, -32768, 32512, 256}, false},
+		{"int16 to 8 bit", SampleFormat{BitDepth: 16}, []float64{0, -32768, 32767, 256}, 8, FormatPCM, []float64{128, 0, 255, 129}, false},
+		{"int32 BE to 16 bit", SampleFormat{BitDepth: 32, BigEndian: true}, []float64{65536, -65536, 0, 1 << 30}, 16, FormatPCM, []float64{1, -1, 0, 16384}, false},
+		{"float32 LE to 16 bit", SampleFormat{BitDepth: 32, Float: true}, []float64{0.5, -0.25, 0, -1}, 16, FormatPCM, []float64{0.5, -0.25, 0, -1}, true},
+		{"float64 BE to float32", SampleFormat{BitDepth: 64, Float: true, BigEndian: true}, []float64{0.5, -0.25, 0.125, 1}, 32, FormatIEEEFloat, []float64{0.5, -0.25, 0.125, 1}, true},
+		{"int16 to float32", SampleFormat{BitDepth: 16}, []float64{16384, -8192, 0, -32768}, 32, FormatIEEEFloat, []float64{0.5, -0.25, 0, -1}, true},
+		{"uint8 to float64", SampleFormat{BitDepth: 8}, []float64{192, 64, 128, 0}, 64, FormatIEEEFloat, []float64{0.5, -0.5, 0, -1}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+			exp := &memWriter{}
+			e := NewEncoder(exp, 44100, tc.bitDepth, 2, tc.audioFormat)
+			if tc.expFloat {
+				if err := e.WriteFloat(&audio.FloatBuffer{Format: format, Data: tc.exp}); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				data := make([]int, len(tc.exp))
+				for i, v := range tc.exp {
+					data[i] = int(v)
+				}
+				if err := e.Write(&audio.IntBuffer{Format: format, Data: data}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			w := &memWriter{}
+			e = NewEncoder(w, 44100, tc.bitDepth, 2, tc.audioFormat)
+			if err := e.WriteInterleavedBytes(pack(tc.format, tc.in...), tc.format); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(w.buf, exp.buf) {
+				t.Fatalf("expected the samples to be converted to %v", tc.exp)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 44100, 16, 2, FormatPCM)
+	if err := e.WriteInterleavedBytes(make([]byte, 6), SampleFormat{BitDepth: 16}); err == nil {
+		t.Fatal("expected a partial frame to be refused")
+	}
+	if err := e.WriteInterleavedBytes(make([]byte, 4), SampleFormat{BitDepth: 16, Float: true}); err == nil {
+		t.Fatal("expected 16 bit float samples to be refused")
+	}
+	if err := e.WriteInterleavedBytes(make([]byte, 8), SampleFormat{BitDepth: 12}); err == nil {
+		t.Fatal("expected 12 bit samples to be refused")
+	}
+	e.InputBigEndian = true
+	if err := e.WriteInterleavedBytes(make([]byte, 4), SampleFormat{BitDepth: 16}); err == nil {
+		t.Fatal("expected InputBigEndian to be refused")
+	}
+}
@@ -0,0 +1,229 @@
+package wav
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/go-audio/riff"
+)
+
+// silenceDetector finds the runs of frames staying below an amplitude
+// threshold for a minimum number of frames. Its state carries across buffers.
+type silenceDetector struct {
+	// threshold is the amplitude relative to full scale.
+	threshold float64
+	// intThreshold and center apply it to integer samples, center being the
+	// value of silence, 8 bit samples being unsigned.
+	intThreshold int
+	center       int
+	minFrames    int
+
+	// runStart is the first frame of the current silent run and runLen its
+	// length, 0 when the last analyzed frame wasn't silent.
+	runStart int
+	runLen   int
+	// markers are the first frames of the runs that lasted long enough.
+	markers []int
+}
+
+// frame extends or ends the current run with the passed frame.
+func (s *silenceDetector) frame(frame int, silent bool) {
+	if !silent {
+		s.runLen = 0
+		return
+	}
+	if s.runLen == 0 {
+		s.runStart = frame
+	}
+	s.runLen++
+	if s.runLen == s.minFrames {
+		s.markers = append(s.markers, s.runStart)
+	}
+}
+
+// analyze processes the interleaved samples of frames starting at firstFrame.
+func (s *silenceDetector) analyze(data []int, numChans, firstFrame int) {
+	for i := 0; i+numChans <= len(data); i += numChans {
+		silent := true
+		for _, v := range data[i : i+numChans] {
+			v -= s.center
+			if v > s.intThreshold || v < -s.intThreshold {
+				silent = false
+				break
+			}
+		}
+		s.frame(firstFrame+i/numChans, silent)
+	}
+}
+
+// analyzeFloat processes the interleaved float samples of frames starting at
+// firstFrame.
+func (s *silenceDetector) analyzeFloat(data []float64, numChans, firstFrame int) {
+	for i := 0; i+numChans <= len(data); i += numChans {
+		silent := true
+		for _, v := range data[i : i+numChans] {
+			if v = finite(v); v > s.threshold || v < -s.threshold {
+				silent = false
+				break
+			}
+		}
+		s.frame(firstFrame+i/numChans, silent)
+	}
+}
+
+// analyzePlanar processes the non interleaved float samples of frames
+// starting at firstFrame.
+func (s *silenceDetector) analyzePlanar(channels [][]float64, firstFrame int) {
+	if len(channels) == 0 {
+		return
+	}
+	for i := range channels[0] {
+		silent := true
+		for _, ch := range channels {
+			if v := finite(ch[i]); v > s.threshold || v < -s.threshold {
+				silent = false
+				break
+			}
+		}
+		s.frame(firstFrame+i, silent)
+	}
+}
+
+// EnableSilenceMarkers makes the encoder analyze the written audio and add a
+// cue point at the first frame of each run of silence lasting at least
+// minDuration. A frame is silent when all its samples are below thresholdDB
+// (in dBFS, for instance -60). The cue points are written in a cue chunk on
+// Close along with the cue points of the metadata, if any.
+func (e *Encoder) EnableSilenceMarkers(thresholdDB float64, minDuration time.Duration) {
+	threshold := math.Pow(10, thresholdDB/20)
+	s := &silenceDetector{
+		threshold:    threshold,
+		intThreshold: int(float64(int64(1)<<(uint(e.BitDepth-1)-e.sampleShift())) * threshold),
+		minFrames:    FramesForDuration(minDuration, e.SampleRate),
+	}
+	if s.minFrames < 1 {
+		s.minFrames = 1
+	}
+	if e.BitDepth == 8 {
+		s.center = 128
+	}
+	e.silence = s
+}
+
+// cuePoints returns the cue points of the metadata followed by the silence
+// markers.
+func (e *Encoder) cuePoints() []*CuePoint {
+	var points []*CuePoint
+	var lastID uint32
+	if e.Metadata != nil {
+		for _, c := range e.Metadata.CuePoints {
+			points = append(points, c)
+			if id := binary.LittleEndian.Uint32(c.ID[:]); id > lastID {
+				lastID = id
+			}
+		}
+	}
+	if e.silence != nil {
+		for _, frame := range e.silence.markers {
+			if frame >= e.frames {
+				// the silence was trimmed
+				continue
+			}
+			lastID++
+			c := &CuePoint{
+				Position:     uint32(frame),
+				DataChunkID:  riff.DataFormatID,
+				SampleOffset: uint32(frame),
+			}
+			binary.LittleEndian.PutUint32(c.ID[:], lastID)
+			points = append(points, c)
+		}
+	}
+	return points
+}
+
+// tailTrimmer tracks the end of the last frame above an amplitude threshold.
+type tailTrimmer struct {
+	// threshold is the amplitude relative to full scale.
+	threshold float64
+	// intThreshold and center apply it to integer samples.
+	intThreshold int
+	center       int
+	// end is the frame following the last non silent frame.
+	end int
+}
+
+// keep moves the end to the passed frame count if it's further, WriteAt
+// writing the frames out of order.
+func (t *tailTrimmer) keep(end int) {
+	if end > t.end {
+		t.end = end
+	}
+}
+
+// analyze processes the interleaved samples of frames starting at firstFrame.
+func (t *tailTrimmer) analyze(data []int, numChans, firstFrame int) {
+	for i := len(data) - 1; i >= 0; i-- {
+		if v := data[i] - t.center; v > t.intThreshold || v < -t.intThreshold {
+			t.keep(firstFrame + i/numChans + 1)
+			return
+		}
+	}
+}
+
+// analyzeFloat processes the interleaved float samples of frames starting at
+// firstFrame.
+func (t *tailTrimmer) analyzeFloat(data []float64, numChans, firstFrame int) {
+	for i := len(data) - 1; i >= 0; i-- {
+		if v := finite(data[i]); v > t.threshold || v < -t.threshold {
+			t.keep(firstFrame + i/numChans + 1)
+			return
+		}
+	}
+}
+
+// analyzePlanar processes the non interleaved float samples of frames
+// starting at firstFrame.
+func (t *tailTrimmer) analyzePlanar(channels [][]float64, firstFrame int) {
+	last := -1
+	for _, ch := range channels {
+		for i := len(ch) - 1; i > last; i-- {
+			if v := finite(ch[i]); v > t.threshold || v < -t.threshold {
+				last = i
+				break
+			}
+		}
+	}
+	if last >= 0 {
+		t.keep(firstFrame + last + 1)
+	}
+}
+
+// keepTail marks the frames written so far as audio for TrimTrailingSilence,
+// for the write paths which don't analyze the samples.
+func (e *Encoder) keepTail() {
+	e.lock()
+	defer e.unlock()
+	if e.trim != nil {
+		e.trim.keep(e.frames)
+	}
+}
+
+// TrimTrailingSilence makes the encoder drop the silent frames at the end of
+// the audio when closing, a frame being silent when all its samples are below
+// thresholdDB (in dBFS, for instance -60). The frames are discarded like with
+// Truncate. The frames written by WriteRaw, WriteFrame and WriteFrames aren't
+// analyzed and are always kept, like the last frame written by WriteAt which
+// isn't silent.
+func (e *Encoder) TrimTrailingSilence(thresholdDB float64) {
+	threshold := math.Pow(10, thresholdDB/20)
+	t := &tailTrimmer{
+		threshold:    threshold,
+		intThreshold: int(float64(int64(1)<<(uint(e.BitDepth-1)-e.sampleShift())) * threshold),
+	}
+	if e.BitDepth == 8 {
+		t.center = 128
+	}
+	e.trim = t
+}
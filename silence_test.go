@@ -0,0 +1,319 @@
+package wav
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderSilenceMarkers(t *testing.T) {
+	const sampleRate = 1000
+	var data []int
+	// loud and silent sections in frames, the short silence isn't marked
+	for i, section := range []int{100, 300, 100, 100, 50, 250} {
+		for j := 0; j < section; j++ {
+			v := 2
+			if i%2 == 0 {
+				v = 10000 * (1 - 2*(j%2))
+			}
+			data = append(data, v, -v)
+		}
+	}
+
+	w := &memWriter{}
+	e := NewEncoder(w, sampleRate, 16, 2, 1)
+	e.EnableSilenceMarkers(-60, 200*time.Millisecond)
+	e.Metadata = &Metadata{CuePoints: []*CuePoint{{ID: [4]byte{7}, DataChunkID: [4]byte{'d', 'a', 't', 'a'}}}}
+	// split the writes in the middle of silent runs
+	for _, r := range [][2]int{{0, 500}, {500, 1400}, {1400, len(data)}} {
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: sampleRate}, Data: data[r[0]:r[1]]}
+		if err := e.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata == nil || len(d.Metadata.CuePoints) != 3 {
+		t.Fatalf("expected 3 cue points, got %#v", d.Metadata)
+	}
+	for i, exp := range []struct {
+		id       byte
+		position uint32
+	}{{7, 0}, {8, 100}, {9, 650}} {
+		c := d.Metadata.CuePoints[i]
+		if c.ID != [4]byte{exp.id} || c.Position != exp.position {
+			t.Errorf("expected cue point %d to have ID %d at %d, got %v at %d", i, exp.id, exp.position, c.ID, c.Position)
+		}
+	}
+}
+
+func TestEncoderSilenceMarkersValidBits(t *testing.T) {
+	// a -20 dBFS square wave of 24 bit samples packed in 32 bit containers
+	data := make([]int, 200)
+	for i := range data {
+		data[i] = 838861 * (1 - 2*(i%2))
+	}
+	w := &memWriter{}
+	e := NewEncoder(w, 1000, 32, 1, 1)
+	e.ValidBitsPerSample = 24
+	e.EnableSilenceMarkers(-60, 0)
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 1000}, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(w.buf))
+	d.ReadMetadata()
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Metadata != nil && len(d.Metadata.CuePoints) > 0 {
+		t.Fatalf("expected no silence marker, got one at %d", d.Metadata.CuePoints[0].Position)
+	}
+}
+
+func TestEncoderSilenceMarkersFloat(t *testing.T) {
+	// loud, silent and loud sections of 100 frames
+	var data []float64
+	left := make([]float64, 300)
+	right := make([]float64, 300)
+	for i := range left {
+		v := 0.0001
+		if i < 100 || i >= 200 {
+			v = 0.5 * float64(1-2*(i%2))
+		}
+		left[i], right[i] = v, -v
+		data = append(data, v, -v)
+	}
+	format := &audio.Format{NumChannels: 2, SampleRate: 1000}
+
+	testCases := []struct {
+		desc  string
+		write func(e *Encoder) error
+	}{
+		{"WriteFloat", func(e *Encoder) error {
+			return e.WriteFloat(&audio.FloatBuffer{Format: format, Data: data})
+		}},
+		{"WriteFloatPlanar", func(e *Encoder) error {
+			return e.WriteFloatPlanar([][]float64{left, right})
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 1000, 32, 2, 3)
+			e.EnableSilenceMarkers(-60, 50*time.Millisecond)
+			if err := tc.write(e); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			d := NewDecoder(bytes.NewReader(w.buf))
+			d.ReadMetadata()
+			if err := d.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if d.Metadata == nil || len(d.Metadata.CuePoints) != 1 {
+				t.Fatalf("expected 1 cue point, got %#v", d.Metadata)
+			}
+			if pos := d.Metadata.CuePoints[0].Position; pos != 100 {
+				t.Fatalf("expected the cue point at 100, got %d", pos)
+			}
+		})
+	}
+}
+
+func TestEncoderTrimTrailingSilence(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		data      []int
+		expFrames int
+	}{
+		// the last loud frame is the 3rd one, the noise floor stays below
+		// the threshold
+		{"silent tail", []int{1000, -1000, 0, 0, 5, -1000, 3, -2, 0, 1, 0, 0}, 3},
+		{"no silence", []int{0, 0, 1000, 1000}, 2},
+		{"only silence", []int{0, 1, -1, 0}, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 1000, 16, 2, 1)
+			e.TrimTrailingSilence(-60)
+			e.EnableSilenceMarkers(-60, 0)
+			// split the writes so the tail spans several buffers
+			for i := 0; i < len(tc.data); i += 4 {
+				end := i + 4
+				if end > len(tc.data) {
+					end = len(tc.data)
+				}
+				buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 1000}, Data: tc.data[i:end]}
+				if err := e.Write(buf); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDecoder(bytes.NewReader(w.buf))
+			nBuf, err := d.FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nBuf.NumFrames() != tc.expFrames {
+				t.Fatalf("expected %d frames, got %d", tc.expFrames, nBuf.NumFrames())
+			}
+			d = NewDecoder(bytes.NewReader(w.buf))
+			d.ReadMetadata()
+			if d.Metadata != nil {
+				for _, c := range d.Metadata.CuePoints {
+					if int(c.Position) >= tc.expFrames {
+						t.Fatalf("expected the markers of the trimmed silence to be dropped, got one at %d", c.Position)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderTrimTrailingSilenceFloat(t *testing.T) {
+	w := &memWriter{}
+	e := NewEncoder(w, 1000, 32, 1, 3)
+	e.TrimTrailingSilence(-60)
+	buf := &audio.FloatBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 1000}, Data: []float64{0.5, -0.5, 0.0001, 0}}
+	if err := e.WriteFloat(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecoder(bytes.NewReader(w.buf))
+	if err := d.FwdToPCM(); err != nil {
+		t.Fatal(err)
+	}
+	if d.PCMSize != 8 {
+		t.Fatalf("expected 2 frames of 4 bytes, got a data chunk of %d bytes", d.PCMSize)
+	}
+}
+
+func TestEncoderTrimTrailingSilenceUnanalyzed(t *testing.T) {
+	const frames = 1000
+	loud := make([]int, frames)
+	raw := make([]byte, 2*frames)
+	samples := make([]int16, frames)
+	for i := range loud {
+		loud[i] = 10000 * (1 - 2*(i%2))
+		samples[i] = int16(loud[i])
+		raw[2*i] = byte(samples[i])
+		raw[2*i+1] = byte(uint16(samples[i]) >> 8)
+	}
+	newBuffer := func() *audio.IntBuffer {
+		return &audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 1000}, Data: loud}
+	}
+
+	testCases := []struct {
+		desc      string
+		write     func(e *Encoder) error
+		expFrames int
+	}{
+		{"WriteRaw", func(e *Encoder) error {
+			_, err := e.WriteRaw(raw)
+			return err
+		}, frames},
+		{"WriteFrames", func(e *Encoder) error {
+			return e.WriteFrames(samples)
+		}, frames},
+		{"WriteFrame", func(e *Encoder) error {
+			for _, s := range samples {
+				if err := e.WriteFrame(s); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, frames},
+		{"WriteAt extending", func(e *Encoder) error {
+			if err := e.Write(newBuffer()); err != nil {
+				return err
+			}
+			_, err := e.WriteAt(newBuffer(), 2*frames)
+			return err
+		}, 2 * frames},
+		{"silent Write after WriteRaw", func(e *Encoder) error {
+			if _, err := e.WriteRaw(raw); err != nil {
+				return err
+			}
+			return e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 1, SampleRate: 1000}, Data: make([]int, 10)})
+		}, frames},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			e := NewEncoder(w, 1000, 16, 1, 1)
+			e.TrimTrailingSilence(-60)
+			if err := tc.write(e); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nBuf.NumFrames() != tc.expFrames {
+				t.Fatalf("expected %d frames, got %d", tc.expFrames, nBuf.NumFrames())
+			}
+		})
+	}
+}
+
+func TestEncoderTrimTrailingSilenceSparse(t *testing.T) {
+	format := &audio.Format{NumChannels: 1, SampleRate: 1000}
+	region := func(v, frames int) *audio.IntBuffer {
+		data := make([]int, frames)
+		for i := range data {
+			data[i] = v * (1 - 2*(i%2))
+		}
+		return &audio.IntBuffer{Format: format, Data: data}
+	}
+	w := &memWriter{}
+	e := NewEncoder(w, 1000, 16, 1, 1)
+	e.TrimTrailingSilence(-60)
+	// the loud region written last sits before a silent one written earlier,
+	// followed by a gap filled with silence and a quiet tail
+	for _, r := range []struct {
+		buf   *audio.IntBuffer
+		frame int64
+	}{
+		{region(0, 100), 400},
+		{region(10000, 100), 100},
+		{region(1, 50), 800},
+		{region(10000, 100), 200},
+	} {
+		if _, err := e.WriteAt(r.buf, 2*r.frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	nBuf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nBuf.NumFrames() != 300 {
+		t.Fatalf("expected 300 frames, got %d", nBuf.NumFrames())
+	}
+}
@@ -0,0 +1,133 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/riff"
+)
+
+// sizeRecordSize is the size of the fsiz chunk data: the RIFF size, the data
+// chunk size and the number of frames as 64 bit values.
+const sizeRecordSize = 8 + 8 + 8
+
+// writeSizeRecord appends the fsiz chunk holding the true sizes of the file,
+// see TrailingSizeRecord.
+func (e *Encoder) writeSizeRecord(dataSize int64) error {
+	record := make([]byte, sizeRecordSize)
+	// the RIFF size accounts for the record itself
+	binary.LittleEndian.PutUint64(record, uint64(e.WrittenBytes+8+sizeRecordSize-8))
+	binary.LittleEndian.PutUint64(record[8:], uint64(dataSize))
+	binary.LittleEndian.PutUint64(record[16:], uint64(e.frames))
+	return e.writeChunk(CIDFsiz, record)
+}
+
+// Normalize finalizes a file written with Encoder.TrailingSizeRecord: the RIFF
+// and data chunk sizes of the header are patched from the fsiz chunk ending
+// the file. The file is written in two phases, the append only recording
+// followed, once random access is available, by:
+//
+//	f, err := os.OpenFile(path, os.O_RDWR, 0)
+//	...
+//	err = wav.Normalize(f)
+//
+// The fsiz chunk is left in place, readers skip it like any unknown chunk,
+// so normalizing a file twice is harmless. The passed writer also needs to
+// implement io.Reader so the header and the record can be read. Files too
+// large for the 32 bit RIFF sizes are refused with ErrSizeOverflow.
+func Normalize(f WriterAtSeeker) error {
+	r, ok := f.(io.Reader)
+	if !ok {
+		return errors.New("can't normalize a file that can't be read")
+	}
+	fileSize, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if fileSize < 12+8+sizeRecordSize {
+		return errors.New("the file is too short to end with a size record")
+	}
+	if _, err := f.Seek(fileSize-8-sizeRecordSize, io.SeekStart); err != nil {
+		return err
+	}
+	var record struct {
+		ID       [4]byte
+		Size     uint32
+		RIFFSize uint64
+		DataSize uint64
+		Frames   uint64
+	}
+	if err := binary.Read(r, binary.LittleEndian, &record); err != nil {
+		return fmt.Errorf("failed to read the size record - %w", err)
+	}
+	if record.ID != CIDFsiz || record.Size != sizeRecordSize {
+		return errors.New("the file doesn't end with a size record")
+	}
+	if int64(record.RIFFSize)+8 != fileSize {
+		return fmt.Errorf("the size record describes %d bytes but the file has %d", record.RIFFSize+8, fileSize)
+	}
+	riffSize, err := checkedSize(int64(record.RIFFSize), "RIFF size")
+	if err != nil {
+		return err
+	}
+	dataSize, err := checkedSize(int64(record.DataSize), "data chunk size")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var header struct {
+		ID     [4]byte
+		Size   uint32
+		Format [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("failed to read the RIFF header - %w", err)
+	}
+	if header.ID != riff.RiffID {
+		return fmt.Errorf("%s - %s", header.ID, riff.ErrFmtNotSupported)
+	}
+	// the chunks preceding the data chunk have their true sizes
+	pos := int64(12)
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return ErrPCMChunkNotFound
+			}
+			return err
+		}
+		pos += 8
+		if chunk.ID == riff.DataFormatID {
+			break
+		}
+		pos += int64(chunk.Size) + int64(chunk.Size%2)
+		if _, err := f.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	// the data chunk, padded if its size is odd, ends before the trailing
+	// chunks
+	if end := pos + int64(dataSize) + int64(dataSize%2); end > fileSize-8-sizeRecordSize {
+		return fmt.Errorf("the data chunk of %d bytes overlaps the size record", dataSize)
+	}
+
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, riffSize)
+	if _, err := f.WriteAt(b, 4); err != nil {
+		return fmt.Errorf("failed to patch the RIFF size - %w", err)
+	}
+	binary.LittleEndian.PutUint32(b, dataSize)
+	if _, err := f.WriteAt(b, pos-4); err != nil {
+		return fmt.Errorf("failed to patch the data chunk size - %w", err)
+	}
+	return nil
+}
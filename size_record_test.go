@@ -0,0 +1,120 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-audio/audio"
+)
+
+// appendOnlyWriter is a memWriter refusing to seek or patch.
+type appendOnlyWriter struct {
+	memWriter
+}
+
+var errAppendOnly = errors.New("append only")
+
+func (w *appendOnlyWriter) WriteAt(p []byte, off int64) (int, error) {
+	return 0, errAppendOnly
+}
+
+func (w *appendOnlyWriter) Seek(offset int64, whence int) (int64, error) {
+	return 0, errAppendOnly
+}
+
+func TestEncoderTrailingSizeRecord(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 202)}
+	for i := range buf.Data {
+		buf.Data[i] = i - 100
+	}
+
+	// the append phase
+	w := &appendOnlyWriter{}
+	e := NewEncoder(w, 44100, 16, 2, FormatPCM)
+	e.TrailingSizeRecord = true
+	e.EnableLiveHeaderUpdates(time.Millisecond)
+	e.Metadata = &Metadata{Title: "take"}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := w.buf
+	if binary.LittleEndian.Uint32(b[4:]) != StreamingDataSize || binary.LittleEndian.Uint32(b[40:]) != StreamingDataSize {
+		t.Fatal("expected the header to keep the streaming sizes")
+	}
+	record := b[len(b)-8-sizeRecordSize:]
+	if string(record[:4]) != "fsiz" || binary.LittleEndian.Uint32(record[4:]) != sizeRecordSize {
+		t.Fatalf("expected the file to end with the size record, got %q", record[:8])
+	}
+	for i, exp := range []uint64{uint64(len(b) - 8), 101 * 4, 101} {
+		if got := binary.LittleEndian.Uint64(record[8+i*8:]); got != exp {
+			t.Fatalf("expected the value %d of the record to be %d, got %d", i, exp, got)
+		}
+	}
+
+	// the normalization phase
+	if err := ioutil.WriteFile("testOutput/fsiz.wav", b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("testOutput/fsiz.wav")
+	f, err := os.OpenFile("testOutput/fsiz.wav", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// normalizing twice is harmless
+	for i := 0; i < 2; i++ {
+		if err := Normalize(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	normalized, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint32(normalized[4:]); int(size) != len(b)-8 {
+		t.Fatalf("expected the RIFF size %d, got %d", len(b)-8, size)
+	}
+	if size := binary.LittleEndian.Uint32(normalized[40:]); size != 101*4 {
+		t.Fatalf("expected the data chunk size %d, got %d", 101*4, size)
+	}
+	d := NewDecoder(bytes.NewReader(normalized))
+	decoded, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Data, buf.Data) {
+		t.Fatal("expected the audio to be decoded unaltered")
+	}
+	d.ReadMetadata()
+	if d.Metadata == nil || d.Metadata.Title != "take" {
+		t.Fatalf("expected the metadata to be decoded, got %#v", d.Metadata)
+	}
+
+	// a regular file has no record
+	regular, err := os.Create("testOutput/no-fsiz.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(regular.Name())
+	defer regular.Close()
+	e = NewEncoder(regular, 44100, 16, 2, FormatPCM)
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Normalize(regular); err == nil {
+		t.Fatal("expected a file without a size record to be refused")
+	}
+}
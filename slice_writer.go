@@ -0,0 +1,75 @@
+package wav
+
+import (
+	"errors"
+	"io"
+)
+
+// SliceWriter is a WriterAtSeeker writing into a fixed size byte slice, for
+// instance a memory mapped region of a file pre-sized to the expected output
+// size. Writes past the end of the slice fail with io.ErrShortWrite, the
+// slice never grows.
+//
+// The Encoder doesn't assume the writer grows: Close patches the sizes in
+// place and leaves the cursor at the end of the written data, reported by
+// Len, which the file should be truncated to once unmapped.
+type SliceWriter struct {
+	buf []byte
+	pos int64
+	len int64
+}
+
+// NewSliceWriter creates a writer writing into buf from its start.
+func NewSliceWriter(buf []byte) *SliceWriter {
+	return &SliceWriter{buf: buf}
+}
+
+// Write writes p at the current position.
+func (w *SliceWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteAt(p, w.pos)
+	w.pos += int64(n)
+	return n, err
+}
+
+// WriteAt writes p at the passed offset without moving the cursor.
+func (w *SliceWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off > int64(len(w.buf)) {
+		return 0, io.ErrShortWrite
+	}
+	n := copy(w.buf[off:], p)
+	if end := off + int64(n); end > w.len {
+		w.len = end
+	}
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+// Seek moves the cursor, it can't be moved past the end of the slice.
+func (w *SliceWriter) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = w.pos + offset
+	case io.SeekEnd:
+		pos = int64(len(w.buf)) + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 || pos > int64(len(w.buf)) {
+		return 0, errors.New("seek out of range")
+	}
+	w.pos = pos
+	return pos, nil
+}
+
+// Len returns the offset of the end of the written data.
+func (w *SliceWriter) Len() int64 {
+	return w.len
+}
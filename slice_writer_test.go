@@ -0,0 +1,59 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestSliceWriter(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 8000}, Data: make([]int, 100)}
+	for i := range buf.Data {
+		buf.Data[i] = i
+	}
+
+	// the region is larger than the output, like a file pre-sized to an
+	// estimate
+	region := make([]byte, 1024)
+	w := NewSliceWriter(region)
+	e := NewEncoder(w, 8000, 16, 2, 1)
+	e.Metadata = &Metadata{Title: "mapped"}
+	if err := e.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Len() != int64(e.WrittenBytes) {
+		t.Fatalf("expected %d bytes to be written, got %d", e.WrittenBytes, w.Len())
+	}
+	if pos, _ := w.Seek(0, io.SeekCurrent); pos != w.Len() {
+		t.Fatalf("expected the cursor to be at the end of the written data (%d), got %d", w.Len(), pos)
+	}
+	if size := binary.LittleEndian.Uint32(region[4:]); int64(size) != w.Len()-8 {
+		t.Fatalf("expected the RIFF size to be %d, got %d", w.Len()-8, size)
+	}
+	d := NewDecoder(bytes.NewReader(region[:w.Len()]))
+	nBuf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nBuf.Data) != len(buf.Data) || nBuf.Data[99] != 99 {
+		t.Fatalf("unexpected decoded data %v", nBuf.Data)
+	}
+	d.ReadMetadata()
+	if d.Metadata == nil || d.Metadata.Title != "mapped" {
+		t.Fatalf("expected the metadata to be decoded, got %#v", d.Metadata)
+	}
+
+	// a region too small fails instead of growing
+	e = NewEncoder(NewSliceWriter(make([]byte, 100)), 8000, 16, 2, 1)
+	if err := e.Write(buf); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("expected io.ErrShortWrite, got %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package wav
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// SpeakerLayout is the channel mask of a WAVE_FORMAT_EXTENSIBLE fmt chunk,
+// each bit assigning a channel to a speaker position in the order of the
+// channels.
+type SpeakerLayout uint32
+
+// Speaker positions of a channel mask.
+const (
+	SpeakerFrontLeft SpeakerLayout = 1 << iota
+	SpeakerFrontRight
+	SpeakerFrontCenter
+	SpeakerLowFrequency
+	SpeakerBackLeft
+	SpeakerBackRight
+	SpeakerFrontLeftOfCenter
+	SpeakerFrontRightOfCenter
+	SpeakerBackCenter
+	SpeakerSideLeft
+	SpeakerSideRight
+)
+
+// Common speaker layouts.
+const (
+	LayoutMono          = SpeakerFrontCenter
+	LayoutStereo        = SpeakerFrontLeft | SpeakerFrontRight
+	LayoutQuad          = SpeakerFrontLeft | SpeakerFrontRight | SpeakerBackLeft | SpeakerBackRight
+	LayoutFivePointOne  = SpeakerFrontLeft | SpeakerFrontRight | SpeakerFrontCenter | SpeakerLowFrequency | SpeakerBackLeft | SpeakerBackRight
+	LayoutSevenPointOne = LayoutFivePointOne | SpeakerSideLeft | SpeakerSideRight
+)
+
+// NumChannels returns the number of channels of the layout.
+func (l SpeakerLayout) NumChannels() int {
+	return bits.OnesCount32(uint32(l))
+}
+
+// SetChannelLayout sets the speaker layout written in the channel mask of the
+// fmt chunk, which makes it WAVE_FORMAT_EXTENSIBLE. NumChans is set to the
+// number of channels of the layout if it is 0, otherwise they must match. It
+// must be called before writing.
+func (e *Encoder) SetChannelLayout(layout SpeakerLayout) error {
+	if layout == 0 {
+		return fmt.Errorf("empty speaker layout")
+	}
+	if e.NumChans == 0 {
+		e.NumChans = layout.NumChannels()
+	}
+	if n := layout.NumChannels(); n != e.NumChans {
+		return fmt.Errorf("the speaker layout has %d channels but the encoder has %d", n, e.NumChans)
+	}
+	e.channelMask = layout
+	return nil
+}
@@ -0,0 +1,72 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderSetChannelLayout(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		layout   SpeakerLayout
+		numChans int
+		mask     uint32
+	}{
+		{"mono", LayoutMono, 1, 0x4},
+		{"stereo", LayoutStereo, 2, 0x3},
+		{"quad", LayoutQuad, 4, 0x33},
+		{"5.1", LayoutFivePointOne, 6, 0x3F},
+		{"7.1", LayoutSevenPointOne, 8, 0x63F},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			w := &memWriter{}
+			// the number of channels is set by the layout
+			e := NewEncoder(w, 48000, 16, 0, FormatPCM)
+			e.Strict = true
+			if err := e.SetChannelLayout(tc.layout); err != nil {
+				t.Fatal(err)
+			}
+			if e.NumChans != tc.numChans {
+				t.Fatalf("expected %d channels, got %d", tc.numChans, e.NumChans)
+			}
+			buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: tc.numChans, SampleRate: 48000}, Data: make([]int, tc.numChans*4)}
+			if err := e.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if format := binary.LittleEndian.Uint16(w.buf[20:]); format != FormatExtensible {
+				t.Fatalf("expected an extensible fmt chunk, got the format %#x", format)
+			}
+			if mask := binary.LittleEndian.Uint32(w.buf[40:]); mask != tc.mask {
+				t.Fatalf("expected the channel mask %#x, got %#x", tc.mask, mask)
+			}
+			d := NewDecoder(bytes.NewReader(w.buf))
+			if _, err := d.FullPCMBuffer(); err != nil {
+				t.Fatal(err)
+			}
+			if d.NumChans != uint16(tc.numChans) {
+				t.Fatalf("expected %d decoded channels, got %d", tc.numChans, d.NumChans)
+			}
+		})
+	}
+
+	e := NewEncoder(&memWriter{}, 48000, 16, 2, FormatPCM)
+	if err := e.SetChannelLayout(LayoutFivePointOne); err == nil {
+		t.Fatal("expected an error when the layout doesn't match the number of channels")
+	}
+
+	// without a layout, surround isn't strictly conformant
+	e = NewEncoder(&memWriter{}, 48000, 16, 6, FormatPCM)
+	e.Strict = true
+	if err := e.WriteFrame(int16(0)); !errors.Is(err, ErrNonConformant) {
+		t.Fatalf("expected ErrNonConformant, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package wav
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-audio/audio"
+)
+
+// SplitEncoder encodes LPCM data into a set of wav files, rolling over to a
+// new file whenever the current one would grow beyond MaxBytes. Parts are
+// split on frame boundaries and each one is an independently valid wav file.
+// This is useful for targets with a file size limit such as FAT32.
+type SplitEncoder struct {
+	// Pattern is the fmt pattern used to name the parts, it receives the part
+	// number starting at 1. For example: "recording-%03d.wav".
+	Pattern string
+	// MaxBytes is the maximum size in bytes of each part, headers included.
+	MaxBytes int64
+
+	SampleRate     int
+	BitDepth       int
+	NumChans       int
+	WavAudioFormat int
+
+	files      []string
+	f          *os.File
+	enc        *Encoder
+	partFrames int
+}
+
+// NewSplitEncoder creates a new encoder writing a multi-file set of wav files
+// named after pattern, each file being at most maxBytes long.
+func NewSplitEncoder(pattern string, maxBytes int64, sampleRate, bitDepth, numChans, audioFormat int) *SplitEncoder {
+	return &SplitEncoder{
+		Pattern:        pattern,
+		MaxBytes:       maxBytes,
+		SampleRate:     sampleRate,
+		BitDepth:       bitDepth,
+		NumChans:       numChans,
+		WavAudioFormat: audioFormat,
+	}
+}
+
+// Files returns the names of the parts created so far.
+func (e *SplitEncoder) Files() []string {
+	return e.files
+}
+
+// Write encodes and writes the passed buffer, starting new parts as needed.
+func (e *SplitEncoder) Write(buf *audio.IntBuffer) error {
+	if buf == nil {
+		return fmt.Errorf("can't add a nil buffer")
+	}
+	if e.NumChans < 1 {
+		return fmt.Errorf("invalid number of channels %d", e.NumChans)
+	}
+	for data := buf.Data; len(data) > 0; {
+		if e.enc == nil || e.partFrames == 0 {
+			if err := e.nextPart(); err != nil {
+				return err
+			}
+		}
+		n := e.partFrames * e.NumChans
+		if n > len(data) {
+			n = len(data)
+		}
+		part := &audio.IntBuffer{Format: buf.Format, Data: data[:n], SourceBitDepth: buf.SourceBitDepth}
+		if err := e.enc.Write(part); err != nil {
+			return err
+		}
+		e.partFrames -= n / e.NumChans
+		data = data[n:]
+	}
+	return nil
+}
+
+// nextPart finalizes the current part and opens the next one.
+func (e *SplitEncoder) nextPart() error {
+	if err := e.closePart(); err != nil {
+		return err
+	}
+	blockAlign := int64(e.NumChans * e.BitDepth / 8)
+	if blockAlign == 0 {
+		return fmt.Errorf("can't split frames of bit size %d", e.BitDepth)
+	}
+	name := fmt.Sprintf(e.Pattern, len(e.files)+1)
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create part %s - %w", name, err)
+	}
+	enc := NewEncoder(f, e.SampleRate, e.BitDepth, e.NumChans, e.WavAudioFormat)
+	var partFrames int
+	if err = enc.writeSetup(); err == nil {
+		partFrames = int((e.MaxBytes - enc.pcmChunkPos) / blockAlign)
+		if partFrames < 1 {
+			err = errors.New("max bytes too small to hold a single frame")
+		}
+	}
+	if err != nil {
+		// the part can't hold any audio, it's discarded
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	e.f = f
+	e.enc = enc
+	e.partFrames = partFrames
+	e.files = append(e.files, name)
+	return nil
+}
+
+func (e *SplitEncoder) closePart() error {
+	if e.enc == nil {
+		return nil
+	}
+	// the file is closed even if the encoder fails to finalize it
+	err := e.enc.Close()
+	if fErr := e.f.Close(); err == nil {
+		err = fErr
+	}
+	e.enc = nil
+	e.f = nil
+	return err
+}
+
+// Close finalizes the last part and closes its file.
+func (e *SplitEncoder) Close() error {
+	return e.closePart()
+}
@@ -0,0 +1,88 @@
+package wav
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestSplitEncoder(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	format := &audio.Format{NumChannels: 2, SampleRate: 44100}
+	buf := &audio.IntBuffer{Format: format, Data: make([]int, 2*1000), SourceBitDepth: 16}
+	for i := range buf.Data {
+		buf.Data[i] = i % 3000
+	}
+
+	const maxBytes = 1044
+	e := NewSplitEncoder("testOutput/split-%02d.wav", maxBytes, 44100, 16, 2, 1)
+	// write in uneven slices to make sure parts are split on frame boundaries
+	for _, r := range [][2]int{{0, 302}, {302, 1500}, {1500, 2000}} {
+		part := &audio.IntBuffer{Format: format, Data: buf.Data[r[0]:r[1]], SourceBitDepth: 16}
+		if err := e.Write(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.Files()) != 4 {
+		t.Fatalf("expected 4 parts, got %d", len(e.Files()))
+	}
+	var data []int
+	for _, name := range e.Files() {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() > maxBytes {
+			t.Errorf("expected %s to be at most %d bytes, got %d", name, maxBytes, fi.Size())
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewDecoder(f)
+		if !d.IsValidFile() {
+			t.Fatalf("expected %s to be a valid file", name)
+		}
+		d.Rewind()
+		pBuf, err := d.FullPCMBuffer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, pBuf.Data...)
+		f.Close()
+		os.Remove(name)
+	}
+	if len(data) != len(buf.Data) {
+		t.Fatalf("expected %d samples, got %d", len(buf.Data), len(data))
+	}
+	for i := range data {
+		if data[i] != buf.Data[i] {
+			t.Fatalf("sample %d: expected %d, got %d", i, buf.Data[i], data[i])
+		}
+	}
+}
+
+func TestSplitEncoderMaxBytesTooSmall(t *testing.T) {
+	os.Mkdir("testOutput", 0777)
+	const pattern = "testOutput/split-small-%02d.wav"
+	e := NewSplitEncoder(pattern, 40, 44100, 16, 2, 1)
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: make([]int, 20)}
+	if err := e.Write(buf); err == nil {
+		t.Fatal("expected an error when a part can't hold a single frame")
+	}
+	if len(e.Files()) != 0 {
+		t.Fatalf("expected the failed part to not be listed, got %v", e.Files())
+	}
+	if _, err := os.Stat(fmt.Sprintf(pattern, 1)); !os.IsNotExist(err) {
+		t.Fatalf("expected the failed part to be removed, got %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
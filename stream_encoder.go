@@ -0,0 +1,175 @@
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-audio/audio"
+)
+
+// StreamingDataSize is the RIFF and data chunk size written by a StreamEncoder
+// when the length of the audio isn't known. Following the streaming
+// convention, readers interpret it as "read until EOF", while a size of 0
+// makes many players stop immediately.
+const StreamingDataSize = sizePlaceholder
+
+// StreamEncoder writes a wav file to a writer which can't seek, such as a pipe
+// or a network connection. Since the header can't be patched once the audio
+// is written, the header sizes are StreamingDataSize unless DataSize is set.
+// The audio is passed to the writer in whole blocks of the fmt chunk block
+// align, the bytes of a trailing partial block, which BufferWrites produces,
+// being held until the next write, so consumers parsing the stream on the fly
+// never get a split frame.
+type StreamEncoder struct {
+	// DataSize overrides the data chunk size written in the header when the
+	// size of the audio is known upfront, the RIFF size being derived from
+	// it. StreamingDataSize is used when it is 0. It must be set before
+	// writing.
+	DataSize uint32
+
+	e *Encoder
+	w *streamWriter
+}
+
+// NewStreamEncoder creates an encoder writing a wav file to w without ever
+// seeking.
+func NewStreamEncoder(w io.Writer, sampleRate, bitDepth, numChans, audioFormat int) *StreamEncoder {
+	sw := &streamWriter{w: w}
+	return &StreamEncoder{
+		e: NewEncoder(sw, sampleRate, bitDepth, numChans, audioFormat),
+		w: sw,
+	}
+}
+
+// Encoder returns the encoder serializing the audio, to set its options such
+// as RoundingMode before writing. Its methods seeking or patching the file,
+// like WriteAt or Close, fail with ErrWriterNotSeekable.
+func (s *StreamEncoder) Encoder() *Encoder {
+	return s.e
+}
+
+// Write encodes and writes the passed buffer, see Encoder.Write.
+func (s *StreamEncoder) Write(buf *audio.IntBuffer) error {
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	return s.e.Write(buf)
+}
+
+// WriteFloat encodes and writes the passed float buffer, see
+// Encoder.WriteFloat.
+func (s *StreamEncoder) WriteFloat(buf *audio.FloatBuffer) error {
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	return s.e.WriteFloat(buf)
+}
+
+// Close writes the header if no audio was written, so the output is always a
+// valid wav file, and flushes the writes buffered because of BufferWrites
+// along with any partial block held. It doesn't close the underlying writer.
+func (s *StreamEncoder) Close() error {
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	if err := s.e.flush(); err != nil {
+		return err
+	}
+	return s.w.flush()
+}
+
+// writeHeader writes the header up to the data chunk with the streaming sizes
+// or the ones derived from DataSize, then lets the encoder append the audio.
+func (s *StreamEncoder) writeHeader() error {
+	if s.e.pcmChunkStarted {
+		return nil
+	}
+	// the header is built by a copy of the encoder so its options apply
+	hw := NewSliceWriter(make([]byte, 256+s.e.dataAlign))
+	he := s.e.Clone(hw)
+	he.BufferWrites = false
+	if err := he.writeSetup(); err != nil {
+		return err
+	}
+	header := hw.buf[:hw.Len()]
+	if s.DataSize != 0 {
+		binary.LittleEndian.PutUint32(header[len(header)-4:], s.DataSize)
+		riffSize := int64(len(header)) - 8 + int64(s.DataSize) + int64(s.DataSize%2)
+		if riffSize > int64(sizePlaceholder) {
+			riffSize = int64(sizePlaceholder)
+		}
+		binary.LittleEndian.PutUint32(header[4:], uint32(riffSize))
+	}
+	if _, err := s.w.Write(header); err != nil {
+		return s.e.writeError("header", 0, err)
+	}
+	s.e.WrittenBytes = len(header)
+	s.e.pcmChunkStarted = true
+	s.e.dataHeaderWritten = true
+	s.e.pcmChunkSizePos = len(header) - 4
+	s.e.pcmChunkPos = int64(len(header))
+	s.w.blockAlign = int(s.e.headerBlockAlign())
+	return nil
+}
+
+// streamWriter adapts an io.Writer to a WriterAtSeeker which can only report
+// its position, which is all the encoder needs to append audio.
+type streamWriter struct {
+	w   io.Writer
+	pos int64
+	// blockAlign is set once the header is written, the audio is then
+	// passed to w in whole blocks, pending holding a trailing partial block.
+	blockAlign int
+	pending    []byte
+}
+
+var errStreamSeek = errors.New("can't seek a stream")
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	if sw.blockAlign <= 1 {
+		n, err := sw.w.Write(p)
+		sw.pos += int64(n)
+		return n, err
+	}
+	held := len(sw.pending)
+	buf := append(sw.pending, p...)
+	whole := len(buf) - len(buf)%sw.blockAlign
+	if whole > 0 {
+		if n, err := sw.w.Write(buf[:whole]); err != nil {
+			// the held bytes are considered written first
+			n -= held
+			if n < 0 {
+				n = 0
+			}
+			sw.pending = nil
+			sw.pos += int64(n)
+			return n, err
+		}
+	}
+	sw.pending = append(buf[:0], buf[whole:]...)
+	sw.pos += int64(len(p))
+	return len(p), nil
+}
+
+// flush writes the partial block held, if any.
+func (sw *streamWriter) flush() error {
+	if len(sw.pending) == 0 {
+		return nil
+	}
+	_, err := sw.w.Write(sw.pending)
+	sw.pending = sw.pending[:0]
+	return err
+}
+
+func (sw *streamWriter) WriteAt(p []byte, off int64) (int, error) {
+	return 0, fmt.Errorf("%w: %v", ErrWriterNotSeekable, errStreamSeek)
+}
+
+func (sw *streamWriter) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekCurrent && offset == 0 || whence == io.SeekStart && offset == sw.pos {
+		return sw.pos, nil
+	}
+	return 0, fmt.Errorf("%w: %v", ErrWriterNotSeekable, errStreamSeek)
+}
@@ -0,0 +1,121 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestStreamEncoder(t *testing.T) {
+	buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{1, -1, 2, -2, 3, -3}}
+
+	testCases := []struct {
+		desc        string
+		dataSize    uint32
+		expRIFFSize uint32
+		expDataSize uint32
+	}{
+		{"streaming convention", 0, 0xFFFFFFFF, 0xFFFFFFFF},
+		{"known size", 12, 36 + 12, 12},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// out is a plain io.Writer, it can't seek
+			var out bytes.Buffer
+			s := NewStreamEncoder(struct{ io.Writer }{&out}, 44100, 16, 2, FormatPCM)
+			s.DataSize = tc.dataSize
+			if err := s.Write(buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			b := out.Bytes()
+			if len(b) != 44+12 {
+				t.Fatalf("expected %d bytes, got %d", 44+12, len(b))
+			}
+			if !bytes.Equal(b[36:40], []byte("data")) {
+				t.Fatalf("expected the data chunk at 36, got %q", b[36:40])
+			}
+			if size := binary.LittleEndian.Uint32(b[4:]); size != tc.expRIFFSize {
+				t.Fatalf("expected the RIFF size %#x, got %#x", tc.expRIFFSize, size)
+			}
+			if size := binary.LittleEndian.Uint32(b[40:]); size != tc.expDataSize {
+				t.Fatalf("expected the data chunk size %#x, got %#x", tc.expDataSize, size)
+			}
+			nBuf, err := NewDecoder(bytes.NewReader(b)).FullPCMBuffer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(nBuf.Data, buf.Data) {
+				t.Fatalf("expected %v, got %v", buf.Data, nBuf.Data)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	s := NewStreamEncoder(&out, 44100, 16, 2, FormatPCM)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 44 {
+		t.Fatalf("expected an empty stream to get a header, got %d bytes", out.Len())
+	}
+	if _, err := s.Encoder().WriteAt(buf, 0); !errors.Is(err, ErrWriterNotSeekable) {
+		t.Fatalf("expected ErrWriterNotSeekable, got %v", err)
+	}
+}
+
+// writesRecorder records the size of each write.
+type writesRecorder struct {
+	bytes.Buffer
+	sizes []int
+}
+
+func (w *writesRecorder) Write(p []byte) (int, error) {
+	w.sizes = append(w.sizes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestStreamEncoderBlockAligned(t *testing.T) {
+	const numChans, bitDepth = 2, 24
+	out := &writesRecorder{}
+	s := NewStreamEncoder(out, 48000, bitDepth, numChans, FormatPCM)
+	// the 4096 bytes buffer doesn't hold whole frames of 6 bytes
+	s.Encoder().BufferWrites = true
+	var exp []int
+	for i, frames := range []int{1, 7, 333, 1000, 2, 1501} {
+		buf := &audio.IntBuffer{Format: &audio.Format{NumChannels: numChans, SampleRate: 48000}, Data: make([]int, frames*numChans)}
+		for j := range buf.Data {
+			buf.Data[j] = i*10000 + j
+		}
+		exp = append(exp, buf.Data...)
+		if err := s.Write(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first write is the header
+	blockAlign := numChans * bitDepth / 8
+	for i, size := range out.sizes[1:] {
+		if size%blockAlign != 0 {
+			t.Fatalf("expected write %d of the audio to be whole blocks of %d bytes, got %d bytes", i, blockAlign, size)
+		}
+	}
+	nBuf, err := NewDecoder(bytes.NewReader(out.Bytes())).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nBuf.Data, exp) {
+		t.Fatal("expected the audio to be streamed unaltered")
+	}
+}
@@ -0,0 +1,85 @@
+package wav
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SetBextTimecode sets the TimeReference of the bext chunk, creating the
+// chunk if needed, to the position of the passed SMPTE timecode counted in
+// frames of the encoder sample rate since midnight. The timecode is formatted
+// as HH:MM:SS:FF, or HH:MM:SS;FF for drop-frame timecode which is supported
+// at 29.97 and 59.94 fps. The NTSC rates (23.976, 29.97, 59.94) are handled
+// as their exact value, 1000/1001 of the nominal rate.
+func (e *Encoder) SetBextTimecode(tc string, fps float64) error {
+	if e.SampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate %d", e.SampleRate)
+	}
+	ref, err := timecodeToSamples(tc, fps, e.SampleRate)
+	if err != nil {
+		return err
+	}
+	m := e.metadata()
+	if m.Bext == nil {
+		m.Bext = &BextChunk{}
+	}
+	m.Bext.TimeReference = ref
+	return nil
+}
+
+// timecodeToSamples converts a timecode to a number of samples at the passed
+// sample rate, rounded to the nearest sample.
+func timecodeToSamples(tc string, fps float64, sampleRate int) (uint64, error) {
+	if fps <= 0 || math.IsNaN(fps) || math.IsInf(fps, 0) {
+		return 0, fmt.Errorf("invalid frame rate %v", fps)
+	}
+	nominal := int64(math.Round(fps))
+	// the rate is num/den frames per second
+	num, den := nominal, int64(1)
+	switch ntsc := float64(nominal) * 1000 / 1001; {
+	case math.Abs(fps-float64(nominal)) < 1e-3:
+	case math.Abs(fps-ntsc) < 1e-3:
+		num, den = nominal*1000, 1001
+	default:
+		return 0, fmt.Errorf("unsupported frame rate %v", fps)
+	}
+
+	dropFrame := strings.Count(tc, ";") == 1 && strings.LastIndex(tc, ";") > strings.LastIndex(tc, ":")
+	parts := strings.Split(strings.Replace(tc, ";", ":", 1), ":")
+	if len(parts) != 4 {
+		return 0, fmt.Errorf("invalid timecode %q, expected HH:MM:SS:FF", tc)
+	}
+	var fields [4]int64
+	for i, p := range parts {
+		v, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || v < 0 || len(p) != 2 {
+			return 0, fmt.Errorf("invalid timecode %q, expected HH:MM:SS:FF", tc)
+		}
+		fields[i] = v
+	}
+	h, m, s, f := fields[0], fields[1], fields[2], fields[3]
+	if h > 23 || m > 59 || s > 59 || f >= nominal {
+		return 0, fmt.Errorf("timecode %q is out of range at %v fps", tc, fps)
+	}
+
+	frames := ((h*60+m)*60+s)*nominal + f
+	if dropFrame {
+		if den != 1001 || nominal%30 != 0 {
+			return 0, fmt.Errorf("drop-frame timecode isn't defined at %v fps", fps)
+		}
+		// the first frame numbers of each minute are skipped, except every
+		// tenth minute: 2 numbers at 29.97 fps and 4 at 59.94 fps
+		drop := nominal / 15
+		if m%10 != 0 && s == 0 && f < drop {
+			return 0, fmt.Errorf("timecode %q doesn't exist in drop-frame", tc)
+		}
+		minutes := h*60 + m
+		frames -= drop * (minutes - minutes/10)
+	}
+
+	// frames * sampleRate * den / num rounded, which fits in 64 bits since
+	// a day holds less than 6 million frames
+	return uint64((2*frames*int64(sampleRate)*den + num) / (2 * num)), nil
+}
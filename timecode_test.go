@@ -0,0 +1,74 @@
+package wav
+
+import "testing"
+
+func TestEncoderSetBextTimecode(t *testing.T) {
+	testCases := []struct {
+		tc         string
+		fps        float64
+		sampleRate int
+		exp        uint64
+	}{
+		{"00:00:00:00", 25, 48000, 0},
+		{"01:00:00:00", 25, 48000, 3600 * 48000},
+		{"10:00:00:12", 25, 48000, 36000*48000 + 12*1920},
+		{"00:00:01:12", 24, 48000, 48000 + 24000},
+		{"00:00:01:15", 30, 44100, 44100 + 22050},
+		// 23.976 fps, each frame lasting 1001/24000s
+		{"00:00:01:00", 23.976, 48000, 48048},
+		{"01:00:00:00", 23.976, 48000, 3600 * 48048},
+		// non drop-frame 29.97 runs 3.6s slow per hour, a frame lasting
+		// 1601.6 samples
+		{"01:00:00:00", 29.97, 48000, 172972800},
+		// drop-frame 29.97 matches the wall clock within a frame per day:
+		// one hour is 107892 frames
+		{"01:00:00;00", 29.97, 48000, 172800000 - 173},
+		{"00:01:00;02", 29.97, 48000, 2882880},
+		{"00:10:00;00", 29.97, 48000, 28799971},
+		{"00:01:00;04", 59.94, 48000, 2882880},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.tc, func(t *testing.T) {
+			e := NewEncoder(&memWriter{}, tc.sampleRate, 16, 2, FormatPCM)
+			if err := e.SetBextTimecode(tc.tc, tc.fps); err != nil {
+				t.Fatal(err)
+			}
+			if got := e.Metadata.Bext.TimeReference; got != tc.exp {
+				t.Fatalf("expected %d samples at %v fps, got %d", tc.exp, tc.fps, got)
+			}
+		})
+	}
+
+	for _, tc := range []struct {
+		tc  string
+		fps float64
+	}{
+		{"00:00:00", 25},
+		{"00:00:00:25", 25},
+		{"24:00:00:00", 25},
+		{"00:60:00:00", 25},
+		{"0:00:00:00", 25},
+		{"00:00:00:xx", 25},
+		{"00:00:00;00", 25},
+		{"00:01:00;01", 29.97},
+		{"00:00:00:00", 27.5},
+		{"00:00:00:00", 0},
+	} {
+		t.Run("invalid "+tc.tc, func(t *testing.T) {
+			e := NewEncoder(&memWriter{}, 48000, 16, 2, FormatPCM)
+			if err := e.SetBextTimecode(tc.tc, tc.fps); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	// the existing bext chunk is kept
+	e := NewEncoder(&memWriter{}, 48000, 16, 2, FormatPCM)
+	e.Metadata = &Metadata{Bext: &BextChunk{Description: "take"}}
+	if err := e.SetBextTimecode("00:00:01:00", 25); err != nil {
+		t.Fatal(err)
+	}
+	if e.Metadata.Bext.Description != "take" || e.Metadata.Bext.TimeReference != 48000 {
+		t.Fatalf("unexpected bext chunk %#v", e.Metadata.Bext)
+	}
+}
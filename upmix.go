@@ -0,0 +1,58 @@
+package wav
+
+import (
+	"fmt"
+
+	"github.com/go-audio/audio"
+)
+
+// upmixChannels returns whether a buffer of the passed format written with
+// UpmixMono is mono and has to be duplicated to the channels of the encoder.
+// Buffers neither mono nor matching the encoder are refused.
+func (e *Encoder) upmixChannels(format *audio.Format) (bool, error) {
+	if format == nil {
+		return false, fmt.Errorf("can't upmix a buffer without a format")
+	}
+	switch format.NumChannels {
+	case e.NumChans:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, fmt.Errorf("can't upmix %d channels to %d, only mono buffers are duplicated", format.NumChannels, e.NumChans)
+}
+
+// upmix returns the passed mono buffer with each sample duplicated to all the
+// channels of the encoder, see UpmixMono.
+func (e *Encoder) upmix(buf *audio.IntBuffer) (*audio.IntBuffer, error) {
+	mono, err := e.upmixChannels(buf.Format)
+	if err != nil || !mono {
+		return buf, err
+	}
+	format := *buf.Format
+	format.NumChannels = e.NumChans
+	data := make([]int, len(buf.Data)*e.NumChans)
+	for i, v := range buf.Data {
+		for c := 0; c < e.NumChans; c++ {
+			data[i*e.NumChans+c] = v
+		}
+	}
+	return &audio.IntBuffer{Format: &format, Data: data, SourceBitDepth: buf.SourceBitDepth}, nil
+}
+
+// upmixFloat is upmix for float buffers.
+func (e *Encoder) upmixFloat(buf *audio.FloatBuffer) (*audio.FloatBuffer, error) {
+	mono, err := e.upmixChannels(buf.Format)
+	if err != nil || !mono {
+		return buf, err
+	}
+	format := *buf.Format
+	format.NumChannels = e.NumChans
+	data := make([]float64, len(buf.Data)*e.NumChans)
+	for i, v := range buf.Data {
+		for c := 0; c < e.NumChans; c++ {
+			data[i*e.NumChans+c] = v
+		}
+	}
+	return &audio.FloatBuffer{Format: &format, Data: data}, nil
+}
@@ -0,0 +1,57 @@
+package wav
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestEncoderUpmixMono(t *testing.T) {
+	mono := &audio.Format{NumChannels: 1, SampleRate: 44100}
+	w := &memWriter{}
+	e := NewEncoder(w, 44100, 16, 2, FormatPCM)
+	e.UpmixMono = true
+	if err := e.Write(&audio.IntBuffer{Format: mono, Data: []int{1, -2, 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteFloat(&audio.FloatBuffer{Format: mono, Data: []float64{0.5, -0.25}}); err != nil {
+		t.Fatal(err)
+	}
+	// stereo buffers are written as is
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 2, SampleRate: 44100}, Data: []int{4, 5}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Write(&audio.IntBuffer{Format: &audio.Format{NumChannels: 3, SampleRate: 44100}, Data: []int{1, 2, 3}}); err == nil {
+		t.Fatal("expected 3 channels to be refused by a stereo encoder")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []int{1, 1, -2, -2, 3, 3, 16384, 16384, -8192, -8192, 4, 5}
+	if !reflect.DeepEqual(buf.Data, exp) {
+		t.Fatalf("expected %v, got %v", exp, buf.Data)
+	}
+
+	// without the option a mono buffer is taken as interleaved frames
+	w = &memWriter{}
+	e = NewEncoder(w, 44100, 16, 2, FormatPCM)
+	if err := e.Write(&audio.IntBuffer{Format: mono, Data: []int{1, -2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err = NewDecoder(bytes.NewReader(w.buf)).FullPCMBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(buf.Data, []int{1, -2}) {
+		t.Fatalf("expected the samples to be written as is, got %v", buf.Data)
+	}
+}
@@ -8,6 +8,7 @@ package wav
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"time"
 )
@@ -15,8 +16,56 @@ import (
 var (
 	// ErrPCMChunkNotFound indicates a bad audio file without data
 	ErrPCMChunkNotFound = errors.New("PCM Chunk not found in audio file")
+	// ErrNonConformant indicates an encoder configuration refused in strict mode
+	ErrNonConformant = errors.New("configuration isn't strictly conformant")
+	// ErrInvalidFormatCombo indicates a bit depth not supported by the audio format
+	ErrInvalidFormatCombo = errors.New("invalid audio format and bit depth combination")
+	// ErrSizeOverflow indicates a size or header value not fitting in its header field
+	ErrSizeOverflow = errors.New("value doesn't fit in its header field")
+	// ErrNonFiniteSample indicates a NaN or infinite float sample refused in strict mode
+	ErrNonFiniteSample = errors.New("non finite float sample")
+	// ErrWriterNotSeekable indicates a writer which can't seek back to patch
+	// the header, StreamEncoder writes wav files to unseekable outputs
+	ErrWriterNotSeekable = errors.New("the writer can't seek, use a StreamEncoder to write to unseekable outputs")
 )
 
+// Audio formats of the fmt chunk, see Encoder.WavAudioFormat. Other values
+// are written as is.
+const (
+	// FormatPCM is linear PCM with 8, 16, 24 or 32 bits.
+	FormatPCM = 1
+	// FormatMSADPCM is 4 bit Microsoft ADPCM, written by ADPCMEncoder.
+	FormatMSADPCM = 2
+	// FormatIEEEFloat is IEEE float with 32 or 64 bits.
+	FormatIEEEFloat = 3
+	// FormatALaw is 8 bit A-law.
+	FormatALaw = 6
+	// FormatMuLaw is 8 bit mu-law.
+	FormatMuLaw = 7
+	// FormatExtensible is WAVE_FORMAT_EXTENSIBLE, the samples are PCM and
+	// the fmt chunk is extended with the valid bits per sample, the channel
+	// mask and the sub format.
+	FormatExtensible = 0xFFFE
+)
+
+// WriteError reports a failure of the writer underlying an Encoder.
+type WriteError struct {
+	// Op is the operation that failed: header, data or metadata.
+	Op string
+	// Offset is the byte offset in the file at which the write failed.
+	Offset int64
+	Err    error
+}
+
+func (e *WriteError) Error() string {
+	return fmt.Sprintf("failed to write the %s at offset %d - %v", e.Op, e.Offset, e.Err)
+}
+
+// Unwrap returns the error of the underlying writer.
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
 func nullTermStr(b []byte) string {
 	return string(b[:clen(b)])
 }
@@ -30,18 +79,63 @@ func clen(n []byte) int {
 	return len(n)
 }
 
-func bytesNumFromDuration(dur time.Duration, sampleRate, bitDepth int) int {
-	k := bitDepth / 8
-	return samplesNumFromDuration(dur, sampleRate) * k
+// EstimateSize returns the size in bytes of a wav file of the passed duration
+// and audio format as written by the Encoder, or by the ADPCMEncoder for
+// FormatMSADPCM, with its default options: the RIFF header, the fmt chunk with
+// its extension if any, the fact chunk of ADPCM, the data chunk and the
+// chunks holding the passed metadata, which can be nil. See
+// Encoder.EstimateSize to account for the other options.
+func EstimateSize(sampleRate, bitDepth, numChans, audioFormat int, duration time.Duration, metadata *Metadata) int64 {
+	if audioFormat == FormatMSADPCM {
+		return NewADPCMEncoder(nil, sampleRate, numChans).EstimateSize(duration)
+	}
+	e := NewEncoder(nil, sampleRate, bitDepth, numChans, audioFormat)
+	e.Metadata = metadata
+	return e.EstimateSize(duration)
 }
 
-func samplesNumFromDuration(dur time.Duration, sampleRate int) int {
-	return int(math.Floor(float64(dur / sampleDuration(sampleRate))))
+// FramesForDuration returns the number of whole frames played during the
+// passed duration at the passed sample rate, rounding down.
+func FramesForDuration(d time.Duration, sampleRate int) int {
+	if sampleRate <= 0 {
+		return 0
+	}
+	secs := int64(d / time.Second)
+	rem := int64(d % time.Second)
+	return int(secs*int64(sampleRate) + rem*int64(sampleRate)/int64(time.Second))
 }
 
-func sampleDuration(sampleRate int) time.Duration {
-	if sampleRate == 0 {
+// DurationForFrames returns the duration of the passed number of frames at
+// the passed sample rate, rounding up to the nanosecond so it is the inverse
+// of FramesForDuration: FramesForDuration(DurationForFrames(n, r), r) == n.
+func DurationForFrames(frames, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
 		return 0
 	}
-	return time.Second / time.Duration(math.Abs(float64(sampleRate)))
-}
\ No newline at end of file
+	secs := int64(frames / sampleRate)
+	rem := int64(frames % sampleRate)
+	return time.Duration(secs)*time.Second + time.Duration((rem*int64(time.Second)+int64(sampleRate)-1)/int64(sampleRate))
+}
+
+// SignedToUnsigned8 converts a signed 8 bit sample in the [-128, 127] range to
+// the unsigned convention of 8 bit wav files, where silence is 128. Values out
+// of range are clipped.
+func SignedToUnsigned8(v int) uint8 {
+	if v > math.MaxInt8 {
+		v = math.MaxInt8
+	} else if v < math.MinInt8 {
+		v = math.MinInt8
+	}
+	return uint8(v + 128)
+}
+
+// UnsignedToSigned8 converts an unsigned 8 bit wav sample to a signed sample
+// in the [-128, 127] range, silence being 0.
+func UnsignedToSigned8(v uint8) int {
+	return int(v) - 128
+}
+
+func bytesNumFromDuration(dur time.Duration, sampleRate, bitDepth int) int {
+	k := bitDepth / 8
+	return FramesForDuration(dur, sampleRate) * k
+}
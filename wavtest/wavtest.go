@@ -0,0 +1,73 @@
+// Package wavtest provides utilities to test code using the wav package. It
+// is meant for tests only.
+package wavtest
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrInjected is the error returned by a FailingWriter reaching its failure
+// offset.
+var ErrInjected = errors.New("injected write failure")
+
+// WriterAtSeeker matches wav.WriterAtSeeker.
+type WriterAtSeeker interface {
+	io.Writer
+	io.WriterAt
+	io.Seeker
+}
+
+// FailingWriter wraps a writer to deterministically fail the writes reaching
+// a byte offset, simulating a full disk or a lost device. The bytes before
+// the offset are written so the wrapped writer holds the partial file. It can
+// be passed to wav.NewEncoder to test how an application handles partially
+// written files.
+type FailingWriter struct {
+	w WriterAtSeeker
+	// FailAt is the offset from which writes fail with ErrInjected.
+	FailAt int64
+}
+
+// NewFailingWriter returns a writer failing the writes to w reaching failAt.
+func NewFailingWriter(w WriterAtSeeker, failAt int64) *FailingWriter {
+	return &FailingWriter{w: w, FailAt: failAt}
+}
+
+// Write writes p at the current position of the wrapped writer.
+func (fw *FailingWriter) Write(p []byte) (int, error) {
+	pos, err := fw.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if pos+int64(len(p)) <= fw.FailAt {
+		return fw.w.Write(p)
+	}
+	n := 0
+	if pos < fw.FailAt {
+		if n, err = fw.w.Write(p[:fw.FailAt-pos]); err != nil {
+			return n, err
+		}
+	}
+	return n, ErrInjected
+}
+
+// WriteAt writes p at the passed offset of the wrapped writer.
+func (fw *FailingWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) <= fw.FailAt {
+		return fw.w.WriteAt(p, off)
+	}
+	n := 0
+	if off < fw.FailAt {
+		var err error
+		if n, err = fw.w.WriteAt(p[:fw.FailAt-off], off); err != nil {
+			return n, err
+		}
+	}
+	return n, ErrInjected
+}
+
+// Seek moves the cursor of the wrapped writer.
+func (fw *FailingWriter) Seek(offset int64, whence int) (int64, error) {
+	return fw.w.Seek(offset, whence)
+}
@@ -0,0 +1,40 @@
+package wav
+
+import (
+	"fmt"
+	"io"
+)
+
+// wrapPCMBlockSize is the size of the blocks WrapPCM copies the PCM through.
+const wrapPCMBlockSize = 32 * 1024
+
+// WrapPCM writes a wav file to out made of a PCM header followed by the raw
+// little endian PCM data read from in until EOF, like piping raw audio
+// through "sox -t raw". Nothing is buffered and out is never seeked so it can
+// be a pipe such as stdout: the RIFF and data chunk sizes are written with the
+// streaming convention of 0xFFFFFFFF since the data length isn't known, which
+// readers interpret as "read until EOF".
+func WrapPCM(out io.Writer, in io.Reader, sampleRate, bitDepth, numChans int) error {
+	header, err := streamingHeader(sampleRate, bitDepth, numChans, FormatPCM)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(header); err != nil {
+		return fmt.Errorf("failed to write the header - %w", err)
+	}
+	if _, err := io.CopyBuffer(out, in, make([]byte, wrapPCMBlockSize)); err != nil {
+		return fmt.Errorf("failed to copy the PCM data - %w", err)
+	}
+	return nil
+}
+
+// streamingHeader returns the header written by an Encoder up to the data
+// chunk, with the placeholder sizes.
+func streamingHeader(sampleRate, bitDepth, numChans, audioFormat int) ([]byte, error) {
+	w := NewSliceWriter(make([]byte, 128))
+	e := NewEncoder(w, sampleRate, bitDepth, numChans, audioFormat)
+	if err := e.writeSetup(); err != nil {
+		return nil, err
+	}
+	return w.buf[:w.Len()], nil
+}
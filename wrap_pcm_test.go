@@ -0,0 +1,48 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestWrapPCM(t *testing.T) {
+	// more data than a block, ending with a partial frame
+	pcm := make([]byte, wrapPCMBlockSize*2+10)
+	for i := 0; i+1 < len(pcm); i += 2 {
+		binary.LittleEndian.PutUint16(pcm[i:], uint16(i/2%1000))
+	}
+
+	// out is a plain io.Writer, WrapPCM can't seek
+	var out bytes.Buffer
+	if err := WrapPCM(struct{ io.Writer }{&out}, bytes.NewReader(pcm), 48000, 16, 2); err != nil {
+		t.Fatal(err)
+	}
+	b := out.Bytes()
+	if len(b) != 44+len(pcm) {
+		t.Fatalf("expected %d bytes, got %d", 44+len(pcm), len(b))
+	}
+	if riffSize, dataSize := binary.LittleEndian.Uint32(b[4:]), binary.LittleEndian.Uint32(b[40:]); riffSize != sizePlaceholder || dataSize != sizePlaceholder {
+		t.Fatalf("expected the streaming sizes, got %#x and %#x", riffSize, dataSize)
+	}
+	if !bytes.Equal(b[44:], pcm) {
+		t.Fatal("expected the PCM data to be copied through")
+	}
+
+	d := NewDecoder(bytes.NewReader(b))
+	buf, err := d.FullPCMBuffer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.SampleRate != 48000 || d.NumChans != 2 || d.BitDepth != 16 {
+		t.Fatalf("unexpected format %d/%d/%d", d.SampleRate, d.NumChans, d.BitDepth)
+	}
+	if n := len(buf.Data); n != len(pcm)/2 || buf.Data[n-1] != (n-1)%1000 {
+		t.Fatalf("unexpected decoded data, %d samples", n)
+	}
+
+	if err := WrapPCM(&out, bytes.NewReader(pcm), 48000, 12, 2); err == nil {
+		t.Fatal("expected an error with an invalid bit depth")
+	}
+}